@@ -28,17 +28,40 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // ============================================================================
@@ -46,19 +69,308 @@ import (
 // ============================================================================
 
 const (
-	DBConnString     = "user=user password=password host=postgres port=5432 dbname=gwi_challenge sslmode=disable"
-	DefaultPageSize  = 20
-	MaxPageSize      = 100
-	CacheTTLSeconds  = 300 // 5 minutes
-	MaxConnections   = 25  // database/sql pools automatically
-	RequestTimeout   = 30 * time.Second
+	DBConnString                = "user=user password=password host=postgres port=5432 dbname=gwi_challenge sslmode=disable"
+	DefaultPort                 = 8080 // fallback for PORT
+	DefaultPageSize             = 20   // fallback for PAGINATION_DEFAULT_SIZE
+	MaxPageSize                 = 100  // fallback for PAGINATION_MAX_SIZE
+	CacheTTLSeconds             = 300  // 5 minutes
+	CacheSweepInterval          = time.Minute
+	AssetTypeRefreshInterval    = time.Minute
+	MaxAssetTypeNameLength      = 20 // assets.type is VARCHAR(20)
+	MaxConnections              = 25 // database/sql pools automatically
+	RequestTimeout              = 30 * time.Second
+	SimilarAssetsLimit          = 10
+	DefaultFavoritesPerGroup    = 10
+	DefaultRecommendationsLimit = 10
+	MaxCheckFavoritesIDs        = 100       // asset IDs per POST /favorites/check
+	MaxBulkAssets               = 50        // assets per POST and DELETE /assets/bulk
+	MaxInsightTextBytes         = 50 * 1024 // GET /assets/{assetID}/insight-text is cut here
+	MaxImportBytes              = 10 << 20  // NDJSON body of POST /favorites/import/json-lines
+	ImportBatchSize             = 100       // favorites inserted per import transaction
+	DefaultTimelineDays         = 30
+	MaxTimelineDays             = 365
+	DefaultTimelinePerDay       = 10 // favorites listed per timeline day; count still covers all
+	MinCalendarYear             = 1970
+	MaxCalendarYear             = 9999
+	RecommendationNeighbors     = 5 // most similar users whose favorites are recommended
+	DefaultTrendingHours        = 24
+	MaxTrendingHours            = 7 * 24
+	DefaultTrendingLimit        = 10
+	TrendingCacheTTL            = 5 * time.Minute // trending lists may be this stale
+	FavoriteStatsCacheTTL       = time.Minute
+
+	StreamKeepAliveInterval = 15 * time.Second
+	StreamBufferSize        = 16 // events buffered per subscriber before dropping
+
+	DefaultAPIKeyRateLimit = 10   // requests per second
+	MaxAPIKeyRateLimit     = 1000 // requests per second
+
+	WebhookTimeout        = 10 * time.Second
+	WebhookMaxRetries     = 3
+	WebhookInitialBackoff = time.Second
+
+	DefaultDBMaxRetries = 5           // fallback for DB_MAX_RETRIES
+	DBInitialBackoff    = time.Second // first wait between database pings at startup
+
+	DownloadTimeout     = 10 * time.Second // to connect to a download URL and get its response headers
+	DownloadMaxDuration = 10 * time.Minute // for a whole download, body included
+	DownloadURLCacheTTL = 5 * time.Minute
+
+	DefaultShareLinkTTL = 7 * 24 * time.Hour
+
+	// ProblemTypeBaseURI prefixes the type of every RFC 7807 error response
+	ProblemTypeBaseURI = "https://gwi.example.com/errors/"
+
+	FavoriteRestoreWindow = 30 * 24 * time.Hour // how long a removed favorite can be restored
+	JanitorInterval       = time.Hour           // how often removed favorites and deleted assets are purged
+	DeletedAssetRetention = 90 * 24 * time.Hour // how long a deleted asset is kept before it is purged
+
+	// DefaultOrganizationID is used for requests without an org_id claim,
+	// including every request when authentication is disabled.
+	DefaultOrganizationID = "default"
+
+	AuditLogBufferSize = 1000 // entries queued before new ones are dropped
+
+	RequestMetricsBufferSize      = 1000 // metrics queued before new ones are dropped
+	RequestMetricsCleanupInterval = time.Hour
+	DefaultSLOWindowHours         = 24
+	MaxSLOWindowHours             = 7 * 24 // request metrics are kept this long
+
+	ReadinessTimeout = 2 * time.Second // query deadline for GET /api/v1/readyz
+	DBHealthTimeout  = 5 * time.Second // ping deadline for GET /health/db
+
+	HeartbeatInterval       = time.Second     // how often the liveness heartbeat ticks
+	LivenessMaxHeartbeatAge = 5 * time.Second // GET /api/v1/livez fails once the last tick is older
+
+	MaxDebugBodyLogBytes = 4096 // request body logged by DebugBodyLogMiddleware
+
+	IdempotencyKeyTTL             = 24 * time.Hour
+	IdempotencyKeyCleanupInterval = time.Hour
+	MaxIdempotencyKeyLength       = 255
+
+	MaxDisplayNameLength = 100
+	MaxEmailLength       = 254 // longest address SMTP can deliver to
 )
 
-// ValidAssetTypes defines which asset types are allowed
-var ValidAssetTypes = map[string]bool{
-	"chart":    true,
-	"insight":  true,
-	"audience": true,
+// Config holds runtime settings read from the environment.
+// Anything that differs between deployments belongs here rather than in the constants above.
+type Config struct {
+	// AllowedOrigins lists origins permitted to make cross-origin requests.
+	// Empty means no CORS headers are sent.
+	AllowedOrigins []string
+
+	// JWTSecret is the HS256 key used to verify bearer tokens.
+	// Empty disables authentication (local development only).
+	JWTSecret []byte
+
+	// ShareLinkTTL is how long a shared favorites link stays valid.
+	ShareLinkTTL time.Duration
+
+	// AllowCrossOrgAssets lets users favorite assets owned by other organizations.
+	AllowCrossOrgAssets bool
+
+	// LoosePagination clamps limit to MaxPageSize instead of rejecting it.
+	// Deprecated: only for clients written before limits were enforced.
+	LoosePagination bool
+
+	// DefaultPageSize is the limit of list endpoints when none is given,
+	// and MaxPageSize the largest limit accepted.
+	DefaultPageSize int
+	MaxPageSize     int
+
+	// Debug logs the request body of POST, PUT and PATCH requests that fail.
+	// Bodies may hold personal data, so keep it off in production.
+	Debug bool
+
+	// Port is the TCP port the server listens on.
+	Port int
+
+	// DBMaxRetries is how many times the first database ping is retried,
+	// so the service can start before Postgres is ready.
+	DBMaxRetries int
+}
+
+// LoadConfig reads configuration from environment variables.
+//
+//	CORS_ALLOWED_ORIGINS: comma-separated list, e.g. "https://app.gwi.com,http://localhost:3000"
+//	JWT_SECRET:           HS256 signing key for bearer tokens
+//	SHARE_LINK_TTL:       Go duration, e.g. "72h" (default 7 days)
+//	ALLOW_CROSS_ORG_ASSETS: "true" to allow favoriting other organizations' assets
+//	PAGINATION_DEFAULT_SIZE: limit used when none is given (default 20)
+//	PAGINATION_MAX_SIZE:     largest limit accepted (default 100)
+//	DEBUG:                   "true" to log the body of failed requests
+//	PORT:                    port to listen on (default 8080)
+//	DB_MAX_RETRIES:          database ping retries at startup (default 5)
+func LoadConfig() *Config {
+	config := &Config{
+		AllowedOrigins:  splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		JWTSecret:       []byte(os.Getenv("JWT_SECRET")),
+		ShareLinkTTL:    DefaultShareLinkTTL,
+		DefaultPageSize: DefaultPageSize,
+		MaxPageSize:     MaxPageSize,
+		Port:            DefaultPort,
+		DBMaxRetries:    DefaultDBMaxRetries,
+	}
+
+	if value := os.Getenv("SHARE_LINK_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			log.Printf("WARNING: invalid SHARE_LINK_TTL %q, using %s", value, DefaultShareLinkTTL)
+		} else {
+			config.ShareLinkTTL = ttl
+		}
+	}
+
+	config.AllowCrossOrgAssets, _ = strconv.ParseBool(os.Getenv("ALLOW_CROSS_ORG_ASSETS"))
+
+	config.LoosePagination, _ = strconv.ParseBool(os.Getenv("LOOSE_PAGINATION"))
+	if config.LoosePagination {
+		log.Println("WARNING: LOOSE_PAGINATION is deprecated; limits above the maximum will be rejected")
+	}
+
+	if value := os.Getenv("PAGINATION_DEFAULT_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			log.Printf("WARNING: invalid PAGINATION_DEFAULT_SIZE %q, using %d", value, DefaultPageSize)
+		} else {
+			config.DefaultPageSize = size
+		}
+	}
+	if value := os.Getenv("PAGINATION_MAX_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			log.Printf("WARNING: invalid PAGINATION_MAX_SIZE %q, using %d", value, MaxPageSize)
+		} else {
+			config.MaxPageSize = size
+		}
+	}
+	config.Debug, _ = strconv.ParseBool(os.Getenv("DEBUG"))
+
+	if value := os.Getenv("PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			log.Printf("WARNING: invalid PORT %q, using %d", value, DefaultPort)
+		} else {
+			config.Port = port
+		}
+	}
+
+	if value := os.Getenv("DB_MAX_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			log.Printf("WARNING: invalid DB_MAX_RETRIES %q, using %d", value, DefaultDBMaxRetries)
+		} else {
+			config.DBMaxRetries = retries
+		}
+	}
+
+	// An explicit maximum is kept; only the default is brought under it
+	if config.DefaultPageSize > config.MaxPageSize {
+		size := min(DefaultPageSize, config.MaxPageSize)
+		log.Printf("WARNING: PAGINATION_DEFAULT_SIZE %d exceeds PAGINATION_MAX_SIZE %d, using %d",
+			config.DefaultPageSize, config.MaxPageSize, size)
+		config.DefaultPageSize = size
+	}
+
+	return config
+}
+
+// splitList splits a comma-separated value, trimming spaces and dropping empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AssetTypeRegistry holds the asset types accepted by the API.
+// It is safe for concurrent use.
+type AssetTypeRegistry struct {
+	mu    sync.RWMutex
+	types map[string]bool
+}
+
+// NewAssetTypeRegistry creates a registry containing names.
+func NewAssetTypeRegistry(names ...string) *AssetTypeRegistry {
+	r := &AssetTypeRegistry{}
+	r.Replace(names)
+	return r
+}
+
+// IsValid reports whether name is a known asset type.
+func (r *AssetTypeRegistry) IsValid(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.types[name]
+}
+
+// Add makes name a valid asset type.
+func (r *AssetTypeRegistry) Add(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[name] = true
+}
+
+// Names returns the valid types in no particular order.
+func (r *AssetTypeRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Replace swaps the whole set of valid types.
+func (r *AssetTypeRegistry) Replace(names []string) {
+	types := make(map[string]bool, len(names))
+	for _, name := range names {
+		types[name] = true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types = types
+}
+
+// ValidAssetTypes defines which asset types are allowed.
+// It starts with the built-in types and is reloaded from the asset_types table
+// at startup and every AssetTypeRefreshInterval, so types added through another
+// instance become valid here within that interval.
+var ValidAssetTypes = NewAssetTypeRegistry("chart", "insight", "audience")
+
+// ValidAssetSorts defines the orderings accepted by the asset list.
+// "newest" is the default.
+var ValidAssetSorts = map[string]bool{
+	"newest":     true,
+	"popularity": true,
+}
+
+// ValidFavoriteSorts defines the orderings accepted by the favorites list.
+// "newest" is the default and lists pinned favorites first, by order_index;
+// "custom" follows the user's order_index.
+var ValidFavoriteSorts = map[string]bool{
+	"newest": true,
+	"custom": true,
+}
+
+// FavoriteSortColumns maps the fields the favorites list can be sorted by,
+// as a comma-separated sort (e.g. sort=asset_type,added_at), to their columns.
+var FavoriteSortColumns = map[string]string{
+	"asset_type":  "a.type",
+	"added_at":    "f.added_at",
+	"order_index": "f.order_index",
+	"is_pinned":   "f.is_pinned",
+}
+
+// SortField is one field of a multi-field sort, ascending unless Desc.
+type SortField struct {
+	Field string
+	Desc  bool
 }
 
 // ============================================================================
@@ -71,17 +383,260 @@ type Asset struct {
 	ID   string          `json:"id"`
 	Type string          `json:"type"` // "chart", "insight", "audience"
 	Data json.RawMessage `json:"data"` // Type-specific data as JSON
+	Tags []string        `json:"tags"` // Free-form labels, independent of Type
+
+	// CreatedAt is when the asset was created, in UTC.
+	CreatedAt time.Time `json:"created_at"`
+
+	// FavoriteCount is how many users currently favorite the asset.
+	FavoriteCount int `json:"favorite_count"`
+}
+
+// ChartData is the data of a chart asset with typed fields. Series keeps the
+// "data" key charts are stored with.
+type ChartData struct {
+	Title  string    `json:"title"`
+	XAxis  string    `json:"x_axis"`
+	YAxis  string    `json:"y_axis"`
+	Series []float64 `json:"data"`
+}
+
+// AssetVersion is a previous value of an asset's data. Versions are numbered
+// from 1 in the order they were replaced.
+type AssetVersion struct {
+	Version   int             `json:"version"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// BulkAssetInput is one asset in a POST /assets/bulk request.
+type BulkAssetInput struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	Tags []string        `json:"tags"`
+}
+
+// BulkDeleteResult is the response of DELETE /assets/bulk. Missing lists the
+// requested IDs that weren't found and is only set on a 207 response.
+type BulkDeleteResult struct {
+	DeletedAssets    int      `json:"deleted_assets"`
+	CascadeFavorites int      `json:"cascade_favorites"`
+	Missing          []string `json:"missing,omitempty"`
+}
+
+// ImportLineError explains why one line of a favorites import was rejected.
+type ImportLineError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// ImportResult is the response of POST /favorites/import/json-lines.
+// Skipped counts lines whose asset was already favorited; rejected lines
+// are in Errors, in line order. Error is set when a batch failed to commit:
+// the counts then cover the batches before it, which stay imported.
+type ImportResult struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Errors   []ImportLineError `json:"errors"`
+	Error    string            `json:"error,omitempty"`
 }
 
 // Favorite represents an asset favorited by a user.
-// The description_override lets users customize how the asset appears in their list.
+// The description_override lets users customize how the asset appears in their list;
+// it is left out of the JSON when unset rather than sent as null.
 type Favorite struct {
 	ID                  string     `json:"id"`
-	UserID              string     `json:"user_id"`
+	UserID              string     `json:"user_id,omitempty"` // left out of shared lists
 	Asset               *Asset     `json:"asset"`
-	DescriptionOverride *string    `json:"description_override"`
+	DescriptionOverride *string    `json:"description_override,omitempty"`
+	Notes               *string    `json:"notes,omitempty"` // private to the user; never displayed in place of the asset
 	AddedAt             time.Time  `json:"added_at"`
+	OrderIndex          int        `json:"order_index"` // position when sort=custom, ascending
+	IsPinned            bool       `json:"is_pinned"`   // listed first by the default sort
 	IsDeleted           bool       `json:"is_deleted"`
+	DeletedAt           *time.Time `json:"deleted_at,omitempty"` // set only when listing removed favorites
+}
+
+// UserRecord is a user as stored, without any of their favorites.
+type UserRecord struct {
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	DisplayName *string   `json:"display_name"`
+	Email       *string   `json:"email"`
+}
+
+// FavoriteCursor is the position of a favorite in the cursor pages of
+// GetFavorites: newest first, with the ID breaking ties between equal
+// added_at. An empty ID compares added_at only.
+type FavoriteCursor struct {
+	AddedAt time.Time
+	ID      string
+}
+
+// FavoriteOrder sets the position of one favorite in a user's custom order.
+type FavoriteOrder struct {
+	AssetID    string `json:"asset_id"`
+	OrderIndex int    `json:"order_index"`
+}
+
+// AssetType is an allowed value of Asset.Type.
+// Schema optionally describes the type's data as a JSON Schema document.
+type AssetType struct {
+	Name      string          `json:"name"`
+	Schema    json.RawMessage `json:"schema_json"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// TrendingAsset is an asset with how many times it was favorited recently.
+type TrendingAsset struct {
+	Asset *Asset `json:"asset"`
+	Score int    `json:"score"` // favorites added within the trending window
+}
+
+// FavoriteStats summarizes a user's active favorites. The pointers are nil
+// when the user has no favorites.
+type FavoriteStats struct {
+	TotalFavorites int        `json:"total_favorites"`
+	OldestFavorite *time.Time `json:"oldest_favorite"`
+	NewestFavorite *time.Time `json:"newest_favorite"`
+	MostUsedType   *string    `json:"most_used_type"` // ties go to the first type alphabetically
+}
+
+// FavoriteBadge is a user's progress towards the badge of one asset type.
+type FavoriteBadge struct {
+	Type      string `json:"type"`
+	Count     int    `json:"count"`     // the user's active favorites of this type
+	Threshold int    `json:"threshold"` // favorites needed to earn the badge
+	Badge     string `json:"badge"`
+	Earned    bool   `json:"earned"`
+}
+
+// FavoriteBadgeRule is the badge awarded for favoriting Threshold assets of a type.
+type FavoriteBadgeRule struct {
+	Badge     string
+	Threshold int
+}
+
+// FavoriteBadgeRules lists the badges by asset type. Types without a rule
+// have no badge.
+var FavoriteBadgeRules = map[string]FavoriteBadgeRule{
+	"chart":    {Badge: "chart_enthusiast", Threshold: 5},
+	"insight":  {Badge: "insight_seeker", Threshold: 5},
+	"audience": {Badge: "audience_explorer", Threshold: 3},
+}
+
+// DescriptionChange is a previous value of a favorite's description_override.
+// A nil Description means the favorite had no override at that point.
+type DescriptionChange struct {
+	ID          string    `json:"id"`
+	Description *string   `json:"description"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// TimelineDay is one day of a user's favorites timeline.
+// Date is the day the favorites were added, as YYYY-MM-DD. Count is every
+// favorite of the day; Favorites holds only the newest of them.
+type TimelineDay struct {
+	Date      string      `json:"date"`
+	Count     int         `json:"count"`
+	Favorites []*Favorite `json:"favorites"`
+}
+
+// CalendarDay is one day of a favorites calendar heatmap.
+type CalendarDay struct {
+	Date  string `json:"date"` // YYYY-MM-DD, UTC
+	Count int    `json:"count"`
+}
+
+// Webhook is a URL notified when a user's favorites change.
+// Each delivery is signed with Secret so receivers can verify it came from us.
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"` // never echoed back
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey authenticates server-to-server clients as a user.
+// Only the SHA-256 of the key is stored; the plaintext is shown once at creation.
+type APIKey struct {
+	ID             string     `json:"id"`
+	UserID         string     `json:"user_id"`
+	OrganizationID string     `json:"-"` // the user's organization
+	KeyHash        string     `json:"-"`
+	RateLimitRPS   int        `json:"rate_limit_rps"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      *time.Time `json:"expires_at"` // nil never expires
+}
+
+// ShareToken grants unauthenticated, read-only access to a user's favorites until it expires.
+type ShareToken struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"-"` // not revealed to people the link is shared with
+	OrgID     string    `json:"-"` // the user's organization
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IdempotentResponse is a stored response replayed for a repeated Idempotency-Key.
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// AuditEntry records one successful mutation for compliance.
+// EntityID is the asset ID for favorites, which are identified by (user, asset).
+type AuditEntry struct {
+	ID             string          `json:"id"`
+	OrganizationID string          `json:"-"`
+	Operation      string          `json:"operation"`   // "create", "update" or "delete"
+	EntityType     string          `json:"entity_type"` // "user", "asset", "favorite", ...
+	EntityID       *string         `json:"entity_id"`
+	UserID         *string         `json:"user_id"` // the user whose data changed, if any
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// AuditEvent is an audit entry as shown in a user's activity timeline.
+type AuditEvent struct {
+	Action    string    `json:"action"`             // e.g. "add_favorite", "update_asset"
+	AssetID   *string   `json:"asset_id,omitempty"` // set for asset and favorite events
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// auditAction names an audit operation as a user action.
+// Favorites are added and removed rather than created and deleted.
+func auditAction(operation string, entityType string) string {
+	if entityType == "favorite" {
+		switch operation {
+		case "create":
+			return "add_favorite"
+		case "delete":
+			return "remove_favorite"
+		}
+	}
+	return operation + "_" + entityType
+}
+
+// RequestMetric is the outcome of one request, recorded for SLO tracking.
+// Endpoint is the route template, so /assets/{assetID} is one endpoint.
+type RequestMetric struct {
+	Endpoint   string
+	Method     string
+	StatusCode int
+	DurationMS float64
+	RecordedAt time.Time
+}
+
+// EndpointSLO summarizes the latencies of one endpoint and method.
+type EndpointSLO struct {
+	Endpoint string  `json:"endpoint"`
+	Method   string  `json:"method"`
+	Requests int     `json:"requests"`
+	P50MS    float64 `json:"p50_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	P99MS    float64 `json:"p99_ms"`
 }
 
 // PaginatedResponse wraps a list of favorites with pagination metadata.
@@ -92,12 +647,75 @@ type PaginatedResponse struct {
 
 // PaginationInfo contains metadata about pagination.
 type PaginationInfo struct {
-	Page       int `json:"page"`
-	Limit      int `json:"limit"`
-	Total      int `json:"total"`
-	TotalPages int `json:"total_pages"`
+	Page       int  `json:"page"`
+	Limit      int  `json:"limit"`
+	Total      int  `json:"total"`
+	TotalPages int  `json:"total_pages"`
 	HasNext    bool `json:"has_next"`
 	HasPrev    bool `json:"has_prev"`
+	// RetrievedAt is when the page was read from the database. Cached pages
+	// keep it, so clients can tell how stale they are.
+	RetrievedAt time.Time `json:"retrieved_at"`
+	// NextBefore and NextBeforeID are the added_at and ID of the last favorite
+	// on the page; pass them as ?before=&before_id= to fetch the next page
+	// without an offset. Favorites only, and unset for sorts other than newest
+	// and for pages holding only pins.
+	NextBefore   *time.Time `json:"next_before,omitempty"`
+	NextBeforeID string     `json:"next_before_id,omitempty"`
+}
+
+// newPaginationInfo describes page of a listing with limit items per page
+// and total items in all. An empty listing still has one page.
+func newPaginationInfo(page int, limit int, total int) PaginationInfo {
+	totalPages := (total + limit - 1) / limit // Ceiling division
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	return PaginationInfo{
+		Page:        page,
+		Limit:       limit,
+		Total:       total,
+		TotalPages:  totalPages,
+		HasNext:     page < totalPages,
+		HasPrev:     page > 1,
+		RetrievedAt: time.Now().UTC(),
+	}
+}
+
+// PoolStats is the subset of sql.DBStats reported by the health check.
+type PoolStats struct {
+	OpenConnections int    `json:"open_connections"`
+	InUse           int    `json:"in_use"`
+	Idle            int    `json:"idle"`
+	WaitCount       int64  `json:"wait_count"`
+	WaitDuration    string `json:"wait_duration"`
+}
+
+// HealthResponse is returned by the health check endpoint.
+type HealthResponse struct {
+	Status string `json:"status"` // always "ok"; readiness is reported by /api/v1/readyz
+	DB     struct {
+		Stats PoolStats `json:"stats"`
+	} `json:"db"`
+}
+
+// LivenessResponse is returned by the liveness probe.
+type LivenessResponse struct {
+	Status     string `json:"status"` // "alive" or "stalled"
+	Heartbeats int64  `json:"heartbeats"`
+}
+
+// ReadinessResponse is returned by the readiness probe.
+type ReadinessResponse struct {
+	Status string `json:"status"` // "ready" or "unavailable"
+}
+
+// DBHealthResponse is returned by the database health check endpoint.
+// LatencyMs is set on success, Error on failure.
+type DBHealthResponse struct {
+	Status    string `json:"status"` // "ok" or "error"
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
 // ErrorResponse formats errors for HTTP responses.
@@ -105,6 +723,18 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// ProblemDetail is an RFC 7807 problem, the body of every error response.
+// Error repeats Detail as an extension member so clients reading
+// ErrorResponse keep working.
+type ProblemDetail struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	Error    string `json:"error"`
+}
+
 // ============================================================================
 // DATABASE LAYER
 // ============================================================================
@@ -112,15 +742,107 @@ type ErrorResponse struct {
 // Storage handles all database operations. Keeping storage separate from
 // business logic makes the code testable and follows single responsibility.
 type Storage struct {
-	db *sql.DB
+	db       *sql.DB
+	auditLog *AuditLogger     // may be nil
+	metrics  *MetricsRecorder // may be nil
+
+	// txAudit holds audit entries recorded within open transactions until
+	// they commit; entries of rolled back transactions are dropped.
+	txAuditMu sync.Mutex
+	txAudit   map[*sql.Tx][]*AuditEntry
+}
+
+// Store is the storage the Service depends on. *Storage implements it
+// against PostgreSQL; tests substitute an in-memory mock.
+type Store interface {
+	WithTransaction(fn func(tx *sql.Tx) error) error
+
+	// Users
+	CreateUser(orgID string, userID string) error
+	UserExists(orgID string, userID string) (bool, error)
+	UserExistsTx(tx *sql.Tx, orgID string, userID string) (bool, error)
+	ListUsers(orgID string, limit int, offset int) ([]*UserRecord, int, error)
+	GetUser(orgID string, userID string) (*UserRecord, error)
+	UpdateUser(orgID string, userID string, displayName *string, email *string) (*UserRecord, error)
+	SearchUsers(orgID string, query string, limit int, offset int) ([]*UserRecord, int, error)
+	DeleteUser(orgID string, userID string) (bool, error)
+
+	// Assets
+	CreateAsset(orgID string, assetType string, data json.RawMessage, tags []string) (string, error)
+	BulkCreateAssets(orgID string, items []BulkAssetInput) ([]string, error)
+	GetAsset(orgID string, assetID string) (*Asset, error)
+	GetAssetTx(tx *sql.Tx, orgID string, assetID string) (*Asset, error)
+	GetAssetForUpdateTx(tx *sql.Tx, orgID string, assetID string) (*Asset, error)
+	UpdateAssetDataTx(tx *sql.Tx, orgID string, assetID string, data json.RawMessage) (json.RawMessage, bool, error)
+	GetAssetVersions(orgID string, assetID string) ([]*AssetVersion, bool, error)
+	GetAssetVersion(orgID string, assetID string, version int) (*AssetVersion, error)
+	GetAssetVersionTx(tx *sql.Tx, orgID string, assetID string, version int) (*AssetVersion, error)
+	AssetExists(orgID string, assetID string) (bool, error)
+	ListAssets(orgID string, limit int, offset int, assetTypes []string, tag *string, search *string, sort string) ([]*Asset, int, error)
+	DeleteAsset(orgID string, assetID string) (bool, int, error)
+	BulkDeleteAssets(orgID string, assetIDs []string) ([]string, int, error)
+	ListAssetTypes() ([]*AssetType, error)
+	CreateAssetType(orgID string, name string, schema json.RawMessage) (*AssetType, error)
+
+	// Favorites
+	AddToFavoritesTx(tx *sql.Tx, orgID string, userID string, assetID string, descriptionOverride *string, notes *string, addedAt *time.Time) (string, time.Time, bool, error)
+	GetFavorite(orgID string, userID string, assetID string) (*Favorite, error)
+	GetFavorites(orgID string, userID string, limit int, offset int, assetType *string, sort []SortField, before *FavoriteCursor) ([]*Favorite, int, error)
+	GetFavoritesAfter(orgID string, userID string, limit int, assetType *string, sort []SortField, after *Favorite) ([]*Favorite, error)
+	GetFavoritesByType(orgID string, userID string, perGroup int) (map[string][]*Favorite, error)
+	GetMostRecentFavoritePerType(orgID string, userID string) (map[string]*Favorite, error)
+	GetFavoritesTimeline(orgID string, userID string, days int, perDay int) ([]*TimelineDay, error)
+	GetFavoriteAssetTypes(orgID string, userID string) ([]string, error)
+	GetUserFavoriteStats(orgID string, userID string) (*FavoriteStats, error)
+	CountFavoritesByType(orgID string, userID string) (map[string]int, error)
+	GetFavoriteCalendarData(orgID string, userID string, year int) (map[string]int, error)
+	GetCommonFavorites(orgID string, userID1 string, userID2 string) ([]*Asset, error)
+	GetRandomFavorite(orgID string, userID string) (*Favorite, error)
+	GetRecommendedAssets(orgID string, userID string, limit int) ([]*Asset, error)
+	GetTrendingAssets(orgID string, hours int, limit int) ([]*TrendingAsset, error)
+	SearchFavorites(orgID string, userID string, query string, limit int, offset int) ([]*Favorite, int, error)
+	CheckFavorites(orgID string, userID string, assetIDs []string) (map[string]bool, error)
+	FavoriteExists(orgID string, userID string, assetID string) (bool, error)
+	UpdateFavoriteDescription(orgID string, userID string, assetID string, description string) (bool, error)
+	UpdateFavoriteNotes(orgID string, userID string, assetID string, notes *string) (bool, error)
+	SetFavoritePinned(orgID string, userID string, assetID string, pinned bool) (bool, error)
+	GetDescriptionHistory(orgID string, userID string, assetID string) ([]*DescriptionChange, bool, error)
+	ReorderFavorites(orgID string, userID string, order []FavoriteOrder) (bool, error)
+	RemoveFromFavorites(orgID string, userID string, assetID string) (bool, error)
+	RestoreFavorite(orgID string, userID string, assetID string, removedAfter time.Time) (bool, error)
+	GetDeletedFavorites(orgID string, userID string, removedAfter time.Time, limit int, offset int) ([]*Favorite, int, error)
+	RemoveAllFavorites(orgID string, userID string) (int, error)
+	PurgeDeletedFavorites(olderThan time.Duration) (int, error)
+	PurgeDeletedAssets(olderThan time.Duration) (int, error)
+
+	// Webhooks, API keys, share links
+	CreateWebhook(orgID string, userID string, url string, secret string) (*Webhook, error)
+	ListWebhooks(userID string) ([]*Webhook, error)
+	DeleteWebhook(orgID string, userID string, webhookID string) (bool, error)
+	CreateAPIKey(orgID string, userID string, keyHash string, rateLimitRPS int, expiresAt *time.Time) (*APIKey, error)
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	ListAPIKeys(orgID string) ([]*APIKey, error)
+	DeleteAPIKey(orgID string, keyID string) (bool, error)
+	CreateShareToken(orgID string, userID string, token string, expiresAt time.Time) (*ShareToken, error)
+	GetShareToken(token string) (*ShareToken, error)
+
+	// Idempotency and audit
+	GetIdempotentResponse(userID string, key string) (*IdempotentResponse, error)
+	SaveIdempotentResponse(userID string, key string, statusCode int, body []byte) error
+	ListAuditLog(orgID string, limit int, offset int) ([]*AuditEntry, int, error)
+	GetUserActivity(orgID string, userID string, limit int, offset int) ([]*AuditEvent, int, error)
+
+	// Request metrics
+	RecordRequestMetric(metric *RequestMetric)
+	GetEndpointSLOs(hours int) ([]*EndpointSLO, error)
 }
 
 // NewStorage creates a new Storage instance with database connection.
 // The connection pool is created automatically by database/sql.
-func NewStorage() (*Storage, error) {
+func NewStorage(connString string, maxRetries int) (*Storage, error) {
 	// database/sql automatically manages a connection pool
 	// Default max connections is 0 (unlimited), but we limit it
-	db, err := sql.Open("postgres", DBConnString)
+	db, err := sql.Open("postgres", connString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -132,36 +854,164 @@ func NewStorage() (*Storage, error) {
 	db.SetMaxOpenConns(MaxConnections)
 	db.SetConnMaxLifetime(time.Hour)
 
-	// Test the connection
-	if err := db.Ping(); err != nil {
+	// Test the connection, waiting for the database if it is still starting
+	if err := pingWithRetry(db.Ping, maxRetries, DBInitialBackoff); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	log.Println("Database connection established")
-	return &Storage{db: db}, nil
+	return &Storage{
+		db:       db,
+		auditLog: NewAuditLogger(db, AuditLogBufferSize),
+		metrics:  NewMetricsRecorder(db, RequestMetricsBufferSize),
+	}, nil
+}
+
+// pingWithRetry calls ping, retrying up to maxRetries times with exponential
+// backoff starting at initialBackoff. It returns the last error if all fail.
+func pingWithRetry(ping func() error, maxRetries int, initialBackoff time.Duration) error {
+	backoff := initialBackoff
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Database not ready (attempt %d of %d): %v; retrying in %s",
+				attempt, maxRetries+1, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if err = ping(); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("giving up after %d retries: %w", maxRetries, err)
+}
+
+// Ready runs a trivial query, so the database is known to accept queries
+// rather than only connections. Like Ping, it returns once ctx is done.
+func (s *Storage) Ready(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		var one int
+		done <- s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so a query can be
+// written once and run either on its own or inside a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WithTransaction runs fn in a transaction, committing if it returns nil
+// and rolling back otherwise.
+func (s *Storage) WithTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op after a successful Commit
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	s.txAuditMu.Lock()
+	entries := s.txAudit[tx]
+	delete(s.txAudit, tx)
+	s.txAuditMu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		s.auditLog.Record(entry)
+	}
+	return nil
 }
 
-// Close closes the database connection pool.
+// Close flushes pending audit entries and request metrics and closes the
+// database connection pool.
 func (s *Storage) Close() error {
+	s.auditLog.Close()
+	s.metrics.Close()
 	return s.db.Close()
 }
 
+// Ping verifies a connection to the database is still alive.
+// It returns once ctx is done, even while a connection is being opened.
+func (s *Storage) Ping(ctx context.Context) error {
+	// lib/pq ignores the context while it opens a connection, so a server that
+	// accepts connections but never answers would block PingContext. The ping
+	// is left to finish in the background.
+	done := make(chan error, 1)
+	go func() {
+		done <- s.db.PingContext(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns connection pool statistics.
+func (s *Storage) Stats() PoolStats {
+	stats := s.db.Stats()
+	return PoolStats{
+		OpenConnections: stats.OpenConnections,
+		InUse:           stats.InUse,
+		Idle:            stats.Idle,
+		WaitCount:       stats.WaitCount,
+		WaitDuration:    stats.WaitDuration.String(),
+	}
+}
+
 // CreateUser creates a user (idempotent). Users are minimal - just ID.
-func (s *Storage) CreateUser(userID string) error {
+func (s *Storage) CreateUser(orgID string, userID string) error {
 	query := `
-		INSERT INTO users (id)
-		VALUES ($1)
+		INSERT INTO users (id, organization_id)
+		VALUES ($1, $2)
 		ON CONFLICT (id) DO NOTHING
 	`
-	_, err := s.db.Exec(query, userID)
-	return err
+	_, err := s.db.Exec(query, userID, orgID)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(orgID, "create", "user", userID, userID, nil)
+	return nil
 }
 
-// UserExists checks if a user exists. Used for validation.
-func (s *Storage) UserExists(userID string) (bool, error) {
-	query := "SELECT id FROM users WHERE id = $1"
+// UserExists checks if a user exists in the organization. Used for validation.
+func (s *Storage) UserExists(orgID string, userID string) (bool, error) {
+	return userExists(s.db, orgID, userID, "")
+}
+
+// UserExistsTx is UserExists within tx. The user row is share-locked, so it
+// can't be deleted until tx ends.
+func (s *Storage) UserExistsTx(tx *sql.Tx, orgID string, userID string) (bool, error) {
+	return userExists(tx, orgID, userID, " FOR SHARE")
+}
+
+func userExists(q querier, orgID string, userID string, lock string) (bool, error) {
+	query := "SELECT id FROM users WHERE id = $1 AND organization_id = $2" + lock
 	var id string
-	err := s.db.QueryRow(query, userID).Scan(&id)
+	err := q.QueryRow(query, userID, orgID).Scan(&id)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -173,45 +1023,97 @@ func (s *Storage) UserExists(userID string) (bool, error) {
 
 // ListUsers fetches all users with pagination.
 // Returns (users, totalCount, error)
-func (s *Storage) ListUsers(limit int, offset int) ([]*struct {
-	ID        string
-	CreatedAt time.Time
-}, int, error) {
+func (s *Storage) ListUsers(orgID string, limit int, offset int) ([]*UserRecord, int, error) {
 	// Get total count
-	countQuery := "SELECT COUNT(*) FROM users"
+	countQuery := "SELECT COUNT(*) FROM users WHERE organization_id = $1"
 	var total int
-	err := s.db.QueryRow(countQuery).Scan(&total)
+	err := s.db.QueryRow(countQuery, orgID).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Fetch page
+	// The list is public, so emails are left out (search is admin only)
 	query := `
-		SELECT id, created_at
+		SELECT id, created_at, display_name
 		FROM users
+		WHERE organization_id = $1
 		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		LIMIT $2 OFFSET $3
 	`
-	rows, err := s.db.Query(query, limit, offset)
+	rows, err := s.db.Query(query, orgID, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var users []*struct {
-		ID        string
-		CreatedAt time.Time
+	var users []*UserRecord
+	for rows.Next() {
+		user := &UserRecord{}
+		if err := rows.Scan(&user.ID, &user.CreatedAt, &user.DisplayName); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// GetUser fetches a single user by ID. Returns nil if not found.
+func (s *Storage) GetUser(orgID string, userID string) (*UserRecord, error) {
+	query := "SELECT id, created_at, display_name, email FROM users WHERE id = $1 AND organization_id = $2"
+	user := &UserRecord{}
+	err := s.db.QueryRow(query, userID, orgID).Scan(&user.ID, &user.CreatedAt, &user.DisplayName, &user.Email)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SearchUsers fetches users whose display name or email contains query,
+// case-insensitively, newest first.
+// Returns (users, totalCount, error)
+func (s *Storage) SearchUsers(orgID string, query string, limit int, offset int) ([]*UserRecord, int, error) {
+	// LIKE wildcards in the query match literally
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+	whereClause := `
+		WHERE organization_id = $1
+		  AND (display_name ILIKE '%' || $2 || '%' OR email ILIKE '%' || $2 || '%')
+	`
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM users"+whereClause, orgID, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	selectQuery := `
+		SELECT id, created_at, display_name, email
+		FROM users
+	` + whereClause + `
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.Query(selectQuery, orgID, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer rows.Close()
+
+	users := []*UserRecord{}
 	for rows.Next() {
-		var id string
-		var createdAt time.Time
-		if err := rows.Scan(&id, &createdAt); err != nil {
+		user := &UserRecord{}
+		if err := rows.Scan(&user.ID, &user.CreatedAt, &user.DisplayName, &user.Email); err != nil {
 			return nil, 0, err
 		}
-		users = append(users, &struct {
-			ID        string
-			CreatedAt time.Time
-		}{ID: id, CreatedAt: createdAt})
+		users = append(users, user)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -221,6 +1123,32 @@ func (s *Storage) ListUsers(limit int, offset int) ([]*struct {
 	return users, total, nil
 }
 
+// UpdateUser replaces a user's display name and email; nil clears either.
+// Returns nil if the user is not found.
+func (s *Storage) UpdateUser(orgID string, userID string, displayName *string, email *string) (*UserRecord, error) {
+	query := `
+		UPDATE users
+		SET display_name = $1, email = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND organization_id = $4
+		RETURNING id, created_at, display_name, email
+	`
+	user := &UserRecord{}
+	err := s.db.QueryRow(query, displayName, email, userID, orgID).Scan(&user.ID, &user.CreatedAt, &user.DisplayName, &user.Email)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The email is personal data, so only whether it was set is audited
+	s.recordAudit(orgID, "update", "user", userID, userID, map[string]interface{}{
+		"display_name": displayName,
+		"email_set":    email != nil,
+	})
+	return user, nil
+}
+
 // ============================================================================
 // USER MANAGEMENT - DELETE USER
 // ============================================================================
@@ -228,12 +1156,12 @@ func (s *Storage) ListUsers(limit int, offset int) ([]*struct {
 // DeleteUser deletes a user and all their associated data.
 // Cascades to remove all their favorites.
 // Returns true if user found and deleted, false if not found.
-func (s *Storage) DeleteUser(userID string) (bool, error) {
+func (s *Storage) DeleteUser(orgID string, userID string) (bool, error) {
 	query := `
 		DELETE FROM users
-		WHERE id = $1
+		WHERE id = $1 AND organization_id = $2
 	`
-	result, err := s.db.Exec(query, userID)
+	result, err := s.db.Exec(query, userID, orgID)
 	if err != nil {
 		return false, err
 	}
@@ -243,6 +1171,9 @@ func (s *Storage) DeleteUser(userID string) (bool, error) {
 		return false, err
 	}
 
+	if rowsAffected > 0 {
+		s.recordAudit(orgID, "delete", "user", userID, userID, nil)
+	}
 	return rowsAffected > 0, nil
 }
 
@@ -250,68 +1181,170 @@ func (s *Storage) DeleteUser(userID string) (bool, error) {
 // ASSET MANAGEMENT - CREATE, READ, DELETE ASSETS
 // ============================================================================
 
+// favoriteCountColumn selects an asset's active favorite count in queries
+// where the asset is aliased as "a". It is served by idx_favorite_asset.
+const favoriteCountColumn = `(
+	SELECT COUNT(*) FROM favorites fc
+	WHERE fc.asset_id = a.id AND fc.deleted_at IS NULL
+)`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFavorite scans a favorite and its asset from a row selecting f.id,
+// f.user_id, f.description_override, f.notes, f.added_at, f.order_index,
+// f.is_pinned, a.id, a.type, a.data, a.tags, a.created_at and
+// favoriteCountColumn, in that order. Columns selected after those are
+// scanned into extra.
+func scanFavorite(row rowScanner, extra ...interface{}) (*Favorite, error) {
+	favorite := &Favorite{Asset: &Asset{}}
+	var dataStr string
+
+	dest := append([]interface{}{
+		&favorite.ID,
+		&favorite.UserID,
+		&favorite.DescriptionOverride,
+		&favorite.Notes,
+		&favorite.AddedAt,
+		&favorite.OrderIndex,
+		&favorite.IsPinned,
+		&favorite.Asset.ID,
+		&favorite.Asset.Type,
+		&dataStr,
+		pq.Array(&favorite.Asset.Tags),
+		&favorite.Asset.CreatedAt,
+		&favorite.Asset.FavoriteCount,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	favorite.AddedAt = favorite.AddedAt.UTC()
+	favorite.Asset.Data = json.RawMessage(dataStr)
+	favorite.Asset.CreatedAt = favorite.Asset.CreatedAt.UTC()
+	return favorite, nil
+}
+
 // CreateAsset creates a new asset and returns its ID.
 // Data is stored as JSONB for flexibility and queryability.
-func (s *Storage) CreateAsset(assetType string, data json.RawMessage) (string, error) {
+func (s *Storage) CreateAsset(orgID string, assetType string, data json.RawMessage, tags []string) (string, error) {
 	assetID := uuid.New().String()
 	query := `
-		INSERT INTO assets (id, type, data)
-		VALUES ($1, $2, $3)
+		INSERT INTO assets (id, type, data, tags, organization_id)
+		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err := s.db.Exec(query, assetID, assetType, string(data))
+	_, err := s.db.Exec(query, assetID, assetType, string(data), pq.Array(tags), orgID)
 	if err != nil {
 		return "", err
 	}
+	s.recordAudit(orgID, "create", "asset", assetID, "", map[string]interface{}{
+		"type": assetType,
+		"data": data,
+		"tags": tags,
+	})
 	return assetID, nil
 }
 
-// GetAsset fetches a single asset by ID. Returns nil if not found.
-func (s *Storage) GetAsset(assetID string) (*Asset, error) {
-	query := "SELECT id, type, data FROM assets WHERE id = $1"
-	var id, assetType string
-	var dataStr string
-	err := s.db.QueryRow(query, assetID).Scan(&id, &assetType, &dataStr)
-	if err == sql.ErrNoRows {
-		return nil, nil
+// BulkCreateAssets creates all items with a single INSERT, so either every
+// asset is created or none is. IDs are returned in the order of items.
+func (s *Storage) BulkCreateAssets(orgID string, items []BulkAssetInput) ([]string, error) {
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = uuid.New().String()
 	}
-	if err != nil {
+
+	query, args := buildBulkInsertAssetsQuery(orgID, ids, items)
+	if _, err := s.db.Exec(query, args...); err != nil {
 		return nil, err
 	}
-	return &Asset{
-		ID:   id,
-		Type: assetType,
-		Data: json.RawMessage(dataStr),
-	}, nil
-}
 
-// ListAssets fetches all assets with pagination.
-// Returns (assets, totalCount, error)
-func (s *Storage) ListAssets(limit int, offset int, assetType *string) ([]*Asset, int, error) {
-	// Get total count
-	whereClause := ""
-	queryArgs := []interface{}{}
-	if assetType != nil && ValidAssetTypes[*assetType] {
-		whereClause = " WHERE type = $1"
-		queryArgs = append(queryArgs, *assetType)
+	for i, item := range items {
+		s.recordAudit(orgID, "create", "asset", ids[i], "", map[string]interface{}{
+			"type": item.Type,
+			"data": item.Data,
+			"tags": item.Tags,
+		})
 	}
+	return ids, nil
+}
 
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM assets%s", whereClause)
+// buildBulkInsertAssetsQuery builds one multi-row INSERT for items. Each row
+// takes five consecutive placeholders, numbered from len(args) as they're appended.
+func buildBulkInsertAssetsQuery(orgID string, ids []string, items []BulkAssetInput) (string, []interface{}) {
+	var b strings.Builder
+	b.WriteString("INSERT INTO assets (id, type, data, tags, organization_id) VALUES ")
+	args := make([]interface{}, 0, len(items)*5)
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		args = append(args, ids[i], item.Type, string(item.Data), pq.Array(item.Tags), orgID)
+		n := len(args)
+		fmt.Fprintf(&b, "($%d, $%d, $%d, $%d, $%d)", n-4, n-3, n-2, n-1, n)
+	}
+	return b.String(), args
+}
+
+// GetAsset fetches a single asset by ID. Returns ErrAssetNotFound if not found.
+// An empty orgID matches assets of any organization (cross-org favorites).
+func (s *Storage) GetAsset(orgID string, assetID string) (*Asset, error) {
+	return getAsset(s.db, orgID, assetID, "")
+}
+
+// GetAssetTx is GetAsset within tx. The asset row is share-locked, so it
+// can't be deleted until tx ends.
+func (s *Storage) GetAssetTx(tx *sql.Tx, orgID string, assetID string) (*Asset, error) {
+	return getAsset(tx, orgID, assetID, " FOR SHARE OF a")
+}
+
+// GetAssetForUpdateTx is GetAsset within tx, locking the asset row against
+// concurrent updates until tx ends. Used for read-modify-write of asset data.
+func (s *Storage) GetAssetForUpdateTx(tx *sql.Tx, orgID string, assetID string) (*Asset, error) {
+	return getAsset(tx, orgID, assetID, " FOR UPDATE OF a")
+}
+
+func getAsset(q querier, orgID string, assetID string, lock string) (*Asset, error) {
+	query := "SELECT a.id, a.type, a.data, a.tags, a.created_at, " + favoriteCountColumn + " FROM assets a WHERE a.id = $1 AND ($2 = '' OR a.organization_id = $2) AND a.deleted_at IS NULL" + lock
+	var id, assetType string
+	var dataStr string
+	var tags []string
+	var createdAt time.Time
+	var favoriteCount int
+	err := q.QueryRow(query, assetID, orgID).Scan(&id, &assetType, &dataStr, pq.Array(&tags), &createdAt, &favoriteCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Asset{
+		ID:            id,
+		Type:          assetType,
+		Data:          json.RawMessage(dataStr),
+		Tags:          tags,
+		CreatedAt:     createdAt.UTC(),
+		FavoriteCount: favoriteCount,
+	}, nil
+}
+
+// ListAssets fetches all assets with pagination.
+// assetTypes and tag are optional filters; both may be combined. An asset
+// matches assetTypes if it has any of them; an empty slice is no filter.
+// sort is "popularity" (most favorited first) or anything else for newest first.
+// Returns (assets, totalCount, error)
+func (s *Storage) ListAssets(orgID string, limit int, offset int, assetTypes []string, tag *string, search *string, sort string) ([]*Asset, int, error) {
+	countQuery, countArgs, query, queryArgs := buildListAssetsQueries(orgID, limit, offset, assetTypes, tag, search, sort)
+
+	// Get total count
 	var total int
-	err := s.db.QueryRow(countQuery, queryArgs...).Scan(&total)
+	err := s.db.QueryRow(countQuery, countArgs...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Fetch page
-	queryArgs = append(queryArgs, limit, offset)
-	argCount := len(queryArgs) - 1
-	query := fmt.Sprintf(`
-		SELECT id, type, data
-		FROM assets%s
-		ORDER BY created_at DESC
-		LIMIT $%d OFFSET $%d
-	`, whereClause, argCount, argCount+1)
-
 	rows, err := s.db.Query(query, queryArgs...)
 	if err != nil {
 		return nil, 0, err
@@ -322,13 +1355,19 @@ func (s *Storage) ListAssets(limit int, offset int, assetType *string) ([]*Asset
 	for rows.Next() {
 		var id, assetType string
 		var dataStr string
-		if err := rows.Scan(&id, &assetType, &dataStr); err != nil {
+		var tags []string
+		var createdAt time.Time
+		var favoriteCount int
+		if err := rows.Scan(&id, &assetType, &dataStr, pq.Array(&tags), &createdAt, &favoriteCount); err != nil {
 			return nil, 0, err
 		}
 		assets = append(assets, &Asset{
-			ID:   id,
-			Type: assetType,
-			Data: json.RawMessage(dataStr),
+			ID:            id,
+			Type:          assetType,
+			Data:          json.RawMessage(dataStr),
+			Tags:          tags,
+			CreatedAt:     createdAt.UTC(),
+			FavoriteCount: favoriteCount,
 		})
 	}
 
@@ -339,11 +1378,65 @@ func (s *Storage) ListAssets(limit int, offset int, assetType *string) ([]*Asset
 	return assets, total, nil
 }
 
+// buildListAssetsQueries builds the count and page queries of ListAssets with
+// their arguments. Every placeholder is numbered from len(args) right after
+// its argument is appended, so numbering stays correct for any set of filters.
+// search matches words in the data's string values through the data_search GIN index.
+func buildListAssetsQueries(orgID string, limit int, offset int, assetTypes []string, tag *string, search *string, sort string) (string, []interface{}, string, []interface{}) {
+	conditions := []string{"a.organization_id = $1", "a.deleted_at IS NULL"}
+	args := []interface{}{orgID}
+	if len(assetTypes) > 0 {
+		args = append(args, pq.Array(assetTypes))
+		conditions = append(conditions, fmt.Sprintf("a.type = ANY($%d)", len(args)))
+	}
+	if tag != nil && *tag != "" {
+		args = append(args, *tag)
+		// Containment, unlike "= ANY(a.tags)", can use the idx_asset_tags GIN index
+		conditions = append(conditions, fmt.Sprintf("a.tags @> ARRAY[$%d]::text[]", len(args)))
+	}
+	if search != nil && *search != "" {
+		args = append(args, *search)
+		conditions = append(conditions, fmt.Sprintf("a.data_search @@ plainto_tsquery('english', $%d)", len(args)))
+	}
+
+	whereClause := " WHERE " + strings.Join(conditions, " AND ")
+
+	// The favorites join only affects ordering, so counting assets alone is enough
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM assets a%s", whereClause)
+	countArgs := args
+
+	// Copy so the count arguments aren't shared with the page arguments
+	pageArgs := append(append([]interface{}{}, args...), limit)
+	limitArg := len(pageArgs)
+	pageArgs = append(pageArgs, offset)
+	offsetArg := len(pageArgs)
+
+	query := fmt.Sprintf(`
+		SELECT a.id, a.type, a.data, a.tags, a.created_at, %s
+		FROM assets a%s
+		ORDER BY a.created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, favoriteCountColumn, whereClause, limitArg, offsetArg)
+	if sort == "popularity" {
+		// Removed favorites don't count; newest first breaks ties so paging is stable
+		query = fmt.Sprintf(`
+			SELECT a.id, a.type, a.data, a.tags, a.created_at, COUNT(f.id)
+			FROM assets a
+			LEFT JOIN favorites f ON a.id = f.asset_id AND f.deleted_at IS NULL%s
+			GROUP BY a.id
+			ORDER BY COUNT(f.id) DESC, a.created_at DESC
+			LIMIT $%d OFFSET $%d
+		`, whereClause, limitArg, offsetArg)
+	}
+
+	return countQuery, countArgs, query, pageArgs
+}
+
 // AssetExists checks if an asset exists. Used for validation.
-func (s *Storage) AssetExists(assetID string) (bool, error) {
-	query := "SELECT id FROM assets WHERE id = $1"
+func (s *Storage) AssetExists(orgID string, assetID string) (bool, error) {
+	query := "SELECT id FROM assets WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL"
 	var id string
-	err := s.db.QueryRow(query, assetID).Scan(&id)
+	err := s.db.QueryRow(query, assetID, orgID).Scan(&id)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -353,24 +1446,293 @@ func (s *Storage) AssetExists(assetID string) (bool, error) {
 	return true, nil
 }
 
-// DeleteAsset deletes an asset by ID.
-// Returns true if found and deleted, false if not found.
-func (s *Storage) DeleteAsset(assetID string) (bool, error) {
-	query := `
-		DELETE FROM assets
-		WHERE id = $1
-	`
-	result, err := s.db.Exec(query, assetID)
+// DeleteAsset soft-deletes an asset by ID, together with every active
+// favorite pointing to it, in one transaction.
+// Returns (found, favoritesRemoved, error).
+func (s *Storage) DeleteAsset(orgID string, assetID string) (bool, int, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return false, err
+		return false, 0, err
+	}
+	// Rollback is a no-op after a successful Commit
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE assets
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL
+	`, assetID, orgID)
+	if err != nil {
+		return false, 0, err
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return false, err
+		return false, 0, err
+	}
+	if rowsAffected == 0 {
+		return false, 0, nil
 	}
 
-	return rowsAffected > 0, nil
+	// Favorites may belong to other organizations when cross-org favorites are allowed
+	result, err = tx.Exec(`
+		UPDATE favorites
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE asset_id = $1 AND deleted_at IS NULL
+	`, assetID)
+	if err != nil {
+		return false, 0, err
+	}
+
+	favoritesRemoved, err := result.RowsAffected()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, err
+	}
+
+	s.recordAudit(orgID, "delete", "asset", assetID, "", map[string]interface{}{
+		"favorites_removed": favoritesRemoved,
+	})
+	return true, int(favoritesRemoved), nil
+}
+
+// BulkDeleteAssets soft-deletes the assets of assetIDs and their favorites in
+// one transaction. It returns the IDs that were deleted; the rest weren't found.
+func (s *Storage) BulkDeleteAssets(orgID string, assetIDs []string) ([]string, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	// Rollback is a no-op after a successful Commit
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE assets
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1) AND organization_id = $2 AND deleted_at IS NULL
+		RETURNING id
+	`, pq.Array(assetIDs), orgID)
+	if err != nil {
+		return nil, 0, err
+	}
+	deleted := make([]string, 0, len(assetIDs))
+	for rows.Next() {
+		var assetID string
+		if err := rows.Scan(&assetID); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		deleted = append(deleted, assetID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(deleted) == 0 {
+		return deleted, 0, nil
+	}
+
+	// Favorites may belong to other organizations when cross-org favorites are allowed
+	result, err := tx.Exec(`
+		UPDATE favorites
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE asset_id = ANY($1) AND deleted_at IS NULL
+	`, pq.Array(deleted))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	favoritesRemoved, err := result.RowsAffected()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+
+	for _, assetID := range deleted {
+		s.recordAudit(orgID, "delete", "asset", assetID, "", map[string]interface{}{
+			"bulk": true,
+		})
+	}
+	return deleted, int(favoritesRemoved), nil
+}
+
+// UpdateAssetDataTx replaces an asset's data within tx.
+// If the data changes, the previous data is copied into asset_versions first.
+// Callers lock the asset row (GetAssetForUpdateTx) so versions are numbered in order.
+// Returns false if the asset does not exist or is deleted.
+func (s *Storage) UpdateAssetDataTx(tx *sql.Tx, orgID string, assetID string, data json.RawMessage) (json.RawMessage, bool, error) {
+	_, err := tx.Exec(`
+		INSERT INTO asset_versions (asset_id, version, data)
+		SELECT a.id, COALESCE((SELECT MAX(v.version) FROM asset_versions v WHERE v.asset_id = a.id), 0) + 1, a.data
+		FROM assets a
+		WHERE a.id = $1 AND a.organization_id = $2 AND a.deleted_at IS NULL
+		  AND a.data IS DISTINCT FROM $3::jsonb
+	`, assetID, orgID, string(data))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The data is returned as JSONB prints it, which can differ from the
+	// request's bytes in key order and spacing; ETags are hashed over this
+	var stored string
+	err = tx.QueryRow(`
+		UPDATE assets
+		SET data = $1
+		WHERE id = $2 AND organization_id = $3 AND deleted_at IS NULL
+		RETURNING data
+	`, string(data), assetID, orgID).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.recordAuditIn(tx, orgID, "update", "asset", assetID, "", map[string]interface{}{
+		"data": data,
+	})
+	return json.RawMessage(stored), true, nil
+}
+
+// GetAssetVersions fetches the previous versions of an asset's data, newest first.
+// Returns (versions, found, error). found is false if the asset does not exist
+// or is deleted.
+func (s *Storage) GetAssetVersions(orgID string, assetID string) ([]*AssetVersion, bool, error) {
+	exists, err := s.AssetExists(orgID, assetID)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT version, data, created_at
+		FROM asset_versions
+		WHERE asset_id = $1
+		ORDER BY version DESC
+	`, assetID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	versions := []*AssetVersion{}
+	for rows.Next() {
+		version := &AssetVersion{}
+		var dataStr string
+		if err := rows.Scan(&version.Version, &dataStr, &version.CreatedAt); err != nil {
+			return nil, false, err
+		}
+		version.Data = json.RawMessage(dataStr)
+		versions = append(versions, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	return versions, true, nil
+}
+
+// GetAssetVersion fetches one previous version of an asset's data.
+// Returns nil if the asset or the version does not exist.
+func (s *Storage) GetAssetVersion(orgID string, assetID string, version int) (*AssetVersion, error) {
+	return getAssetVersion(s.db, orgID, assetID, version)
+}
+
+// GetAssetVersionTx is GetAssetVersion within tx.
+func (s *Storage) GetAssetVersionTx(tx *sql.Tx, orgID string, assetID string, version int) (*AssetVersion, error) {
+	return getAssetVersion(tx, orgID, assetID, version)
+}
+
+func getAssetVersion(q querier, orgID string, assetID string, version int) (*AssetVersion, error) {
+	result := &AssetVersion{}
+	var dataStr string
+	err := q.QueryRow(`
+		SELECT v.version, v.data, v.created_at
+		FROM asset_versions v
+		JOIN assets a ON a.id = v.asset_id
+		WHERE v.asset_id = $1 AND v.version = $2 AND a.organization_id = $3 AND a.deleted_at IS NULL
+	`, assetID, version, orgID).Scan(&result.Version, &dataStr, &result.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Data = json.RawMessage(dataStr)
+	return result, nil
+}
+
+// ============================================================================
+// ASSET TYPES
+// ============================================================================
+
+// ListAssetTypes fetches all asset types, oldest first.
+func (s *Storage) ListAssetTypes() ([]*AssetType, error) {
+	query := `
+		SELECT name, schema_json, created_at
+		FROM asset_types
+		ORDER BY created_at, name
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := []*AssetType{}
+	for rows.Next() {
+		assetType := &AssetType{}
+		var schema []byte
+		if err := rows.Scan(&assetType.Name, &schema, &assetType.CreatedAt); err != nil {
+			return nil, err
+		}
+		if schema != nil {
+			assetType.Schema = json.RawMessage(schema)
+		}
+		types = append(types, assetType)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return types, nil
+}
+
+// CreateAssetType adds a new asset type.
+// Returns nil if a type with that name already exists.
+func (s *Storage) CreateAssetType(orgID string, name string, schema json.RawMessage) (*AssetType, error) {
+	assetType := &AssetType{
+		Name:   name,
+		Schema: schema,
+	}
+	var schemaArg interface{}
+	if schema != nil {
+		schemaArg = string(schema)
+	}
+	query := `
+		INSERT INTO asset_types (name, schema_json)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING created_at
+	`
+	err := s.db.QueryRow(query, name, schemaArg).Scan(&assetType.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.recordAudit(orgID, "create", "asset_type", name, "", map[string]interface{}{
+		"schema_json": schema,
+	})
+	return assetType, nil
 }
 
 // ============================================================================
@@ -378,40 +1740,124 @@ func (s *Storage) DeleteAsset(assetID string) (bool, error) {
 // ============================================================================
 
 // AddToFavorites adds an asset to a user's favorites.
-// Returns the favorite ID or "" if already favorited.
+// Returns (favoriteID, restored, error). favoriteID is "" if the asset is
+// already an active favorite. restored is true when a previously soft-deleted
+// favorite was brought back instead of inserting a new row.
 // This uses a prepared statement automatically (sql.Exec handles this).
 func (s *Storage) AddToFavorites(
+	orgID string,
+	userID string,
+	assetID string,
+	descriptionOverride *string,
+	notes *string,
+) (string, bool, error) {
+	id, _, restored, err := s.addToFavorites(s.db, orgID, userID, assetID, descriptionOverride, notes, nil)
+	return id, restored, err
+}
+
+// AddToFavoritesTx is AddToFavorites within tx, also returning the stored added_at.
+// A non-nil addedAt is stored instead of the current time, as when importing.
+// The audit entry is only written if tx commits.
+func (s *Storage) AddToFavoritesTx(
+	tx *sql.Tx,
+	orgID string,
 	userID string,
 	assetID string,
 	descriptionOverride *string,
-) (string, error) {
+	notes *string,
+	addedAt *time.Time,
+) (string, time.Time, bool, error) {
+	return s.addToFavorites(tx, orgID, userID, assetID, descriptionOverride, notes, addedAt)
+}
+
+func (s *Storage) addToFavorites(
+	q querier,
+	orgID string,
+	userID string,
+	assetID string,
+	descriptionOverride *string,
+	notes *string,
+	addedAt *time.Time,
+) (string, time.Time, bool, error) {
 	favoriteID := uuid.New().String()
+	// A soft-deleted row for the same (user, asset) pair is revived in place.
+	// The WHERE on DO UPDATE leaves active rows untouched, so no row is
+	// returned when the asset is already favorited.
+	// xmax = 0 only for freshly inserted rows, which tells us insert vs restore.
 	query := `
-		INSERT INTO favorites (id, user_id, asset_id, description_override)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (user_id, asset_id) WHERE deleted_at IS NULL
-		DO NOTHING
+		INSERT INTO favorites (id, user_id, asset_id, description_override, notes, organization_id, added_at)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, CURRENT_TIMESTAMP))
+		ON CONFLICT (user_id, asset_id)
+		DO UPDATE SET
+			deleted_at = NULL,
+			description_override = EXCLUDED.description_override,
+			notes = EXCLUDED.notes,
+			added_at = EXCLUDED.added_at
+		WHERE favorites.deleted_at IS NOT NULL
+		RETURNING id, added_at, (xmax = 0) AS inserted
 	`
-	result, err := s.db.Exec(query, favoriteID, userID, assetID, descriptionOverride)
+	var id string
+	var stored time.Time
+	var inserted bool
+	err := q.QueryRow(query, favoriteID, userID, assetID, descriptionOverride, notes, orgID, addedAt).Scan(&id, &stored, &inserted)
+	if err == sql.ErrNoRows {
+		// Conflict with an active favorite: already exists
+		return "", time.Time{}, false, nil
+	}
 	if err != nil {
 		// Check if it's a foreign key constraint violation
-		return "", fmt.Errorf("failed to add favorite: %w", err)
+		return "", time.Time{}, false, fmt.Errorf("failed to add favorite: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return "", err
-	}
+	s.recordAuditIn(q, orgID, "create", "favorite", assetID, userID, map[string]interface{}{
+		"favorite_id":          id,
+		"description_override": descriptionOverride,
+		"restored":             !inserted,
+	})
+	return id, stored, !inserted, nil
+}
 
-	// If no rows affected, the favorite already exists
-	if rowsAffected == 0 {
-		return "", nil
+// GetFavorite fetches one active favorite by user and asset.
+// Returns nil if the asset isn't in the user's favorites.
+func (s *Storage) GetFavorite(orgID string, userID string, assetID string) (*Favorite, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE f.user_id = $1 AND f.asset_id = $2 AND f.organization_id = $3 AND f.deleted_at IS NULL
+	`, favoriteCountColumn)
+
+	favorite, err := scanFavorite(s.db.QueryRow(query, userID, assetID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return favoriteID, nil
+	return favorite, nil
 }
 
 // GetFavorites fetches paginated favorites for a user.
+// sort lists the fields to order by; empty means newest first, pinned
+// favorites first.
+// If before is set, only unpinned favorites that come after it, newest first,
+// are returned and the count is skipped (totalCount is -1). Cursor pages walk
+// (added_at, id), so favorites sharing an added_at aren't lost between pages;
+// the pinned favorites were already listed ahead of the page the cursor came from.
 // Returns (favorites, totalCount, error)
 //
 // This query uses indexes efficiently:
@@ -419,54 +1865,85 @@ func (s *Storage) AddToFavorites(
 // - deleted_at IS NULL filter is part of the index predicate
 // - JOIN to assets table is fast because asset_id is indexed
 func (s *Storage) GetFavorites(
+	orgID string,
 	userID string,
 	limit int,
 	offset int,
 	assetType *string,
+	sort []SortField,
+	before *FavoriteCursor,
 ) ([]*Favorite, int, error) {
 	// Build query dynamically based on filters
-	whereClause := "WHERE deleted_at IS NULL AND user_id = $1"
-	queryArgs := []interface{}{userID}
-	argCount := 2
+	// The asset may belong to another organization when cross-org favorites are allowed
+	whereClause := "WHERE f.deleted_at IS NULL AND f.user_id = $1 AND f.organization_id = $2"
+	queryArgs := []interface{}{userID, orgID}
+	argCount := 3
 
-	if assetType != nil && ValidAssetTypes[*assetType] {
+	if assetType != nil && *assetType != "" {
 		whereClause += fmt.Sprintf(" AND a.type = $%d", argCount)
 		queryArgs = append(queryArgs, *assetType)
 		argCount++
 	}
 
+	// Cursor pages continue after the last favorite the client has seen
+	if before != nil && before.ID != "" {
+		whereClause += fmt.Sprintf(" AND NOT f.is_pinned AND (f.added_at, f.id) < ($%d, $%d)", argCount, argCount+1)
+		queryArgs = append(queryArgs, before.AddedAt.UTC(), before.ID)
+		argCount += 2
+	} else if before != nil {
+		whereClause += fmt.Sprintf(" AND NOT f.is_pinned AND f.added_at < $%d", argCount)
+		queryArgs = append(queryArgs, before.AddedAt.UTC())
+		argCount++
+	}
+
 	// First, get the total count (needed for pagination metadata)
-	countQuery := fmt.Sprintf(`
-		SELECT COUNT(*)
-		FROM favorites f
-		JOIN assets a ON f.asset_id = a.id
-		%s
-	`, whereClause)
-	var total int
-	err := s.db.QueryRow(countQuery, queryArgs...).Scan(&total)
-	if err != nil {
-		return nil, 0, err
+	// Cursor pages skip it: infinite scroll has no use for page counts
+	total := -1
+	if before == nil {
+		countQuery := fmt.Sprintf(`
+			SELECT COUNT(*)
+			FROM favorites f
+			JOIN assets a ON f.asset_id = a.id
+			%s
+		`, whereClause)
+		err := s.db.QueryRow(countQuery, queryArgs...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
 	}
 
 	// Now fetch the actual page
-	// ORDER BY f.added_at DESC: newest favorites first
+	// ORDER BY f.added_at DESC, f.id DESC: newest favorites first, after any
+	// pinned ones, unless sort fields are given; the ID matches the cursor
 	// LIMIT $n OFFSET $n: pagination
+	orderBy := "f.added_at DESC, f.id DESC"
+	if len(sort) > 0 {
+		orderBy = favoriteOrderBy(sort)
+	} else if before == nil {
+		orderBy = "f.is_pinned DESC, CASE WHEN f.is_pinned THEN f.order_index END ASC, f.added_at DESC, f.id DESC"
+	}
 	queryArgs = append(queryArgs, limit, offset)
 	query := fmt.Sprintf(`
 		SELECT
 			f.id,
 			f.user_id,
 			f.description_override,
+			f.notes,
 			f.added_at,
+			f.order_index,
+			f.is_pinned,
 			a.id,
 			a.type,
-			a.data
+			a.data,
+			a.tags,
+			a.created_at,
+			%s
 		FROM favorites f
 		JOIN assets a ON f.asset_id = a.id
 		%s
-		ORDER BY f.added_at DESC
+		ORDER BY %s
 		LIMIT $%d OFFSET $%d
-	`, whereClause, argCount, argCount+1)
+	`, favoriteCountColumn, whereClause, orderBy, argCount, argCount+1)
 
 	rows, err := s.db.Query(query, queryArgs...)
 	if err != nil {
@@ -476,39 +1953,11 @@ func (s *Storage) GetFavorites(
 
 	var favorites []*Favorite
 	for rows.Next() {
-		var (
-			favID, userID, assetID, assetType string
-			descOverride                       *string
-			addedAt                            time.Time
-			dataStr                            string
-		)
-
-		err := rows.Scan(
-			&favID,
-			&userID,
-			&descOverride,
-			&addedAt,
-			&assetID,
-			&assetType,
-			&dataStr,
-		)
+		favorite, err := scanFavorite(rows)
 		if err != nil {
 			return nil, 0, err
 		}
-
-		fav := &Favorite{
-			ID:                  favID,
-			UserID:              userID,
-			DescriptionOverride: descOverride,
-			AddedAt:             addedAt,
-			Asset: &Asset{
-				ID:   assetID,
-				Type: assetType,
-				Data: json.RawMessage(dataStr),
-			},
-		}
-
-		favorites = append(favorites, fav)
+		favorites = append(favorites, favorite)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -518,504 +1967,7011 @@ func (s *Storage) GetFavorites(
 	return favorites, total, nil
 }
 
-// UpdateFavoriteDescription updates the description for a favorited asset.
-// Returns true if found and updated, false if not found.
-func (s *Storage) UpdateFavoriteDescription(
-	userID string,
-	assetID string,
-	description string,
-) (bool, error) {
-	query := `
-		UPDATE favorites
-		SET description_override = $1
-		WHERE user_id = $2 AND asset_id = $3 AND deleted_at IS NULL
-	`
-	result, err := s.db.Exec(query, description, userID, assetID)
-	if err != nil {
-		return false, err
+// favoriteOrderBy builds the ORDER BY clause of sort. Columns come from
+// FavoriteSortColumns only, so request input never reaches the SQL;
+// unknown fields are skipped. f.id always comes last, in the direction of
+// the last field, so rows that tie on every field keep a stable order and
+// offset pages neither repeat nor skip them.
+func favoriteOrderBy(sort []SortField) string {
+	var terms []string
+	direction := "DESC"
+	for _, field := range sort {
+		column, ok := FavoriteSortColumns[field.Field]
+		if !ok {
+			continue
+		}
+		direction = "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, column+" "+direction)
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
+	if len(terms) == 0 {
+		terms = append(terms, "f.added_at DESC")
 	}
-
-	return rowsAffected > 0, nil
+	return strings.Join(append(terms, "f.id "+direction), ", ")
 }
 
-// RemoveFromFavorites soft-deletes a favorite (marks as deleted, doesn't remove).
-// This preserves data for auditing and recovery.
-// Returns true if found and deleted, false if not found.
-func (s *Storage) RemoveFromFavorites(userID string, assetID string) (bool, error) {
-	query := `
-		UPDATE favorites
-		SET deleted_at = CURRENT_TIMESTAMP
-		WHERE user_id = $1 AND asset_id = $2 AND deleted_at IS NULL
-	`
-	result, err := s.db.Exec(query, userID, assetID)
-	if err != nil {
-		return false, err
+// favoriteKeyset builds the condition matching the favorites that come after
+// last in the order of favoriteOrderBy(sort), with placeholders numbered from
+// first. Keys sorted the same way compare as one row; mixed directions expand
+// to (c1 > $1) OR (c1 = $1 AND c2 < $2) OR ..., with < for descending keys.
+func favoriteKeyset(sort []SortField, last *Favorite, first int) (string, []interface{}) {
+	var columns []string
+	var descs []bool
+	var values []interface{}
+	for _, field := range sort {
+		column, ok := FavoriteSortColumns[field.Field]
+		if !ok {
+			continue
+		}
+		columns = append(columns, column)
+		descs = append(descs, field.Desc)
+		values = append(values, favoriteSortValue(field.Field, last))
 	}
+	if len(columns) == 0 {
+		columns = append(columns, "f.added_at")
+		descs = append(descs, true)
+		values = append(values, last.AddedAt.UTC())
+	}
+	columns = append(columns, "f.id")
+	descs = append(descs, descs[len(descs)-1])
+	values = append(values, last.ID)
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
+	operator := func(desc bool) string {
+		if desc {
+			return "<"
+		}
+		return ">"
+	}
+	placeholders := make([]string, len(columns))
+	mixed := false
+	for i := range columns {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+		mixed = mixed || descs[i] != descs[0]
+	}
+	if !mixed {
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator(descs[0]), strings.Join(placeholders, ", ")), values
 	}
 
-	return rowsAffected > 0, nil
+	branches := make([]string, len(columns))
+	for i := range columns {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = "+placeholders[j])
+		}
+		terms = append(terms, columns[i]+" "+operator(descs[i])+" "+placeholders[i])
+		branches[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", values
 }
 
-// ============================================================================
-// SERVICE LAYER - Business Logic
-// ============================================================================
-
-// Service orchestrates operations between HTTP handlers and storage.
-// This layer contains business logic and validation.
-type Service struct {
-	storage *Storage
+// favoriteSortValue returns the value of favorite in a FavoriteSortColumns field.
+func favoriteSortValue(field string, favorite *Favorite) interface{} {
+	switch field {
+	case "asset_type":
+		return favorite.Asset.Type
+	case "added_at":
+		return favorite.AddedAt.UTC()
+	case "order_index":
+		return favorite.OrderIndex
+	case "is_pinned":
+		return favorite.IsPinned
+	}
+	return nil
 }
 
-// NewService creates a new service.
-func NewService(storage *Storage) *Service {
-	return &Service{storage: storage}
-}
+// GetFavoritesAfter fetches up to limit of a user's favorites that come after
+// the favorite after, in the order of favoriteOrderBy(sort) (newest first
+// without sort fields), or the first ones if after is nil. after is the last
+// favorite of the previous page. Unlike offsets, the cursor seeks straight to
+// its position, so reading every favorite page by page costs the same for
+// the last page as for the first.
+func (s *Storage) GetFavoritesAfter(
+	orgID string,
+	userID string,
+	limit int,
+	assetType *string,
+	sort []SortField,
+	after *Favorite,
+) ([]*Favorite, error) {
+	conditions := []string{"f.deleted_at IS NULL", "f.user_id = $1", "f.organization_id = $2"}
+	args := []interface{}{userID, orgID}
+	if assetType != nil && *assetType != "" {
+		args = append(args, *assetType)
+		conditions = append(conditions, fmt.Sprintf("a.type = $%d", len(args)))
+	}
+	if after != nil {
+		condition, values := favoriteKeyset(sort, after, len(args)+1)
+		args = append(args, values...)
+		conditions = append(conditions, condition)
+	}
+	args = append(args, limit)
 
-// CreateUser creates a new user and returns the created user object.
-func (s *Service) CreateUser() (map[string]interface{}, error) {
-	userID := uuid.New().String()
-	err := s.storage.CreateUser(userID)
+	query := fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d
+	`, favoriteCountColumn, strings.Join(conditions, " AND "), favoriteOrderBy(sort), len(args))
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error creating user: %w", err)
+		return nil, err
 	}
-	return map[string]interface{}{
-		"id":         userID,
-		"created_at": time.Now().UTC(),
-	}, nil
-}
+	defer rows.Close()
 
-// ListUsers retrieves paginated user list.
-func (s *Service) ListUsers(page int, limit int) (map[string]interface{}, error) {
-	// Validate and constrain pagination
-	if limit < 1 {
-		limit = 1
+	favorites := []*Favorite{}
+	for rows.Next() {
+		favorite, err := scanFavorite(rows)
+		if err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, favorite)
 	}
-	if limit > MaxPageSize {
-		limit = MaxPageSize
+
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	if page < 1 {
-		page = 1
+
+	return favorites, nil
+}
+
+// SearchFavorites fetches the user's favorites whose description contains
+// query, case-insensitively, newest first.
+// Returns (favorites, totalCount, error)
+func (s *Storage) SearchFavorites(orgID string, userID string, query string, limit int, offset int) ([]*Favorite, int, error) {
+	// LIKE wildcards in the query match literally
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+	whereClause := `
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		  AND f.description_override ILIKE '%' || $3 || '%'
+	`
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM favorites f" + whereClause
+	err := s.db.QueryRow(countQuery, userID, orgID, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	offset := (page - 1) * limit
+	selectQuery := fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		%s
+		ORDER BY f.added_at DESC
+		LIMIT $4 OFFSET $5
+	`, favoriteCountColumn, whereClause)
 
-	// Fetch from storage
-	users, total, err := s.storage.ListUsers(limit, offset)
+	rows, err := s.db.Query(selectQuery, userID, orgID, pattern, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching users: %w", err)
+		return nil, 0, err
 	}
+	defer rows.Close()
 
-	// Transform to API format
-	userList := []map[string]interface{}{}
-	for _, u := range users {
-		userList = append(userList, map[string]interface{}{
-			"id":         u.ID,
-			"created_at": u.CreatedAt,
-		})
+	favorites := []*Favorite{}
+	for rows.Next() {
+		favorite, err := scanFavorite(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		favorites = append(favorites, favorite)
 	}
 
-	// Calculate pagination metadata
-	totalPages := (total + limit - 1) / limit
-	if totalPages == 0 {
-		totalPages = 1
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	return map[string]interface{}{
-		"users": userList,
-		"pagination": map[string]interface{}{
-			"page":        page,
-			"limit":       limit,
-			"total":       total,
-			"total_pages": totalPages,
-			"has_next":    page < totalPages,
-			"has_prev":    page > 1,
-		},
-	}, nil
+	return favorites, total, nil
 }
 
-// ============================================================================
-// USER MANAGEMENT - DELETE USER SERVICE METHOD
-// ============================================================================
+// GetRandomFavorite fetches one of the user's active favorites at random.
+// Returns nil if the user has no favorites.
+func (s *Storage) GetRandomFavorite(orgID string, userID string) (*Favorite, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		ORDER BY RANDOM()
+		LIMIT 1
+	`, favoriteCountColumn)
 
-// DeleteUser removes a user from the system.
-func (s *Service) DeleteUser(userID string) error {
-	// Check if user exists
-	exists, err := s.storage.UserExists(userID)
-	if err != nil {
-		return fmt.Errorf("error checking user: %w", err)
+	favorite, err := scanFavorite(s.db.QueryRow(query, userID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	if !exists {
-		return fmt.Errorf("user not found")
+	if err != nil {
+		return nil, err
 	}
 
-	// Delete user
-	_, err = s.storage.DeleteUser(userID)
+	return favorite, nil
+}
+
+// GetFavoriteAssetTypes fetches the distinct asset types among the user's
+// active favorites, in alphabetical order.
+func (s *Storage) GetFavoriteAssetTypes(orgID string, userID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT a.type
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		ORDER BY a.type
+	`
+
+	rows, err := s.db.Query(query, userID, orgID)
 	if err != nil {
-		return fmt.Errorf("error deleting user: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	types := []string{}
+	for rows.Next() {
+		var assetType string
+		if err := rows.Scan(&assetType); err != nil {
+			return nil, err
+		}
+		types = append(types, assetType)
+	}
+
+	return types, rows.Err()
 }
 
-// ============================================================================
-// ASSET MANAGEMENT - CREATE, LIST, DELETE ASSET SERVICE METHODS
-// ============================================================================
+// GetUserFavoriteStats computes FavoriteStats over the user's active favorites
+// in a single query; the most used type comes from a subquery.
+func (s *Storage) GetUserFavoriteStats(orgID string, userID string) (*FavoriteStats, error) {
+	query := `
+		SELECT
+			COUNT(*),
+			MIN(f.added_at),
+			MAX(f.added_at),
+			(
+				SELECT a.type
+				FROM favorites f2
+				JOIN assets a ON f2.asset_id = a.id
+				WHERE f2.user_id = $1 AND f2.organization_id = $2 AND f2.deleted_at IS NULL
+				GROUP BY a.type
+				ORDER BY COUNT(*) DESC, a.type
+				LIMIT 1
+			)
+		FROM favorites f
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+	`
 
-// CreateAsset creates a new asset in the system.
-func (s *Service) CreateAsset(assetType string, data json.RawMessage) (map[string]interface{}, error) {
-	// Validate asset type
-	if !ValidAssetTypes[assetType] {
-		return nil, fmt.Errorf("invalid asset type")
+	// MIN, MAX and the subquery are NULL when the user has no favorites
+	var stats FavoriteStats
+	err := s.db.QueryRow(query, userID, orgID).Scan(&stats.TotalFavorites, &stats.OldestFavorite, &stats.NewestFavorite, &stats.MostUsedType)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create asset
-	assetID, err := s.storage.CreateAsset(assetType, data)
+	if stats.OldestFavorite != nil {
+		oldest := stats.OldestFavorite.UTC()
+		newest := stats.NewestFavorite.UTC()
+		stats.OldestFavorite, stats.NewestFavorite = &oldest, &newest
+	}
+	return &stats, nil
+}
+
+// CountFavoritesByType counts the user's active favorites of each asset type.
+// Types without favorites are omitted.
+func (s *Storage) CountFavoritesByType(orgID string, userID string) (map[string]int, error) {
+	query := `
+		SELECT a.type, COUNT(*)
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		GROUP BY a.type
+	`
+
+	rows, err := s.db.Query(query, userID, orgID)
 	if err != nil {
-		return nil, fmt.Errorf("error creating asset: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	return map[string]interface{}{
-		"id":   assetID,
-		"type": assetType,
-		"data": json.RawMessage(data),
-	}, nil
+	counts := make(map[string]int)
+	for rows.Next() {
+		var assetType string
+		var count int
+		if err := rows.Scan(&assetType, &count); err != nil {
+			return nil, err
+		}
+		counts[assetType] = count
+	}
+
+	return counts, rows.Err()
 }
 
-// ListAssets retrieves paginated asset list.
-func (s *Service) ListAssets(page int, limit int, assetType *string) (map[string]interface{}, error) {
-	// Validate and constrain pagination
-	if limit < 1 {
-		limit = 1
+// GetFavoritesTimeline fetches the user's favorites added in the last days
+// days, grouped by the day they were added, newest day first. Each day
+// lists at most perDay favorites, newest first, but counts all of them.
+// Days without favorites are omitted.
+func (s *Storage) GetFavoritesTimeline(orgID string, userID string, days int, perDay int) ([]*TimelineDay, error) {
+	// The window functions rank and count each day's favorites before the
+	// rest of the day is cut, so the page size doesn't depend on busy days
+	query := fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s,
+			f.day,
+			f.day_count
+		FROM (
+			SELECT
+				f.*,
+				DATE_TRUNC('day', f.added_at, 'UTC') AS day,
+				ROW_NUMBER() OVER (PARTITION BY DATE_TRUNC('day', f.added_at, 'UTC') ORDER BY f.added_at DESC, f.id DESC) AS day_rank,
+				COUNT(*) OVER (PARTITION BY DATE_TRUNC('day', f.added_at, 'UTC')) AS day_count
+			FROM favorites f
+			WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+			  AND f.added_at >= DATE_TRUNC('day', CURRENT_TIMESTAMP, 'UTC') - $3 * INTERVAL '1 day'
+		) f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE f.day_rank <= $4
+		ORDER BY f.added_at DESC, f.id DESC
+	`, favoriteCountColumn)
+
+	// Today counts as one of the days
+	rows, err := s.db.Query(query, userID, orgID, days-1, perDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeline := []*TimelineDay{}
+	for rows.Next() {
+		var day time.Time
+		var dayCount int
+		favorite, err := scanFavorite(rows, &day, &dayCount)
+		if err != nil {
+			return nil, err
+		}
+
+		// Rows arrive newest first, so a new day always starts a new entry
+		date := day.UTC().Format("2006-01-02")
+		if len(timeline) == 0 || timeline[len(timeline)-1].Date != date {
+			timeline = append(timeline, &TimelineDay{Date: date, Count: dayCount, Favorites: []*Favorite{}})
+		}
+		entry := timeline[len(timeline)-1]
+		entry.Favorites = append(entry.Favorites, favorite)
 	}
-	if limit > MaxPageSize {
-		limit = MaxPageSize
+
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	if page < 1 {
-		page = 1
+
+	return timeline, nil
+}
+
+// GetFavoriteCalendarData counts the user's active favorites added on each
+// day of year, keyed by YYYY-MM-DD. Days without favorites are omitted.
+func (s *Storage) GetFavoriteCalendarData(orgID string, userID string, year int) (map[string]int, error) {
+	// Days are UTC days, so the year's bounds are UTC too
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+
+	query := `
+		SELECT DATE_TRUNC('day', f.added_at, 'UTC') AS day, COUNT(*)
+		FROM favorites f
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		  AND f.added_at >= $3 AND f.added_at < $4
+		GROUP BY day
+	`
+
+	rows, err := s.db.Query(query, userID, orgID, start, end)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Validate asset type if provided
-	if assetType != nil && *assetType != "" && !ValidAssetTypes[*assetType] {
-		return nil, fmt.Errorf("invalid asset type")
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day.UTC().Format("2006-01-02")] = count
 	}
 
-	offset := (page - 1) * limit
+	return counts, rows.Err()
+}
 
-	// Fetch from storage
-	assets, total, err := s.storage.ListAssets(limit, offset, assetType)
+// GetRecommendedAssets recommends assets by collaborative filtering:
+// the RecommendationNeighbors users sharing the most favorites with userID
+// are found, and their favorites that userID doesn't have are returned,
+// best first. An asset favorited by several neighbors scores the sum of
+// their overlaps.
+func (s *Storage) GetRecommendedAssets(orgID string, userID string, limit int) ([]*Asset, error) {
+	query := fmt.Sprintf(`
+		WITH mine AS (
+			SELECT asset_id FROM favorites
+			WHERE user_id = $1 AND organization_id = $2 AND deleted_at IS NULL
+		),
+		neighbors AS (
+			SELECT f.user_id, COUNT(*) AS overlap
+			FROM favorites f
+			JOIN mine m ON f.asset_id = m.asset_id
+			WHERE f.user_id <> $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+			GROUP BY f.user_id
+			ORDER BY overlap DESC, f.user_id
+			LIMIT $3
+		),
+		candidates AS (
+			SELECT f.asset_id, SUM(n.overlap) AS score
+			FROM favorites f
+			JOIN neighbors n ON f.user_id = n.user_id
+			WHERE f.deleted_at IS NULL
+			  AND f.asset_id NOT IN (SELECT asset_id FROM mine)
+			GROUP BY f.asset_id
+		)
+		SELECT a.id, a.type, a.data, a.tags, a.created_at, %s
+		FROM candidates c
+		JOIN assets a ON a.id = c.asset_id
+		ORDER BY c.score DESC, a.created_at DESC
+		LIMIT $4
+	`, favoriteCountColumn)
+
+	rows, err := s.db.Query(query, userID, orgID, RecommendationNeighbors, limit)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching assets: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Transform to API format
-	assetList := []map[string]interface{}{}
-	for _, a := range assets {
-		assetList = append(assetList, map[string]interface{}{
-			"id":   a.ID,
-			"type": a.Type,
-			"data": a.Data,
+	assets := []*Asset{}
+	for rows.Next() {
+		var id, assetType string
+		var dataStr string
+		var tags []string
+		var createdAt time.Time
+		var favoriteCount int
+		if err := rows.Scan(&id, &assetType, &dataStr, pq.Array(&tags), &createdAt, &favoriteCount); err != nil {
+			return nil, err
+		}
+		assets = append(assets, &Asset{
+			ID:            id,
+			Type:          assetType,
+			Data:          json.RawMessage(dataStr),
+			Tags:          tags,
+			CreatedAt:     createdAt.UTC(),
+			FavoriteCount: favoriteCount,
 		})
 	}
 
-	// Calculate pagination metadata
-	totalPages := (total + limit - 1) / limit
-	if totalPages == 0 {
-		totalPages = 1
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return map[string]interface{}{
-		"assets": assetList,
-		"pagination": map[string]interface{}{
-			"page":        page,
-			"limit":       limit,
-			"total":       total,
-			"total_pages": totalPages,
-			"has_next":    page < totalPages,
-			"has_prev":    page > 1,
-		},
-	}, nil
+	return assets, nil
 }
 
-// DeleteAsset removes an asset from the system.
-func (s *Service) DeleteAsset(assetID string) error {
-	// Check if asset exists
-	exists, err := s.storage.AssetExists(assetID)
+// GetCommonFavorites fetches the assets both users have in their active
+// favorites, newest asset first.
+func (s *Storage) GetCommonFavorites(orgID string, userID1 string, userID2 string) ([]*Asset, error) {
+	query := fmt.Sprintf(`
+		WITH common AS (
+			SELECT asset_id FROM favorites
+			WHERE user_id = $1 AND organization_id = $3 AND deleted_at IS NULL
+			INTERSECT
+			SELECT asset_id FROM favorites
+			WHERE user_id = $2 AND organization_id = $3 AND deleted_at IS NULL
+		)
+		SELECT a.id, a.type, a.data, a.tags, a.created_at, %s
+		FROM common c
+		JOIN assets a ON a.id = c.asset_id
+		WHERE a.deleted_at IS NULL
+		ORDER BY a.created_at DESC
+	`, favoriteCountColumn)
+
+	rows, err := s.db.Query(query, userID1, userID2, orgID)
 	if err != nil {
-		return fmt.Errorf("error checking asset: %w", err)
+		return nil, err
 	}
-	if !exists {
-		return fmt.Errorf("asset not found")
+	defer rows.Close()
+
+	assets := []*Asset{}
+	for rows.Next() {
+		var id, assetType string
+		var dataStr string
+		var tags []string
+		var createdAt time.Time
+		var favoriteCount int
+		if err := rows.Scan(&id, &assetType, &dataStr, pq.Array(&tags), &createdAt, &favoriteCount); err != nil {
+			return nil, err
+		}
+		assets = append(assets, &Asset{
+			ID:            id,
+			Type:          assetType,
+			Data:          json.RawMessage(dataStr),
+			Tags:          tags,
+			CreatedAt:     createdAt.UTC(),
+			FavoriteCount: favoriteCount,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+// GetTrendingAssets returns the organization's assets favorited most in the
+// last hours hours, highest score first. Favorites removed since don't count.
+func (s *Storage) GetTrendingAssets(orgID string, hours int, limit int) ([]*TrendingAsset, error) {
+	query := fmt.Sprintf(`
+		SELECT a.id, a.type, a.data, a.tags, a.created_at, %s, t.score
+		FROM (
+			SELECT f.asset_id, COUNT(f.id) AS score
+			FROM favorites f
+			WHERE f.organization_id = $1
+			  AND f.added_at > CURRENT_TIMESTAMP - INTERVAL '1 hour' * $2
+			  AND f.deleted_at IS NULL
+			GROUP BY f.asset_id
+		) t
+		JOIN assets a ON a.id = t.asset_id
+		WHERE a.organization_id = $1 AND a.deleted_at IS NULL
+		ORDER BY t.score DESC, a.created_at DESC
+		LIMIT $3
+	`, favoriteCountColumn)
+
+	rows, err := s.db.Query(query, orgID, hours, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trending := []*TrendingAsset{}
+	for rows.Next() {
+		var id, assetType string
+		var dataStr string
+		var tags []string
+		var createdAt time.Time
+		var favoriteCount, score int
+		if err := rows.Scan(&id, &assetType, &dataStr, pq.Array(&tags), &createdAt, &favoriteCount, &score); err != nil {
+			return nil, err
+		}
+		trending = append(trending, &TrendingAsset{
+			Asset: &Asset{
+				ID:            id,
+				Type:          assetType,
+				Data:          json.RawMessage(dataStr),
+				Tags:          tags,
+				CreatedAt:     createdAt.UTC(),
+				FavoriteCount: favoriteCount,
+			},
+			Score: score,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return trending, nil
+}
+
+// GetFavoritesByType fetches a user's favorites grouped by asset type,
+// newest first, with at most perGroup favorites per type.
+// One query ranks favorites within each type; grouping happens here.
+func (s *Storage) GetFavoritesByType(orgID string, userID string, perGroup int) (map[string][]*Favorite, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, description_override, notes, added_at, order_index, is_pinned, asset_id, type, data, tags, created_at, favorite_count
+		FROM (
+			SELECT
+				f.id,
+				f.user_id,
+				f.description_override,
+				f.notes,
+				f.added_at,
+				f.order_index,
+				f.is_pinned,
+				a.id AS asset_id,
+				a.type,
+				a.data,
+				a.tags,
+				a.created_at,
+				%s AS favorite_count,
+				ROW_NUMBER() OVER (PARTITION BY a.type ORDER BY f.added_at DESC) AS group_rank
+			FROM favorites f
+			JOIN assets a ON f.asset_id = a.id
+			WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		) ranked
+		WHERE group_rank <= $3
+		ORDER BY added_at DESC
+	`, favoriteCountColumn)
+
+	rows, err := s.db.Query(query, userID, orgID, perGroup)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[string][]*Favorite)
+	for rows.Next() {
+		favorite, err := scanFavorite(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups[favorite.Asset.Type] = append(groups[favorite.Asset.Type], favorite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// GetMostRecentFavoritePerType fetches the user's newest favorite of each
+// asset type, keyed by type. Types the user hasn't favorited are absent.
+func (s *Storage) GetMostRecentFavoritePerType(orgID string, userID string) (map[string]*Favorite, error) {
+	query := fmt.Sprintf(`
+		SELECT DISTINCT ON (a.type)
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		WHERE f.user_id = $1 AND f.organization_id = $2 AND f.deleted_at IS NULL
+		ORDER BY a.type, f.added_at DESC
+	`, favoriteCountColumn)
+
+	rows, err := s.db.Query(query, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[string]*Favorite)
+	for rows.Next() {
+		favorite, err := scanFavorite(rows)
+		if err != nil {
+			return nil, err
+		}
+		latest[favorite.Asset.Type] = favorite
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+// UpdateFavoriteDescription updates the description for a favorited asset.
+// The previous description is copied into favorite_description_history in the
+// same transaction so the change log never diverges from the favorite itself.
+// Returns true if found and updated, false if not found.
+func (s *Storage) UpdateFavoriteDescription(
+	orgID string,
+	userID string,
+	assetID string,
+	description string,
+) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	// Rollback is a no-op after a successful Commit
+	defer tx.Rollback()
+
+	// Lock the row so concurrent updates record history in order
+	var favoriteID string
+	var previous *string
+	err = tx.QueryRow(`
+		SELECT id, description_override
+		FROM favorites
+		WHERE user_id = $1 AND asset_id = $2 AND organization_id = $3 AND deleted_at IS NULL
+		FOR UPDATE
+	`, userID, assetID, orgID).Scan(&favoriteID, &previous)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO favorite_description_history (id, favorite_id, description)
+		VALUES ($1, $2, $3)
+	`, uuid.New().String(), favoriteID, previous)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE favorites
+		SET description_override = $1
+		WHERE id = $2
+	`, description, favoriteID)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	s.recordAudit(orgID, "update", "favorite", assetID, userID, map[string]interface{}{
+		"favorite_id":          favoriteID,
+		"description_override": description,
+		"previous":             previous,
+	})
+	return true, nil
+}
+
+// UpdateFavoriteNotes sets or, with nil, clears the private notes of a favorite.
+// Returns true if found and updated, false if not found.
+func (s *Storage) UpdateFavoriteNotes(orgID string, userID string, assetID string, notes *string) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE favorites
+		SET notes = $1
+		WHERE user_id = $2 AND asset_id = $3 AND organization_id = $4 AND deleted_at IS NULL
+	`, notes, userID, assetID, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	// Notes are private, so only whether they were set is audited
+	s.recordAudit(orgID, "update", "favorite", assetID, userID, map[string]interface{}{
+		"notes_set": notes != nil,
+	})
+	return true, nil
+}
+
+// SetFavoritePinned pins or unpins a favorite.
+// Returns true if found and updated, false if not found.
+func (s *Storage) SetFavoritePinned(orgID string, userID string, assetID string, pinned bool) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE favorites
+		SET is_pinned = $1
+		WHERE user_id = $2 AND asset_id = $3 AND organization_id = $4 AND deleted_at IS NULL
+	`, pinned, userID, assetID, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	s.recordAudit(orgID, "update", "favorite", assetID, userID, map[string]interface{}{
+		"is_pinned": pinned,
+	})
+	return true, nil
+}
+
+// GetDescriptionHistory fetches past descriptions of a favorite, newest first.
+// Returns (history, found, error). found is false if the asset is not an
+// active favorite of the user.
+func (s *Storage) GetDescriptionHistory(orgID string, userID string, assetID string) ([]*DescriptionChange, bool, error) {
+	var favoriteID string
+	err := s.db.QueryRow(`
+		SELECT id
+		FROM favorites
+		WHERE user_id = $1 AND asset_id = $2 AND organization_id = $3 AND deleted_at IS NULL
+	`, userID, assetID, orgID).Scan(&favoriteID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `
+		SELECT id, description, changed_at
+		FROM favorite_description_history
+		WHERE favorite_id = $1
+		ORDER BY changed_at DESC
+	`
+	rows, err := s.db.Query(query, favoriteID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	history := []*DescriptionChange{}
+	for rows.Next() {
+		change := &DescriptionChange{}
+		if err := rows.Scan(&change.ID, &change.Description, &change.ChangedAt); err != nil {
+			return nil, false, err
+		}
+		history = append(history, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	return history, true, nil
+}
+
+// ReorderFavorites sets order_index for each listed favorite in one transaction.
+// Returns false, changing nothing, if any asset isn't in the user's active favorites.
+func (s *Storage) ReorderFavorites(orgID string, userID string, order []FavoriteOrder) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	// Rollback is a no-op after a successful Commit
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		UPDATE favorites
+		SET order_index = $1
+		WHERE user_id = $2 AND asset_id = $3 AND organization_id = $4 AND deleted_at IS NULL
+	`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	for _, item := range order {
+		result, err := stmt.Exec(item.OrderIndex, userID, item.AssetID, orgID)
+		if err != nil {
+			return false, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if rowsAffected == 0 {
+			return false, nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	s.recordAudit(orgID, "update", "favorite", "", userID, map[string]interface{}{
+		"order": order,
+	})
+	return true, nil
+}
+
+// FavoriteExists reports whether the asset is in the user's active favorites.
+// Served by idx_user_favorite_unique without touching assets.
+func (s *Storage) FavoriteExists(orgID string, userID string, assetID string) (bool, error) {
+	query := `
+		SELECT 1 FROM favorites
+		WHERE user_id = $1 AND asset_id = $2 AND organization_id = $3 AND deleted_at IS NULL
+		LIMIT 1
+	`
+	var one int
+	err := s.db.QueryRow(query, userID, assetID, orgID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckFavorites reports which of assetIDs are in the user's active favorites.
+// Only favorited IDs are returned (mapped to true); callers fill in the rest.
+func (s *Storage) CheckFavorites(orgID string, userID string, assetIDs []string) (map[string]bool, error) {
+	query := `
+		SELECT asset_id FROM favorites
+		WHERE user_id = $1 AND organization_id = $2 AND asset_id = ANY($3) AND deleted_at IS NULL
+	`
+	rows, err := s.db.Query(query, userID, orgID, pq.Array(assetIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorited := make(map[string]bool)
+	for rows.Next() {
+		var assetID string
+		if err := rows.Scan(&assetID); err != nil {
+			return nil, err
+		}
+		favorited[assetID] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return favorited, nil
+}
+
+// RemoveFromFavorites soft-deletes a favorite (marks as deleted, doesn't remove).
+// This preserves data for auditing and recovery.
+// Returns true if found and deleted, false if not found.
+func (s *Storage) RemoveFromFavorites(orgID string, userID string, assetID string) (bool, error) {
+	query := `
+		UPDATE favorites
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND asset_id = $2 AND organization_id = $3 AND deleted_at IS NULL
+	`
+	result, err := s.db.Exec(query, userID, assetID, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		s.recordAudit(orgID, "delete", "favorite", assetID, userID, nil)
+	}
+	return rowsAffected > 0, nil
+}
+
+// RestoreFavorite undoes RemoveFromFavorites for a favorite removed after
+// removedAfter, keeping its description, notes and original added_at.
+// Favorites of deleted assets stay removed.
+// Returns false if there is no such removed favorite.
+func (s *Storage) RestoreFavorite(orgID string, userID string, assetID string, removedAfter time.Time) (bool, error) {
+	query := `
+		UPDATE favorites
+		SET deleted_at = NULL
+		WHERE user_id = $1 AND asset_id = $2 AND organization_id = $3
+		  AND deleted_at IS NOT NULL AND deleted_at > $4
+		  AND asset_id IN (SELECT id FROM assets WHERE deleted_at IS NULL)
+	`
+	result, err := s.db.Exec(query, userID, assetID, orgID, removedAfter)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		// Audited like AddToFavorites reviving a removed favorite
+		s.recordAudit(orgID, "create", "favorite", assetID, userID, map[string]interface{}{
+			"restored": true,
+		})
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetDeletedFavorites lists favorites removed after removedAfter, most
+// recently removed first: the ones RestoreFavorite can still bring back.
+// Returns (favorites, totalCount, error)
+func (s *Storage) GetDeletedFavorites(orgID string, userID string, removedAfter time.Time, limit int, offset int) ([]*Favorite, int, error) {
+	whereClause := `
+		WHERE f.user_id = $1 AND f.organization_id = $2
+		  AND f.deleted_at IS NOT NULL AND f.deleted_at > $3
+		  AND a.deleted_at IS NULL
+	`
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM favorites f JOIN assets a ON f.asset_id = a.id" + whereClause
+	err := s.db.QueryRow(countQuery, userID, orgID, removedAfter).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	selectQuery := fmt.Sprintf(`
+		SELECT
+			f.id,
+			f.user_id,
+			f.description_override,
+			f.notes,
+			f.added_at,
+			f.order_index,
+			f.is_pinned,
+			a.id,
+			a.type,
+			a.data,
+			a.tags,
+			a.created_at,
+			%s,
+			f.deleted_at
+		FROM favorites f
+		JOIN assets a ON f.asset_id = a.id
+		%s
+		ORDER BY f.deleted_at DESC
+		LIMIT $4 OFFSET $5
+	`, favoriteCountColumn, whereClause)
+
+	rows, err := s.db.Query(selectQuery, userID, orgID, removedAfter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	favorites := []*Favorite{}
+	for rows.Next() {
+		var deletedAt time.Time
+		favorite, err := scanFavorite(rows, &deletedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		favorite.IsDeleted = true
+		favorite.DeletedAt = &deletedAt
+		favorites = append(favorites, favorite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return favorites, total, nil
+}
+
+// RemoveAllFavorites soft-deletes every active favorite of a user in one statement.
+// Returns the number of favorites removed.
+func (s *Storage) RemoveAllFavorites(orgID string, userID string) (int, error) {
+	query := `
+		UPDATE favorites
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND organization_id = $2 AND deleted_at IS NULL
+	`
+	result, err := s.db.Exec(query, userID, orgID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if rowsAffected > 0 {
+		s.recordAudit(orgID, "delete", "favorite", "", userID, map[string]interface{}{
+			"removed": rowsAffected,
+		})
+	}
+	return int(rowsAffected), nil
+}
+
+// PurgeDeletedFavorites permanently deletes favorites of every organization
+// removed more than olderThan ago. Their description history goes with them.
+// Returns the number of favorites purged.
+func (s *Storage) PurgeDeletedFavorites(olderThan time.Duration) (int, error) {
+	// Same cutoff as RestoreFavorite, so nothing restorable is purged
+	query := "DELETE FROM favorites WHERE deleted_at IS NOT NULL AND deleted_at < $1"
+	result, err := s.db.Exec(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// PurgeDeletedAssets permanently deletes assets of every organization
+// deleted more than olderThan ago, with their versions. Assets still
+// referenced by a favorite, even a removed one, are kept until
+// PurgeDeletedFavorites has purged it.
+// Returns the number of assets purged.
+func (s *Storage) PurgeDeletedAssets(olderThan time.Duration) (int, error) {
+	query := `
+		DELETE FROM assets a
+		WHERE a.deleted_at IS NOT NULL AND a.deleted_at < $1
+		  AND NOT EXISTS (SELECT 1 FROM favorites f WHERE f.asset_id = a.id)
+	`
+	result, err := s.db.Exec(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// Janitor purges favorites removed longer ago than favoriteRetention and
+// assets deleted longer ago than assetRetention. Past FavoriteRestoreWindow
+// removed favorites can't be restored, so they only take up space.
+type Janitor struct {
+	storage           Store
+	favoriteRetention time.Duration
+	assetRetention    time.Duration
+}
+
+// NewJanitor creates a Janitor with the given retentions.
+func NewJanitor(storage Store, favoriteRetention time.Duration, assetRetention time.Duration) *Janitor {
+	return &Janitor{storage: storage, favoriteRetention: favoriteRetention, assetRetention: assetRetention}
+}
+
+// Run purges on every tick of interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.purge()
+		}
+	}
+}
+
+// purge runs one purge, logging rather than returning its outcome.
+// Favorites go first: an asset is only purged once no favorite points to it.
+func (j *Janitor) purge() {
+	favorites, err := j.storage.PurgeDeletedFavorites(j.favoriteRetention)
+	if err != nil {
+		log.Printf("Error purging removed favorites: %v", err)
+		return
+	}
+	assets, err := j.storage.PurgeDeletedAssets(j.assetRetention)
+	if err != nil {
+		log.Printf("Error purging deleted assets: %v", err)
+		return
+	}
+	log.Printf("Purged %d removed favorites and %d deleted assets", favorites, assets)
+}
+
+// Heartbeat counts ticks from a background goroutine. If the count stops
+// advancing, the process is wedged (deadlocked, or starved of goroutines)
+// and should be restarted. It is safe for concurrent use.
+type Heartbeat struct {
+	mu       sync.RWMutex
+	beats    int64
+	lastBeat time.Time
+}
+
+// NewHeartbeat creates a Heartbeat that counts as fresh until its first tick.
+func NewHeartbeat() *Heartbeat {
+	return &Heartbeat{lastBeat: time.Now()}
+}
+
+// Run ticks every interval until ctx is done.
+func (hb *Heartbeat) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.beat()
+		}
+	}
+}
+
+// beat advances the counter.
+func (hb *Heartbeat) beat() {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.beats++
+	hb.lastBeat = time.Now()
+}
+
+// Alive reports the number of ticks so far, and whether the counter
+// advanced within maxAge.
+func (hb *Heartbeat) Alive(maxAge time.Duration) (int64, bool) {
+	hb.mu.RLock()
+	defer hb.mu.RUnlock()
+	return hb.beats, time.Since(hb.lastBeat) <= maxAge
+}
+
+// ============================================================================
+// WEBHOOKS
+// ============================================================================
+
+// CreateWebhook registers a webhook for a user and returns it.
+func (s *Storage) CreateWebhook(orgID string, userID string, url string, secret string) (*Webhook, error) {
+	webhook := &Webhook{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		URL:    url,
+		Secret: secret,
+	}
+	query := `
+		INSERT INTO webhooks (id, user_id, url, secret)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	err := s.db.QueryRow(query, webhook.ID, userID, url, secret).Scan(&webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.recordAudit(orgID, "create", "webhook", webhook.ID, userID, map[string]interface{}{
+		"url": url,
+	})
+	return webhook, nil
+}
+
+// ListWebhooks fetches all webhooks registered by a user, oldest first.
+func (s *Storage) ListWebhooks(userID string) ([]*Webhook, error) {
+	query := `
+		SELECT id, user_id, url, secret, created_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		webhook := &Webhook{}
+		if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a user's webhook.
+// Returns true if found and deleted, false if not found.
+func (s *Storage) DeleteWebhook(orgID string, userID string, webhookID string) (bool, error) {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND user_id = $2
+	`
+	result, err := s.db.Exec(query, webhookID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		s.recordAudit(orgID, "delete", "webhook", webhookID, userID, nil)
+	}
+	return rowsAffected > 0, nil
+}
+
+// ============================================================================
+// API KEYS
+// ============================================================================
+
+// CreateAPIKey stores a new API key hash for a user.
+func (s *Storage) CreateAPIKey(orgID string, userID string, keyHash string, rateLimitRPS int, expiresAt *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		KeyHash:      keyHash,
+		RateLimitRPS: rateLimitRPS,
+		ExpiresAt:    expiresAt,
+	}
+	query := `
+		INSERT INTO api_keys (id, key_hash, user_id, rate_limit_rps, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	err := s.db.QueryRow(query, key.ID, keyHash, userID, rateLimitRPS, expiresAt).Scan(&key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.recordAudit(orgID, "create", "api_key", key.ID, userID, map[string]interface{}{
+		"rate_limit_rps": rateLimitRPS,
+		"expires_at":     expiresAt,
+	})
+	return key, nil
+}
+
+// GetAPIKeyByHash fetches an API key, with its user's organization, by the
+// SHA-256 of its value. Returns nil if not found. Expiry is left to the caller.
+func (s *Storage) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	query := `
+		SELECT k.id, k.key_hash, k.user_id, u.organization_id, k.rate_limit_rps, k.created_at, k.expires_at
+		FROM api_keys k
+		JOIN users u ON k.user_id = u.id
+		WHERE k.key_hash = $1
+	`
+	key := &APIKey{}
+	err := s.db.QueryRow(query, keyHash).Scan(
+		&key.ID,
+		&key.KeyHash,
+		&key.UserID,
+		&key.OrganizationID,
+		&key.RateLimitRPS,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListAPIKeys fetches the API keys of an organization's users, newest first.
+func (s *Storage) ListAPIKeys(orgID string) ([]*APIKey, error) {
+	query := `
+		SELECT k.id, k.key_hash, k.user_id, k.rate_limit_rps, k.created_at, k.expires_at
+		FROM api_keys k
+		JOIN users u ON k.user_id = u.id
+		WHERE u.organization_id = $1
+		ORDER BY k.created_at DESC
+	`
+	rows, err := s.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key := &APIKey{}
+		err := rows.Scan(
+			&key.ID,
+			&key.KeyHash,
+			&key.UserID,
+			&key.RateLimitRPS,
+			&key.CreatedAt,
+			&key.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey revokes an API key belonging to a user of the organization.
+// Returns true if found and deleted, false if not found.
+func (s *Storage) DeleteAPIKey(orgID string, keyID string) (bool, error) {
+	query := `
+		DELETE FROM api_keys k
+		USING users u
+		WHERE k.user_id = u.id AND u.organization_id = $1 AND k.id = $2
+	`
+	result, err := s.db.Exec(query, orgID, keyID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected > 0 {
+		s.recordAudit(orgID, "delete", "api_key", keyID, "", nil)
+	}
+	return rowsAffected > 0, nil
+}
+
+// ============================================================================
+// SHARE TOKENS
+// ============================================================================
+
+// CreateShareToken stores a new share token for a user.
+func (s *Storage) CreateShareToken(orgID string, userID string, token string, expiresAt time.Time) (*ShareToken, error) {
+	share := &ShareToken{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	query := `
+		INSERT INTO share_tokens (token, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`
+	err := s.db.QueryRow(query, token, userID, expiresAt).Scan(&share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.recordAudit(orgID, "create", "share_token", token, userID, map[string]interface{}{
+		"expires_at": expiresAt,
+	})
+	return share, nil
+}
+
+// GetShareToken fetches a share token with its user's organization. Returns nil if not found.
+// Expiry is left to the caller so it can tell expired links from unknown ones.
+func (s *Storage) GetShareToken(token string) (*ShareToken, error) {
+	query := `
+		SELECT t.token, t.user_id, u.organization_id, t.created_at, t.expires_at
+		FROM share_tokens t
+		JOIN users u ON t.user_id = u.id
+		WHERE t.token = $1
+	`
+	share := &ShareToken{}
+	err := s.db.QueryRow(query, token).Scan(
+		&share.Token,
+		&share.UserID,
+		&share.OrgID,
+		&share.CreatedAt,
+		&share.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// ============================================================================
+// AUDIT LOG
+// ============================================================================
+
+// AuditLogger writes audit entries to the audit_log table from a single
+// background goroutine, so mutations never wait on the audit insert.
+// If the buffer is full the entry is dropped and logged rather than blocking.
+//
+// A nil *AuditLogger is valid and discards everything.
+type AuditLogger struct {
+	db      *sql.DB
+	entries chan *AuditEntry
+	done    chan struct{}
+}
+
+// NewAuditLogger starts the background writer.
+func NewAuditLogger(db *sql.DB, bufferSize int) *AuditLogger {
+	l := &AuditLogger{
+		db:      db,
+		entries: make(chan *AuditEntry, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Record queues an entry without blocking.
+func (l *AuditLogger) Record(entry *AuditEntry) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.entries <- entry:
+	default:
+		log.Printf("Audit log buffer full, dropping %s %s %v", entry.Operation, entry.EntityType, entry.EntityID)
+	}
+}
+
+// Close stops accepting entries and waits for queued ones to be written.
+// Record must not be called after Close.
+func (l *AuditLogger) Close() {
+	if l == nil {
+		return
+	}
+	close(l.entries)
+	<-l.done
+}
+
+func (l *AuditLogger) run() {
+	defer close(l.done)
+	query := `
+		INSERT INTO audit_log (id, organization_id, operation, entity_type, entity_id, user_id, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for entry := range l.entries {
+		var payload interface{}
+		if entry.Payload != nil {
+			payload = string(entry.Payload)
+		}
+		_, err := l.db.Exec(query, entry.ID, entry.OrganizationID, entry.Operation, entry.EntityType, entry.EntityID, entry.UserID, payload, entry.CreatedAt)
+		if err != nil {
+			log.Printf("Error writing audit entry %s: %v", entry.ID, err)
+		}
+	}
+}
+
+// recordAudit queues an audit entry for a successful mutation in orgID.
+// Empty entityID or userID are stored as NULL; payload may be nil.
+func (s *Storage) recordAudit(orgID string, operation string, entityType string, entityID string, userID string, payload interface{}) {
+	s.auditLog.Record(newAuditEntry(orgID, operation, entityType, entityID, userID, payload))
+}
+
+// recordAuditIn is recordAudit for a mutation made through q. Within a
+// transaction the entry is held back until WithTransaction commits it.
+func (s *Storage) recordAuditIn(q querier, orgID string, operation string, entityType string, entityID string, userID string, payload interface{}) {
+	tx, ok := q.(*sql.Tx)
+	if !ok {
+		s.recordAudit(orgID, operation, entityType, entityID, userID, payload)
+		return
+	}
+
+	s.txAuditMu.Lock()
+	defer s.txAuditMu.Unlock()
+	if s.txAudit == nil {
+		s.txAudit = make(map[*sql.Tx][]*AuditEntry)
+	}
+	s.txAudit[tx] = append(s.txAudit[tx], newAuditEntry(orgID, operation, entityType, entityID, userID, payload))
+}
+
+// newAuditEntry builds the audit entry recorded by recordAudit.
+func newAuditEntry(orgID string, operation string, entityType string, entityID string, userID string, payload interface{}) *AuditEntry {
+	entry := &AuditEntry{
+		ID:             uuid.New().String(),
+		OrganizationID: orgID,
+		Operation:      operation,
+		EntityType:     entityType,
+		CreatedAt:      time.Now(),
+	}
+	if entityID != "" {
+		entry.EntityID = &entityID
+	}
+	if userID != "" {
+		entry.UserID = &userID
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Error encoding audit payload: %v", err)
+		} else {
+			entry.Payload = data
+		}
+	}
+	return entry
+}
+
+// ListAuditLog fetches the organization's audit entries, newest first, with pagination.
+// Returns (entries, totalCount, error)
+func (s *Storage) ListAuditLog(orgID string, limit int, offset int) ([]*AuditEntry, int, error) {
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE organization_id = $1", orgID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, operation, entity_type, entity_id, user_id, payload, created_at
+		FROM audit_log
+		WHERE organization_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := s.db.Query(query, orgID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		entry := &AuditEntry{}
+		var payload []byte
+		err := rows.Scan(
+			&entry.ID,
+			&entry.Operation,
+			&entry.EntityType,
+			&entry.EntityID,
+			&entry.UserID,
+			&payload,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		if payload != nil {
+			entry.Payload = json.RawMessage(payload)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// GetUserActivity fetches the audit entries of one user of the organization, newest first.
+// Returns (events, totalCount, error)
+func (s *Storage) GetUserActivity(orgID string, userID string, limit int, offset int) ([]*AuditEvent, int, error) {
+	var total int
+	countQuery := "SELECT COUNT(*) FROM audit_log WHERE organization_id = $1 AND user_id = $2"
+	if err := s.db.QueryRow(countQuery, orgID, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT operation, entity_type, entity_id, created_at
+		FROM audit_log
+		WHERE organization_id = $1 AND user_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.Query(query, orgID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		var operation, entityType string
+		var entityID *string
+		event := &AuditEvent{}
+		if err := rows.Scan(&operation, &entityType, &entityID, &event.Timestamp); err != nil {
+			return nil, 0, err
+		}
+		event.Action = auditAction(operation, entityType)
+		// For favorites, entity_id is the asset ID
+		if entityType == "asset" || entityType == "favorite" {
+			event.AssetID = entityID
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// ============================================================================
+// REQUEST METRICS
+// ============================================================================
+
+// MetricsRecorder writes request metrics to the request_metrics table from a
+// single background goroutine, so responses never wait on the insert.
+// If the buffer is full the metric is dropped rather than blocking.
+//
+// A nil *MetricsRecorder is valid and discards everything.
+type MetricsRecorder struct {
+	db      *sql.DB
+	metrics chan *RequestMetric
+	done    chan struct{}
+}
+
+// NewMetricsRecorder starts the background writer.
+func NewMetricsRecorder(db *sql.DB, bufferSize int) *MetricsRecorder {
+	m := &MetricsRecorder{
+		db:      db,
+		metrics: make(chan *RequestMetric, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Record queues a metric without blocking.
+func (m *MetricsRecorder) Record(metric *RequestMetric) {
+	if m == nil {
+		return
+	}
+	select {
+	case m.metrics <- metric:
+	default:
+		log.Printf("Request metrics buffer full, dropping %s %s", metric.Method, metric.Endpoint)
+	}
+}
+
+// Close stops accepting metrics and waits for queued ones to be written.
+// Record must not be called after Close.
+func (m *MetricsRecorder) Close() {
+	if m == nil {
+		return
+	}
+	close(m.metrics)
+	<-m.done
+}
+
+func (m *MetricsRecorder) run() {
+	defer close(m.done)
+	query := `
+		INSERT INTO request_metrics (endpoint, method, status_code, duration_ms, recorded_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	for metric := range m.metrics {
+		_, err := m.db.Exec(query, metric.Endpoint, metric.Method, metric.StatusCode, metric.DurationMS, metric.RecordedAt)
+		if err != nil {
+			log.Printf("Error writing request metric for %s %s: %v", metric.Method, metric.Endpoint, err)
+		}
+	}
+}
+
+// RecordRequestMetric queues a metric for a completed request.
+func (s *Storage) RecordRequestMetric(metric *RequestMetric) {
+	s.metrics.Record(metric)
+}
+
+// GetEndpointSLOs computes latency percentiles per endpoint and method over
+// the requests of the last hours hours, ordered by endpoint then method.
+func (s *Storage) GetEndpointSLOs(hours int) ([]*EndpointSLO, error) {
+	query := `
+		SELECT
+			endpoint,
+			method,
+			COUNT(*),
+			percentile_cont(0.50) WITHIN GROUP (ORDER BY duration_ms),
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY duration_ms),
+			percentile_cont(0.99) WITHIN GROUP (ORDER BY duration_ms)
+		FROM request_metrics
+		WHERE recorded_at >= $1
+		GROUP BY endpoint, method
+		ORDER BY endpoint, method
+	`
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+	rows, err := s.db.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slos := []*EndpointSLO{}
+	for rows.Next() {
+		slo := &EndpointSLO{}
+		if err := rows.Scan(&slo.Endpoint, &slo.Method, &slo.Requests, &slo.P50MS, &slo.P95MS, &slo.P99MS); err != nil {
+			return nil, err
+		}
+		slos = append(slos, slo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return slos, nil
+}
+
+// DeleteOldRequestMetrics removes request metrics recorded more than maxAge ago.
+// Returns the number of rows removed.
+func (s *Storage) DeleteOldRequestMetrics(maxAge time.Duration) (int, error) {
+	query := "DELETE FROM request_metrics WHERE recorded_at < $1"
+	result, err := s.db.Exec(query, time.Now().UTC().Add(-maxAge))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// cleanupRequestMetrics deletes request metrics older than the longest SLO
+// window on every tick until ctx is done.
+func cleanupRequestMetrics(ctx context.Context, storage *Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		removed, err := storage.DeleteOldRequestMetrics(MaxSLOWindowHours * time.Hour)
+		if err != nil {
+			log.Printf("Error cleaning up request metrics: %v", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d old request metrics", removed)
+		}
+	}
+}
+
+// ============================================================================
+// IDEMPOTENCY KEYS
+// ============================================================================
+
+// GetIdempotentResponse fetches the stored response for a user's idempotency key.
+// Returns nil if the key is unknown or older than IdempotencyKeyTTL.
+func (s *Storage) GetIdempotentResponse(userID string, key string) (*IdempotentResponse, error) {
+	query := `
+		SELECT status_code, response_body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND created_at > $3
+	`
+	resp := &IdempotentResponse{}
+	cutoff := time.Now().UTC().Add(-IdempotencyKeyTTL)
+	err := s.db.QueryRow(query, userID, key, cutoff).Scan(&resp.StatusCode, &resp.Body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SaveIdempotentResponse stores the response produced for a user's idempotency key.
+// If two requests with the same key race, the first one stored wins.
+func (s *Storage) SaveIdempotentResponse(userID string, key string, statusCode int, body []byte) error {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, status_code, response_body, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`
+	_, err := s.db.Exec(query, userID, key, statusCode, body, time.Now().UTC())
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than ttl.
+// Returns the number of keys removed.
+func (s *Storage) DeleteExpiredIdempotencyKeys(ttl time.Duration) (int, error) {
+	query := "DELETE FROM idempotency_keys WHERE created_at < $1"
+	result, err := s.db.Exec(query, time.Now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// cleanupIdempotencyKeys deletes expired idempotency keys on every tick
+// until ctx is done.
+func cleanupIdempotencyKeys(ctx context.Context, storage *Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		removed, err := storage.DeleteExpiredIdempotencyKeys(IdempotencyKeyTTL)
+		if err != nil {
+			log.Printf("Error cleaning up idempotency keys: %v", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d expired idempotency keys", removed)
+		}
+	}
+}
+
+// ============================================================================
+// PUB/SUB - In-process event broker
+// ============================================================================
+
+// Event types published when a user's favorites change.
+const (
+	EventFavoriteAdded    = "favorite_added"
+	EventFavoriteRemoved  = "favorite_removed"
+	EventFavoritesCleared = "favorites_cleared"
+)
+
+// Event describes a change to a user's favorites.
+type Event struct {
+	Type      string    `json:"type"`
+	UserID    string    `json:"user_id"`
+	AssetID   string    `json:"asset_id,omitempty"`
+	Favorite  *Favorite `json:"favorite,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// subscription is one listener for a single user's events.
+type subscription struct {
+	userID string
+	ch     chan Event
+}
+
+// Broker fans out events to subscribers within this process.
+// Subscribers on other instances behind a load balancer won't see the event;
+// a shared broker (e.g. Postgres LISTEN/NOTIFY) would be needed for that.
+//
+// A nil *Broker is valid and drops everything, so a Service without one still works.
+type Broker struct {
+	subscribers sync.Map // subscription ID -> *subscription
+}
+
+// NewBroker creates an empty broker.
+func NewBroker() *Broker {
+	return &Broker{}
+}
+
+// Subscribe registers a listener for userID's events.
+// Returns the subscription ID (for Unsubscribe) and the event channel.
+func (b *Broker) Subscribe(userID string) (string, <-chan Event) {
+	id := uuid.New().String()
+	sub := &subscription{userID: userID, ch: make(chan Event, StreamBufferSize)}
+	b.subscribers.Store(id, sub)
+	return id, sub.ch
+}
+
+// Unsubscribe removes a listener. The channel is left open so a concurrent
+// Publish can never send on a closed channel; it is garbage collected.
+func (b *Broker) Unsubscribe(id string) {
+	b.subscribers.Delete(id)
+}
+
+// Publish delivers an event to all of the user's subscribers.
+// Slow subscribers whose buffer is full miss the event rather than blocking the caller.
+func (b *Broker) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.subscribers.Range(func(_, value interface{}) bool {
+		sub := value.(*subscription)
+		if sub.userID != event.UserID {
+			return true
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			log.Printf("Dropping %s event for slow subscriber of user %s", event.Type, event.UserID)
+		}
+		return true
+	})
+}
+
+// ============================================================================
+// WEBHOOK DISPATCH
+// ============================================================================
+
+// WebhookDispatcher POSTs favorite events to the user's registered webhooks.
+// Deliveries run in background goroutines so request latency is unaffected.
+//
+// A nil *WebhookDispatcher is valid and does nothing.
+type WebhookDispatcher struct {
+	storage *Storage
+	client  *http.Client
+}
+
+// NewWebhookDispatcher creates a dispatcher that looks up webhooks in storage.
+// Webhook URLs are chosen by users, so like download URLs they may only
+// reach public addresses, and proxy settings are ignored.
+func NewWebhookDispatcher(storage *Storage) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		storage: storage,
+		client: &http.Client{
+			Timeout:   WebhookTimeout,
+			Transport: &http.Transport{DialContext: newPublicDialer(WebhookTimeout).DialContext},
+		},
+	}
+}
+
+// Dispatch sends the event to every webhook of event.UserID in the background.
+func (d *WebhookDispatcher) Dispatch(event Event) {
+	if d == nil {
+		return
+	}
+
+	go func() {
+		webhooks, err := d.storage.ListWebhooks(event.UserID)
+		if err != nil {
+			log.Printf("Error loading webhooks for user %s: %v", event.UserID, err)
+			return
+		}
+		if len(webhooks) == 0 {
+			return
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Error encoding webhook payload: %v", err)
+			return
+		}
+
+		for _, webhook := range webhooks {
+			go d.deliver(webhook, payload)
+		}
+	}()
+}
+
+// deliver POSTs the payload to one webhook, retrying with exponential
+// backoff (1s, 2s, 4s) on network errors and non-2xx responses.
+func (d *WebhookDispatcher) deliver(webhook *Webhook, payload []byte) {
+	signature := signPayload(webhook.Secret, payload)
+	backoff := WebhookInitialBackoff
+
+	for attempt := 0; attempt <= WebhookMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("Webhook %s: invalid request: %v", webhook.ID, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Signature", signature)
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			log.Printf("Webhook %s: attempt %d failed: %v", webhook.ID, attempt+1, err)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return
+		}
+		log.Printf("Webhook %s: attempt %d got status %d", webhook.ID, attempt+1, resp.StatusCode)
+	}
+
+	log.Printf("Webhook %s: giving up after %d retries", webhook.ID, WebhookMaxRetries)
+}
+
+// ============================================================================
+// ASSET DOWNLOADS
+// ============================================================================
+
+// defaultDownloadClient fetches the download_url of chart assets.
+var defaultDownloadClient = newDownloadClient()
+
+// newDownloadClient creates a client for download URLs. They come from asset
+// data that any caller can write, so connections to loopback, private and
+// link-local addresses are refused, redirects included, and proxy settings
+// are ignored. The timeout covers connecting and waiting for the response
+// headers; streaming the body is bounded by DownloadMaxDuration instead.
+func newDownloadClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           newPublicDialer(DownloadTimeout).DialContext,
+			TLSHandshakeTimeout:   DownloadTimeout,
+			ResponseHeaderTimeout: DownloadTimeout,
+		},
+	}
+}
+
+// newPublicDialer creates a dialer that refuses to connect to addresses that
+// aren't public. The check runs on the resolved address of every connection,
+// so hostnames resolving to private addresses and redirects are covered too.
+func newPublicDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("connecting to %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicIP reports whether ip is routable on the internet.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsMulticast()
+}
+
+// isHTTPURL reports whether raw is an absolute http or https URL.
+func isHTTPURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// signPayload returns the hex-encoded HMAC-SHA256 of payload keyed by secret.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ============================================================================
+// CACHE
+// ============================================================================
+
+// Cache stores serialized query results.
+// Keys are ":"-separated paths; Invalidate(key) also drops every key under it,
+// so "favorites:<userID>" clears all cached pages of that user's favorites.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Invalidate(key string)
+}
+
+type cacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryCache is a Cache local to this process.
+// With several instances, a write on one instance does not invalidate the
+// others, so readers elsewhere may see results up to the TTL old.
+type MemoryCache struct {
+	entries sync.Map // key -> *cacheEntry
+}
+
+// NewMemoryCache creates an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{}
+}
+
+// Get returns the value for key if present and not expired.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	value, ok := c.entries.Load(key)
+	if !ok {
+		return nil, false
+	}
+	entry := value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.entries.Delete(key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set stores value under key for ttl.
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.entries.Store(key, &cacheEntry{value: value, expiresAt: time.Now().Add(ttl)})
+}
+
+// Invalidate removes key and every key beneath it.
+func (c *MemoryCache) Invalidate(key string) {
+	prefix := key + ":"
+	c.entries.Range(func(k, _ interface{}) bool {
+		if k == key || strings.HasPrefix(k.(string), prefix) {
+			c.entries.Delete(k)
+		}
+		return true
+	})
+}
+
+// DeleteExpired removes expired entries that were never read again.
+func (c *MemoryCache) DeleteExpired() {
+	now := time.Now()
+	c.entries.Range(func(k, value interface{}) bool {
+		if now.After(value.(*cacheEntry).expiresAt) {
+			c.entries.Delete(k)
+		}
+		return true
+	})
+}
+
+// sweepCache periodically drops expired cache entries until ctx is done.
+func sweepCache(ctx context.Context, cache *MemoryCache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cache.DeleteExpired()
+		}
+	}
+}
+
+// ============================================================================
+// SERVICE LAYER - Business Logic
+// ============================================================================
+
+// Errors returned by Service methods, possibly wrapped. Handlers map them to
+// status codes with errors.Is; their messages are sent to clients as is.
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrAssetNotFound       = errors.New("asset not found")
+	ErrAlreadyFavorited    = errors.New("asset already in favorites")
+	ErrAssetNotInFavorites = errors.New("asset not in user's favorites")
+	ErrVersionNotFound     = errors.New("asset version not found")
+	ErrLimitExceeded       = errors.New("limit exceeds maximum")
+	ErrNoFavorites         = errors.New("user has no favorites")
+	ErrNoRemovedFavorite   = errors.New("no removed favorite to restore")
+	ErrDuplicateAssetID    = errors.New("duplicate asset_id")
+	ErrTooManyAssetIDs     = errors.New("too many asset_ids")
+	ErrNoAssetIDs          = errors.New("no asset_ids to delete")
+	ErrSearchQueryRequired = errors.New("search query is required")
+
+	// Users
+	ErrDisplayNameTooLong = fmt.Errorf("display_name must be at most %d characters", MaxDisplayNameLength)
+	ErrEmailTooLong       = fmt.Errorf("email must be at most %d characters", MaxEmailLength)
+	ErrInvalidEmail       = errors.New("email is not a valid address")
+
+	// Assets and asset types
+	ErrInvalidAssetType     = errors.New("invalid asset type")
+	ErrInvalidAssetData     = errors.New("invalid asset data")
+	ErrAssetDataRequired    = errors.New("data is required")
+	ErrNoAssets             = errors.New("no assets to create")
+	ErrTooManyAssets        = errors.New("too many assets")
+	ErrInvalidPatch         = errors.New("invalid patch")
+	ErrETagMismatch         = errors.New("etag mismatch")
+	ErrInvalidAssetTypeName = errors.New("invalid asset type name")
+	ErrInvalidSchemaJSON    = errors.New("invalid schema_json")
+	ErrAssetTypeExists      = errors.New("asset type already exists")
+
+	// Type-specific asset views; the asset exists but can't be shown that way
+	ErrNotAChart              = errors.New("asset is not a chart")
+	ErrNotAnInsight           = errors.New("asset is not an insight")
+	ErrNotAnAudience          = errors.New("asset is not an audience")
+	ErrInvalidChartData       = errors.New("invalid chart data")
+	ErrInsightHasNoText       = errors.New("insight has no text")
+	ErrAudienceHasNoSize      = errors.New("audience has no size")
+	ErrAudienceSizeNotInteger = errors.New("audience size is not an integer")
+	ErrNoDownloadURL          = errors.New("chart has no download_url")
+	ErrInvalidDownloadURL     = errors.New("chart download_url is not an http or https URL")
+	ErrDownloadFailed         = errors.New("download failed")
+
+	// Sorting and query parameters
+	ErrInvalidSort          = errors.New("invalid sort")
+	ErrInvalidOrder         = errors.New("invalid order")
+	ErrOrderWithoutSort     = errors.New("order requires sort fields")
+	ErrSortOrderMismatch    = errors.New("sort and order must have the same number of values")
+	ErrBeforeRequiresNewest = errors.New("before requires sort=newest")
+	ErrInvalidYear          = fmt.Errorf("year must be between %d and %d", MinCalendarYear, MaxCalendarYear)
+	ErrInvalidTrendingHours = fmt.Errorf("hours must be between 1 and %d", MaxTrendingHours)
+	ErrInvalidSLOHours      = fmt.Errorf("hours must be between 1 and %d", MaxSLOWindowHours)
+
+	// Sharing, webhooks and API keys
+	ErrShareLinkNotFound = errors.New("share link not found")
+	ErrShareLinkExpired  = errors.New("share link expired")
+	ErrInvalidWebhookURL = errors.New("invalid webhook url")
+	ErrWebhookNotFound   = errors.New("webhook not found")
+	ErrInvalidRateLimit  = errors.New("invalid rate limit")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+)
+
+// Service orchestrates operations between HTTP handlers and storage.
+// This layer contains business logic and validation.
+type Service struct {
+	storage  Store
+	broker   *Broker            // notified after favorites change; may be nil
+	webhooks *WebhookDispatcher // notified after favorites change; may be nil
+	cache    Cache              // caches GetFavorites pages; may be nil
+
+	// allowCrossOrgAssets lets users favorite assets of other organizations.
+	allowCrossOrgAssets bool
+
+	// loosePagination clamps limit to the maximum instead of rejecting it (deprecated).
+	loosePagination bool
+
+	// maxPageSize is the largest limit of list methods; zero means MaxPageSize.
+	maxPageSize int
+
+	// downloadClient fetches chart download URLs; nil means defaultDownloadClient.
+	downloadClient *http.Client
+}
+
+// NewService creates a new service.
+func NewService(storage Store, broker *Broker, webhooks *WebhookDispatcher, cache Cache, allowCrossOrgAssets bool, loosePagination bool, maxPageSize int) *Service {
+	return &Service{
+		storage:             storage,
+		broker:              broker,
+		webhooks:            webhooks,
+		cache:               cache,
+		allowCrossOrgAssets: allowCrossOrgAssets,
+		loosePagination:     loosePagination,
+		maxPageSize:         maxPageSize,
+	}
+}
+
+// maxLimit returns the largest limit list methods accept.
+func (s *Service) maxLimit() int {
+	if s.maxPageSize > 0 {
+		return s.maxPageSize
+	}
+	return MaxPageSize
+}
+
+// clampLimit raises a page size below 1 to 1. Above maxLimit it returns
+// ErrLimitExceeded, or maxLimit when loose pagination is enabled.
+func (s *Service) clampLimit(limit int) (int, error) {
+	if limit < 1 {
+		return 1, nil
+	}
+	if limit > s.maxLimit() {
+		if !s.loosePagination {
+			return 0, fmt.Errorf("%w of %d", ErrLimitExceeded, s.maxLimit())
+		}
+		return s.maxLimit(), nil
+	}
+	return limit, nil
+}
+
+func (s *Service) downloads() *http.Client {
+	if s.downloadClient != nil {
+		return s.downloadClient
+	}
+	return defaultDownloadClient
+}
+
+// favoritesCacheKey is the cache key under which all of a user's favorites pages live.
+func favoritesCacheKey(userID string) string {
+	return "favorites:" + userID
+}
+
+// invalidateFavorites drops cached favorites pages for a user.
+// An empty userID drops them for every user.
+func (s *Service) invalidateFavorites(userID string) {
+	if s.cache == nil {
+		return
+	}
+	if userID == "" {
+		s.cache.Invalidate("favorites")
+		return
+	}
+	s.cache.Invalidate(favoritesCacheKey(userID))
+}
+
+// notify tells stream subscribers and webhooks about a favorites change.
+func (s *Service) notify(event Event) {
+	s.broker.Publish(event)
+	s.webhooks.Dispatch(event)
+}
+
+// CreateUser creates a new user and returns the created user object.
+func (s *Service) CreateUser(orgID string) (map[string]interface{}, error) {
+	userID := uuid.New().String()
+	err := s.storage.CreateUser(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating user: %w", err)
+	}
+	return map[string]interface{}{
+		"id":         userID,
+		"created_at": time.Now().UTC(),
+	}, nil
+}
+
+// ListUsers retrieves paginated user list.
+func (s *Service) ListUsers(orgID string, page int, limit int) (map[string]interface{}, error) {
+	// Validate and constrain pagination
+	limit, err := s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+
+	// Fetch from storage
+	users, total, err := s.storage.ListUsers(orgID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %w", err)
+	}
+
+	// Transform to API format
+	userList := []map[string]interface{}{}
+	for _, u := range users {
+		userList = append(userList, map[string]interface{}{
+			"id":           u.ID,
+			"created_at":   u.CreatedAt,
+			"display_name": u.DisplayName,
+		})
+	}
+
+	return map[string]interface{}{
+		"users":      userList,
+		"pagination": newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// GetUser retrieves a single user.
+func (s *Service) GetUser(orgID string, userID string) (map[string]interface{}, error) {
+	user, err := s.storage.GetUser(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return map[string]interface{}{
+		"id":           user.ID,
+		"created_at":   user.CreatedAt,
+		"display_name": user.DisplayName,
+		"email":        user.Email,
+	}, nil
+}
+
+// SearchUsers finds users by display name or email, paginated.
+func (s *Service) SearchUsers(orgID string, query string, page int, limit int) (map[string]interface{}, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrSearchQueryRequired
+	}
+
+	// Validate and constrain pagination
+	limit, err := s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+
+	users, total, err := s.storage.SearchUsers(orgID, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error searching users: %w", err)
+	}
+
+	return map[string]interface{}{
+		"users":      users,
+		"pagination": newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// UpdateUser replaces a user's display name and email.
+// nil or "" clears a field; the email must be a bare address such as alice@example.com.
+func (s *Service) UpdateUser(orgID string, userID string, displayName *string, email *string) (*UserRecord, error) {
+	if displayName != nil {
+		trimmed := strings.TrimSpace(*displayName)
+		displayName = &trimmed
+		if trimmed == "" {
+			displayName = nil
+		} else if utf8.RuneCountInString(trimmed) > MaxDisplayNameLength {
+			return nil, ErrDisplayNameTooLong
+		}
+	}
+	if email != nil {
+		trimmed := strings.TrimSpace(*email)
+		email = &trimmed
+		if trimmed == "" {
+			email = nil
+		} else if len(trimmed) > MaxEmailLength {
+			return nil, ErrEmailTooLong
+		} else if addr, err := mail.ParseAddress(trimmed); err != nil || addr.Address != trimmed {
+			return nil, ErrInvalidEmail
+		}
+	}
+
+	user, err := s.storage.UpdateUser(orgID, userID, displayName, email)
+	if err != nil {
+		return nil, fmt.Errorf("error updating user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ============================================================================
+// USER MANAGEMENT - DELETE USER SERVICE METHOD
+// ============================================================================
+
+// DeleteUser removes a user from the system.
+func (s *Service) DeleteUser(orgID string, userID string) error {
+	// Check if user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	// Delete user; it may have been removed since the check above
+	found, err := s.storage.DeleteUser(orgID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	s.invalidateFavorites(userID)
+
+	return nil
+}
+
+// ============================================================================
+// ASSET MANAGEMENT - CREATE, LIST, DELETE ASSET SERVICE METHODS
+// ============================================================================
+
+// CreateAsset creates a new asset in the system.
+func (s *Service) CreateAsset(orgID string, assetType string, data json.RawMessage, tags []string) (map[string]interface{}, error) {
+	// Validate asset type
+	if !ValidAssetTypes.IsValid(assetType) {
+		return nil, ErrInvalidAssetType
+	}
+
+	// Tags are optional; store an empty array rather than NULL
+	if tags == nil {
+		tags = []string{}
+	}
+
+	// Create asset
+	assetID, err := s.storage.CreateAsset(orgID, assetType, data, tags)
+	if err != nil {
+		return nil, fmt.Errorf("error creating asset: %w", err)
+	}
+
+	return map[string]interface{}{
+		"id":   assetID,
+		"type": assetType,
+		"data": json.RawMessage(data),
+		"tags": tags,
+	}, nil
+}
+
+// BulkCreateAssets validates and creates up to MaxBulkAssets assets at once.
+// An invalid item rejects the whole batch; the error names its index.
+func (s *Service) BulkCreateAssets(orgID string, items []BulkAssetInput) ([]string, error) {
+	if len(items) == 0 {
+		return nil, ErrNoAssets
+	}
+	if len(items) > MaxBulkAssets {
+		return nil, ErrTooManyAssets
+	}
+
+	for i := range items {
+		if !ValidAssetTypes.IsValid(items[i].Type) {
+			return nil, fmt.Errorf("%w at index %d", ErrInvalidAssetType, i)
+		}
+		// An explicit "data": null decodes to the literal null, not an empty message
+		if len(items[i].Data) == 0 || string(items[i].Data) == "null" {
+			return nil, fmt.Errorf("%w at index %d", ErrAssetDataRequired, i)
+		}
+		// Tags are optional; store an empty array rather than NULL
+		if items[i].Tags == nil {
+			items[i].Tags = []string{}
+		}
+	}
+
+	ids, err := s.storage.BulkCreateAssets(orgID, items)
+	if err != nil {
+		return nil, fmt.Errorf("error creating assets: %w", err)
+	}
+	return ids, nil
+}
+
+// ListAssets retrieves paginated asset list, optionally filtered by types, tag
+// and a full-text search of the data. Assets of any of assetTypes match.
+// sort is "newest" (default) or "popularity".
+func (s *Service) ListAssets(orgID string, page int, limit int, assetTypes []string, tag *string, search *string, sort string) (map[string]interface{}, error) {
+	// Validate and constrain pagination
+	limit, err := s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	// Validate asset types if provided; empty types are ignored, so only
+	// empty types means no filter
+	var types []string
+	for _, assetType := range assetTypes {
+		if assetType == "" {
+			continue
+		}
+		if !ValidAssetTypes.IsValid(assetType) {
+			return nil, ErrInvalidAssetType
+		}
+		types = append(types, assetType)
+	}
+
+	if sort == "" {
+		sort = "newest"
+	}
+	if !ValidAssetSorts[sort] {
+		return nil, ErrInvalidSort
+	}
+
+	offset := (page - 1) * limit
+
+	// Fetch from storage
+	assets, total, err := s.storage.ListAssets(orgID, limit, offset, types, tag, search, sort)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching assets: %w", err)
+	}
+
+	// Transform to API format
+	assetList := []map[string]interface{}{}
+	for _, a := range assets {
+		assetList = append(assetList, map[string]interface{}{
+			"id":             a.ID,
+			"type":           a.Type,
+			"data":           a.Data,
+			"tags":           a.Tags,
+			"created_at":     a.CreatedAt,
+			"favorite_count": a.FavoriteCount,
+		})
+	}
+
+	return map[string]interface{}{
+		"assets":     assetList,
+		"pagination": newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// GetAsset returns a single asset.
+func (s *Service) GetAsset(orgID string, assetID string) (*Asset, error) {
+	asset, err := s.storage.GetAsset(orgID, assetID)
+	if errors.Is(err, ErrAssetNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting asset: %w", err)
+	}
+	return asset, nil
+}
+
+// GetChartData returns the data of a chart asset decoded into ChartData.
+// Missing fields are left empty; fields of the wrong type are an error.
+func (s *Service) GetChartData(orgID string, assetID string) (*ChartData, error) {
+	asset, err := s.GetAsset(orgID, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Type != "chart" {
+		return nil, ErrNotAChart
+	}
+
+	var chart ChartData
+	if err := json.Unmarshal(asset.Data, &chart); err != nil {
+		// Name the field rather than the Go type the decoder complains about;
+		// an element of the series is reported as the series itself
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			field, _, _ := strings.Cut(typeErr.Field, ".")
+			return nil, fmt.Errorf("%w: %s has the wrong type", ErrInvalidChartData, field)
+		}
+		return nil, ErrInvalidChartData
+	}
+	return &chart, nil
+}
+
+// GetInsightText returns the text of an insight asset, cut to at most
+// MaxInsightTextBytes without splitting a UTF-8 character.
+func (s *Service) GetInsightText(orgID string, assetID string) (string, error) {
+	asset, err := s.GetAsset(orgID, assetID)
+	if err != nil {
+		return "", err
+	}
+	if asset.Type != "insight" {
+		return "", ErrNotAnInsight
+	}
+
+	var data struct {
+		Text *string `json:"text"`
+	}
+	if err := json.Unmarshal(asset.Data, &data); err != nil || data.Text == nil {
+		return "", ErrInsightHasNoText
+	}
+
+	text := *data.Text
+	if len(text) > MaxInsightTextBytes {
+		cut := MaxInsightTextBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	return text, nil
+}
+
+// GetAudienceSize returns the size of an audience asset.
+// The number is decoded as a json.Number so sizes beyond 2^53 keep their precision.
+func (s *Service) GetAudienceSize(orgID string, assetID string) (int64, error) {
+	asset, err := s.GetAsset(orgID, assetID)
+	if err != nil {
+		return 0, err
+	}
+	if asset.Type != "audience" {
+		return 0, ErrNotAnAudience
+	}
+
+	var data map[string]interface{}
+	if err := decodeJSONNumbers(asset.Data, &data); err != nil || data["size"] == nil {
+		return 0, ErrAudienceHasNoSize
+	}
+
+	number, ok := data["size"].(json.Number)
+	if !ok {
+		return 0, ErrAudienceSizeNotInteger
+	}
+	size, err := number.Int64()
+	if err != nil {
+		return 0, ErrAudienceSizeNotInteger
+	}
+	return size, nil
+}
+
+// downloadURLCacheKey is the cache key of an asset's download URL.
+func downloadURLCacheKey(orgID string, assetID string) string {
+	return "download-url:" + orgID + ":" + assetID
+}
+
+// assetDownloadURL returns the download_url of a chart asset. It is cached
+// for DownloadURLCacheTTL, so a changed URL may take that long to be used.
+func (s *Service) assetDownloadURL(orgID string, assetID string) (string, error) {
+	cacheKey := downloadURLCacheKey(orgID, assetID)
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			return string(cached), nil
+		}
+	}
+
+	asset, err := s.GetAsset(orgID, assetID)
+	if err != nil {
+		return "", err
+	}
+	if asset.Type != "chart" {
+		return "", ErrNotAChart
+	}
+
+	var data struct {
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.Unmarshal(asset.Data, &data); err != nil || data.DownloadURL == "" {
+		return "", ErrNoDownloadURL
+	}
+	// Data stored before download_url was validated may hold anything
+	if !isHTTPURL(data.DownloadURL) {
+		return "", ErrInvalidDownloadURL
+	}
+
+	if s.cache != nil {
+		s.cache.Set(cacheKey, []byte(data.DownloadURL), DownloadURLCacheTTL)
+	}
+	return data.DownloadURL, nil
+}
+
+// OpenAssetDownload requests a chart's download_url. The caller streams and
+// closes the response body. The whole download, body included, is cut off
+// after DownloadMaxDuration so a slow upstream can't hold the connection open.
+// Network errors and non-2xx responses are returned wrapping ErrDownloadFailed.
+func (s *Service) OpenAssetDownload(ctx context.Context, orgID string, assetID string) (*http.Response, error) {
+	downloadURL, err := s.assetDownloadURL(orgID, assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DownloadMaxDuration)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%w: %w", ErrDownloadFailed, err)
+	}
+	resp, err := s.downloads().Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%w: %w", ErrDownloadFailed, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("%w with status %d", ErrDownloadFailed, resp.StatusCode)
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context when its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// ProjectAsset returns only the requested fields of an asset.
+// A field is a top-level key ("id", "type", "data", "tags", "favorite_count")
+// or a dotted path into the data blob ("data.title", "data.axes.x").
+// Unknown fields and missing paths are skipped. With no fields the whole
+// asset is returned.
+func ProjectAsset(asset *Asset, fields []string) map[string]interface{} {
+	// Decode data so nested paths can be walked; UseNumber keeps large numbers exact
+	var data interface{} = asset.Data
+	decoder := json.NewDecoder(bytes.NewReader(asset.Data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err == nil {
+		data = decoded
+	}
+
+	full := map[string]interface{}{
+		"id":             asset.ID,
+		"type":           asset.Type,
+		"data":           data,
+		"tags":           asset.Tags,
+		"created_at":     asset.CreatedAt,
+		"favorite_count": asset.FavoriteCount,
+	}
+	if len(fields) == 0 {
+		return full
+	}
+
+	projected := map[string]interface{}{}
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		if value, ok := lookupPath(full, path); ok {
+			setPath(projected, path, value)
+		}
+	}
+	return projected
+}
+
+// lookupPath walks nested JSON objects along path.
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setPath stores value at path in target, creating intermediate objects.
+// If a parent was already projected whole it already contains value, so nothing is done.
+func setPath(target map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, exists := target[key]
+		if !exists {
+			next := map[string]interface{}{}
+			target[key] = next
+			target = next
+			continue
+		}
+		next, ok := child.(map[string]interface{})
+		if !ok {
+			return
+		}
+		target = next
+	}
+	target[path[len(path)-1]] = value
+}
+
+// PatchAsset applies a JSON merge patch (RFC 7396) to an asset's data and
+// returns the updated asset. If ifMatch is set and is not "*", it must list
+// the asset's current ETag, otherwise nothing is changed.
+func (s *Service) PatchAsset(orgID string, assetID string, patch json.RawMessage, ifMatch string) (*Asset, error) {
+	var patchValue interface{}
+	if err := decodeJSONNumbers(patch, &patchValue); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	var updated *Asset
+	err := s.storage.WithTransaction(func(tx *sql.Tx) error {
+		asset, err := s.storage.GetAssetForUpdateTx(tx, orgID, assetID)
+		if errors.Is(err, ErrAssetNotFound) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("error getting asset: %w", err)
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, AssetETag(asset)) {
+			return ErrETagMismatch
+		}
+
+		var current interface{}
+		if err := decodeJSONNumbers(asset.Data, &current); err != nil {
+			return fmt.Errorf("error decoding asset data: %w", err)
+		}
+		merged := mergePatch(current, patchValue)
+		if err := ValidateAssetData(asset.Type, merged); err != nil {
+			return err
+		}
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("error encoding asset data: %w", err)
+		}
+
+		stored, found, err := s.storage.UpdateAssetDataTx(tx, orgID, assetID, data)
+		if err != nil {
+			return fmt.Errorf("error updating asset: %w", err)
+		}
+		if !found {
+			return ErrAssetNotFound
+		}
+		asset.Data = stored
+		updated = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The asset may be in any user's favorites
+	s.invalidateFavorites("")
+	return updated, nil
+}
+
+// GetAssetVersions returns the previous versions of an asset's data, newest first.
+func (s *Service) GetAssetVersions(orgID string, assetID string) ([]*AssetVersion, error) {
+	versions, found, err := s.storage.GetAssetVersions(orgID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching asset versions: %w", err)
+	}
+	if !found {
+		return nil, ErrAssetNotFound
+	}
+	return versions, nil
+}
+
+// GetAssetVersion returns one previous version of an asset's data.
+func (s *Service) GetAssetVersion(orgID string, assetID string, version int) (*AssetVersion, error) {
+	exists, err := s.storage.AssetExists(orgID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking asset: %w", err)
+	}
+	if !exists {
+		return nil, ErrAssetNotFound
+	}
+
+	result, err := s.storage.GetAssetVersion(orgID, assetID, version)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching asset version: %w", err)
+	}
+	if result == nil {
+		return nil, ErrVersionNotFound
+	}
+	return result, nil
+}
+
+// RestoreAssetVersion replaces an asset's data with a previous version.
+// The data being replaced becomes a new version, so a restore can be undone.
+func (s *Service) RestoreAssetVersion(orgID string, assetID string, version int) (*Asset, error) {
+	var restored *Asset
+	err := s.storage.WithTransaction(func(tx *sql.Tx) error {
+		asset, err := s.storage.GetAssetForUpdateTx(tx, orgID, assetID)
+		if errors.Is(err, ErrAssetNotFound) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("error getting asset: %w", err)
+		}
+
+		previous, err := s.storage.GetAssetVersionTx(tx, orgID, assetID, version)
+		if err != nil {
+			return fmt.Errorf("error fetching asset version: %w", err)
+		}
+		if previous == nil {
+			return ErrVersionNotFound
+		}
+
+		stored, found, err := s.storage.UpdateAssetDataTx(tx, orgID, assetID, previous.Data)
+		if err != nil {
+			return fmt.Errorf("error updating asset: %w", err)
+		}
+		if !found {
+			return ErrAssetNotFound
+		}
+		asset.Data = stored
+		restored = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The asset may be in any user's favorites
+	s.invalidateFavorites("")
+	return restored, nil
+}
+
+// decodeJSONNumbers decodes data into v, keeping numbers as json.Number so
+// large values survive a decode/encode round trip unchanged.
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// mergePatch applies an RFC 7396 merge patch to target: object members are
+// merged recursively, null removes a member, anything else replaces it.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// assetDataValidators check the fields of built-in asset types.
+// Fields are optional, but when present they must have the documented type.
+var assetDataValidators = map[string]func(data map[string]interface{}) error{
+	"chart": func(data map[string]interface{}) error {
+		for _, field := range []string{"title", "x_axis", "y_axis", "download_url"} {
+			if err := checkStringField(data, field); err != nil {
+				return err
+			}
+		}
+		if downloadURL, ok := data["download_url"].(string); ok && !isHTTPURL(downloadURL) {
+			return fmt.Errorf("%w: download_url must be an http or https URL", ErrInvalidAssetData)
+		}
+		if values, ok := data["data"]; ok {
+			list, ok := values.([]interface{})
+			if !ok {
+				return fmt.Errorf("%w: data must be an array of numbers", ErrInvalidAssetData)
+			}
+			for _, value := range list {
+				if _, ok := value.(json.Number); !ok {
+					return fmt.Errorf("%w: data must be an array of numbers", ErrInvalidAssetData)
+				}
+			}
+		}
+		return nil
+	},
+	"insight": func(data map[string]interface{}) error {
+		for _, field := range []string{"text", "topic"} {
+			if err := checkStringField(data, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	"audience": func(data map[string]interface{}) error {
+		for _, field := range []string{"gender", "birth_country", "social_media_hours_daily"} {
+			if err := checkStringField(data, field); err != nil {
+				return err
+			}
+		}
+		if gender, ok := data["gender"]; ok && gender != "Male" && gender != "Female" {
+			return fmt.Errorf("%w: gender must be Male or Female", ErrInvalidAssetData)
+		}
+		if groups, ok := data["age_groups"]; ok {
+			list, ok := groups.([]interface{})
+			if !ok {
+				return fmt.Errorf("%w: age_groups must be an array of strings", ErrInvalidAssetData)
+			}
+			for _, group := range list {
+				if _, ok := group.(string); !ok {
+					return fmt.Errorf("%w: age_groups must be an array of strings", ErrInvalidAssetData)
+				}
+			}
+		}
+		if purchases, ok := data["purchases_last_month"]; ok {
+			number, ok := purchases.(json.Number)
+			count, err := number.Int64()
+			if !ok || err != nil || count < 0 {
+				return fmt.Errorf("%w: purchases_last_month must be a non-negative integer", ErrInvalidAssetData)
+			}
+		}
+		return nil
+	},
+}
+
+// checkStringField reports an error if data has field and it is not a string.
+func checkStringField(data map[string]interface{}, field string) error {
+	if value, ok := data[field]; ok {
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%w: %s must be a string", ErrInvalidAssetData, field)
+		}
+	}
+	return nil
+}
+
+// ValidateAssetData checks decoded asset data: it must be a JSON object, and
+// built-in types must match their documented fields. Types added through
+// /admin/asset-types only need an object.
+// Errors wrap ErrInvalidAssetData.
+func ValidateAssetData(assetType string, data interface{}) error {
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: data must be an object", ErrInvalidAssetData)
+	}
+	if validate, ok := assetDataValidators[assetType]; ok {
+		return validate(object)
+	}
+	return nil
+}
+
+// AssetETag returns a strong ETag for the current state of an asset.
+// asset.Data must be as read back from the database, so the same state
+// always hashes the same.
+func AssetETag(asset *Asset) string {
+	hash := sha256.New()
+	hash.Write([]byte(asset.Type))
+	hash.Write([]byte{0})
+	hash.Write(asset.Data)
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether an If-Match header lists etag or is "*".
+func etagMatches(ifMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSimilarAssets returns other assets of the same type as the given asset.
+// Similarity is type-only for now; scoring on JSONB data can come later.
+func (s *Service) GetSimilarAssets(orgID string, assetID string) ([]*Asset, error) {
+	asset, err := s.storage.GetAsset(orgID, assetID)
+	if errors.Is(err, ErrAssetNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting asset: %w", err)
+	}
+
+	// Fetch one extra in case the asset itself is in the page
+	candidates, _, err := s.storage.ListAssets(orgID, SimilarAssetsLimit+1, 0, []string{asset.Type}, nil, nil, "newest")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching assets: %w", err)
+	}
+
+	similar := []*Asset{}
+	for _, a := range candidates {
+		if a.ID == assetID {
+			continue
+		}
+		if len(similar) == SimilarAssetsLimit {
+			break
+		}
+		similar = append(similar, a)
+	}
+
+	return similar, nil
+}
+
+// DeleteAsset removes an asset from the system.
+// Favorites of the asset are soft-deleted with it; their count is returned.
+func (s *Service) DeleteAsset(orgID string, assetID string) (int, error) {
+	// Delete asset
+	found, favoritesRemoved, err := s.storage.DeleteAsset(orgID, assetID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting asset: %w", err)
+	}
+	if !found {
+		return 0, ErrAssetNotFound
+	}
+	// The asset may be in any user's favorites
+	s.invalidateFavorites("")
+
+	return favoritesRemoved, nil
+}
+
+// BulkDeleteAssets deletes up to MaxBulkAssets assets at once. IDs that aren't
+// UUIDs can't exist and are reported missing without reaching the database,
+// where they would fail the uuid cast.
+func (s *Service) BulkDeleteAssets(orgID string, assetIDs []string) (*BulkDeleteResult, error) {
+	if len(assetIDs) == 0 {
+		return nil, ErrNoAssetIDs
+	}
+	if len(assetIDs) > MaxBulkAssets {
+		return nil, ErrTooManyAssetIDs
+	}
+
+	seen := make(map[string]bool, len(assetIDs))
+	valid := make([]string, 0, len(assetIDs))
+	for _, assetID := range assetIDs {
+		if seen[assetID] {
+			continue
+		}
+		seen[assetID] = true
+		if _, err := uuid.Parse(assetID); err == nil {
+			valid = append(valid, assetID)
+		}
+	}
+
+	deleted := []string{}
+	favoritesRemoved := 0
+	if len(valid) > 0 {
+		var err error
+		deleted, favoritesRemoved, err = s.storage.BulkDeleteAssets(orgID, valid)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting assets: %w", err)
+		}
+	}
+	if len(deleted) > 0 {
+		// The assets may be in any user's favorites
+		s.invalidateFavorites("")
+	}
+
+	found := make(map[string]bool, len(deleted))
+	for _, assetID := range deleted {
+		found[assetID] = true
+	}
+	result := &BulkDeleteResult{DeletedAssets: len(deleted), CascadeFavorites: favoritesRemoved}
+	// Report missing IDs once each, in the order they were requested
+	for _, assetID := range assetIDs {
+		if seen[assetID] && !found[assetID] {
+			result.Missing = append(result.Missing, assetID)
+			seen[assetID] = false
+		}
+	}
+	return result, nil
+}
+
+// ListAssetTypes returns all asset types.
+func (s *Service) ListAssetTypes() ([]*AssetType, error) {
+	types, err := s.storage.ListAssetTypes()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching asset types: %w", err)
+	}
+	return types, nil
+}
+
+// CreateAssetType adds an asset type and makes it valid immediately on this instance.
+// Names are lowercase letters, digits and underscores, starting with a letter.
+// Asset types are global; orgID only attributes the audit entry.
+func (s *Service) CreateAssetType(orgID string, name string, schema json.RawMessage) (*AssetType, error) {
+	if !isValidAssetTypeName(name) {
+		return nil, ErrInvalidAssetTypeName
+	}
+	if len(schema) > 0 && !json.Valid(schema) {
+		return nil, ErrInvalidSchemaJSON
+	}
+	if len(schema) == 0 {
+		schema = nil
+	}
+
+	assetType, err := s.storage.CreateAssetType(orgID, name, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error creating asset type: %w", err)
+	}
+	if assetType == nil {
+		return nil, ErrAssetTypeExists
+	}
+
+	ValidAssetTypes.Add(name)
+	return assetType, nil
+}
+
+// ReloadAssetTypes replaces ValidAssetTypes with the contents of the asset_types table.
+func (s *Service) ReloadAssetTypes() error {
+	types, err := s.storage.ListAssetTypes()
+	if err != nil {
+		return fmt.Errorf("error fetching asset types: %w", err)
+	}
+	// An empty table means the seed rows are missing; keep what we have
+	if len(types) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		names = append(names, t.Name)
+	}
+	ValidAssetTypes.Replace(names)
+	return nil
+}
+
+// refreshAssetTypes periodically reloads ValidAssetTypes so types created
+// through other instances are picked up. Runs until ctx is done.
+func refreshAssetTypes(ctx context.Context, service *Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.ReloadAssetTypes(); err != nil {
+				log.Printf("Error reloading asset types: %v", err)
+			}
+		}
+	}
+}
+
+func isValidAssetTypeName(name string) bool {
+	if name == "" || len(name) > MaxAssetTypeNameLength {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case (c >= '0' && c <= '9') || c == '_':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================
+// FAVORITES SERVICE METHODS
+// ============================================================================
+
+// AddFavorite adds an asset to user's favorites with validation.
+// The returned bool is true when a previously removed favorite was restored
+// rather than created from scratch.
+func (s *Service) AddFavorite(
+	orgID string,
+	userID string,
+	assetID string,
+	description *string,
+	notes *string,
+) (*Favorite, bool, error) {
+	// Validate asset exists, in any organization if cross-org favorites are allowed
+	assetOrgID := orgID
+	if s.allowCrossOrgAssets {
+		assetOrgID = ""
+	}
+
+	// Check and insert in one transaction: the user and asset rows stay
+	// locked until the favorite is written, so neither can be deleted in between
+	var asset *Asset
+	var favoriteID string
+	var addedAt time.Time
+	var restored bool
+	err := s.storage.WithTransaction(func(tx *sql.Tx) error {
+		exists, err := s.storage.UserExistsTx(tx, orgID, userID)
+		if err != nil {
+			return fmt.Errorf("error checking user: %w", err)
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+
+		asset, err = s.storage.GetAssetTx(tx, assetOrgID, assetID)
+		if errors.Is(err, ErrAssetNotFound) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("error getting asset: %w", err)
+		}
+
+		// Try to add to favorites
+		favoriteID, addedAt, restored, err = s.storage.AddToFavoritesTx(tx, orgID, userID, assetID, description, notes, nil)
+		if err != nil {
+			return fmt.Errorf("error adding favorite: %w", err)
+		}
+		if favoriteID == "" {
+			// Empty ID means already favorited
+			return ErrAlreadyFavorited
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	favorite := &Favorite{
+		ID:                  favoriteID,
+		UserID:              userID,
+		Asset:               asset,
+		DescriptionOverride: description,
+		Notes:               notes,
+		AddedAt:             addedAt.UTC(),
+	}
+
+	s.invalidateFavorites(userID)
+	s.notify(Event{
+		Type:      EventFavoriteAdded,
+		UserID:    userID,
+		AssetID:   assetID,
+		Favorite:  favorite,
+		Timestamp: time.Now().UTC(),
+	})
+
+	return favorite, restored, nil
+}
+
+// ParseFavoriteSort turns the sort and order of a favorites request into
+// sort fields. sort is one of ValidFavoriteSorts, empty meaning "newest"
+// (no fields), or comma-separated FavoriteSortColumns such as
+// "asset_type,added_at". order gives "asc" or "desc" for each of those
+// fields, e.g. "asc,desc"; without it every field is ascending.
+func ParseFavoriteSort(sort string, order string) ([]SortField, error) {
+	if sort == "" || ValidFavoriteSorts[sort] {
+		if order != "" {
+			return nil, ErrOrderWithoutSort
+		}
+		if sort == "custom" {
+			return []SortField{{Field: "order_index"}, {Field: "added_at", Desc: true}}, nil
+		}
+		return nil, nil
+	}
+
+	names := strings.Split(sort, ",")
+	var directions []string
+	if order != "" {
+		directions = strings.Split(order, ",")
+		if len(directions) != len(names) {
+			return nil, ErrSortOrderMismatch
+		}
+	}
+
+	fields := make([]SortField, 0, len(names))
+	seen := map[string]bool{}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if _, ok := FavoriteSortColumns[name]; !ok || seen[name] {
+			return nil, ErrInvalidSort
+		}
+		seen[name] = true
+
+		field := SortField{Field: name}
+		if directions != nil {
+			switch strings.ToLower(strings.TrimSpace(directions[i])) {
+			case "asc":
+			case "desc":
+				field.Desc = true
+			default:
+				return nil, ErrInvalidOrder
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// GetFavorites retrieves user's favorites with pagination.
+// sort and order are parsed by ParseFavoriteSort; empty means "newest".
+// before switches to cursor pagination: the favorites that come after it,
+// newest first, with page ignored and the total left uncounted.
+func (s *Service) GetFavorites(
+	orgID string,
+	userID string,
+	page int,
+	limit int,
+	assetType *string,
+	sort string,
+	order string,
+	before *FavoriteCursor,
+) (*PaginatedResponse, error) {
+	if sort == "" {
+		sort = "newest"
+	}
+	sortFields, err := ParseFavoriteSort(sort, order)
+	if err != nil {
+		return nil, err
+	}
+	if before != nil && sortFields != nil {
+		return nil, ErrBeforeRequiresNewest
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate and constrain pagination
+	limit, err = s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+	if before != nil {
+		page = 1
+		offset = 0
+	}
+
+	typeKey := ""
+	if assetType != nil {
+		typeKey = *assetType
+	}
+	cacheKey := fmt.Sprintf("%s:%d:%d:%s:%s", favoritesCacheKey(userID), page, limit, typeKey, sort)
+	if order != "" {
+		cacheKey += ":" + order
+	}
+	if before != nil {
+		cacheKey += ":" + before.AddedAt.UTC().Format(time.RFC3339Nano) + ":" + before.ID
+	}
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			var result PaginatedResponse
+			if err := json.Unmarshal(cached, &result); err == nil {
+				return &result, nil
+			}
+		}
+	}
+
+	// Fetch from storage
+	// Cursor pages fetch one extra favorite to learn whether another page follows
+	fetchLimit := limit
+	if before != nil {
+		fetchLimit = limit + 1
+	}
+	favorites, total, err := s.storage.GetFavorites(orgID, userID, fetchLimit, offset, assetType, sortFields, before)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorites: %w", err)
+	}
+
+	var pagination PaginationInfo
+	if before != nil {
+		hasNext := len(favorites) > limit
+		if hasNext {
+			favorites = favorites[:limit]
+		}
+		pagination = PaginationInfo{
+			Page:        page,
+			Limit:       limit,
+			Total:       -1,
+			TotalPages:  -1,
+			HasNext:     hasNext,
+			HasPrev:     true,
+			RetrievedAt: time.Now().UTC(),
+		}
+	} else {
+		pagination = newPaginationInfo(page, limit, total)
+	}
+	// Only newest-first pages can be continued by cursor, and only from an
+	// unpinned favorite: pins lead the list, so once one unpinned favorite is
+	// on the page every pin has been listed
+	if sortFields == nil && len(favorites) > 0 && !favorites[len(favorites)-1].IsPinned {
+		last := favorites[len(favorites)-1]
+		pagination.NextBefore = &last.AddedAt
+		pagination.NextBeforeID = last.ID
+	}
+
+	result := &PaginatedResponse{
+		Favorites:  favorites,
+		Pagination: pagination,
+	}
+
+	if s.cache != nil {
+		if data, err := json.Marshal(result); err == nil {
+			s.cache.Set(cacheKey, data, CacheTTLSeconds*time.Second)
+		}
+	}
+
+	return result, nil
+}
+
+// ExportFavorites calls fn for every favorite of the user, in the given sort
+// order or newest first, reading MaxPageSize favorites at a time by keyset
+// pagination. Unlike GetFavorites, pins aren't moved first. It stops at the
+// first error from fn. The user and sort are validated before fn is first called.
+func (s *Service) ExportFavorites(
+	orgID string,
+	userID string,
+	assetType *string,
+	sort string,
+	order string,
+	fn func(*Favorite) error,
+) error {
+	sortFields, err := ParseFavoriteSort(sort, order)
+	if err != nil {
+		return err
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	var after *Favorite
+	for {
+		favorites, err := s.storage.GetFavoritesAfter(orgID, userID, MaxPageSize, assetType, sortFields, after)
+		if err != nil {
+			return fmt.Errorf("error fetching favorites: %w", err)
+		}
+		for _, favorite := range favorites {
+			if err := fn(favorite); err != nil {
+				return err
+			}
+		}
+		if len(favorites) < MaxPageSize {
+			return nil
+		}
+		after = favorites[len(favorites)-1]
+	}
+}
+
+// StreamFavorites calls fn for every favorite of the user, newest first.
+// It is ExportFavorites with the default sort.
+func (s *Service) StreamFavorites(orgID string, userID string, assetType *string, fn func(*Favorite) error) error {
+	return s.ExportFavorites(orgID, userID, assetType, "", "", fn)
+}
+
+// favoriteImport is one line of an import that passed validation.
+type favoriteImport struct {
+	line        int
+	assetID     string
+	description *string
+	notes       *string
+	addedAt     *time.Time
+}
+
+// ImportFavorites adds the favorites in body, one Favorite JSON object per
+// line as written by StreamFavorites. Only asset.id, description_override,
+// notes and added_at are read; without added_at the current time is used.
+// Every line is decoded on its own and validated before anything is written,
+// then favorites are inserted ImportBatchSize per transaction. Blank lines
+// are skipped but still counted.
+// If a batch fails, the result of the batches committed before it is
+// returned along with the error.
+// Imports don't send favorite_added events.
+func (s *Service) ImportFavorites(orgID string, userID string, body io.Reader) (*ImportResult, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	result := &ImportResult{Errors: []ImportLineError{}}
+	var imports []favoriteImport
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxImportBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var entry struct {
+			Asset *struct {
+				ID string `json:"id"`
+			} `json:"asset"`
+			DescriptionOverride *string    `json:"description_override"`
+			Notes               *string    `json:"notes"`
+			AddedAt             *time.Time `json:"added_at"`
+		}
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		err := decoder.Decode(&entry)
+		var typeErr *json.UnmarshalTypeError
+		var timeErr *time.ParseError
+		if errors.As(err, &typeErr) {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Reason: typeErr.Field + " has the wrong type"})
+			continue
+		}
+		if errors.As(err, &timeErr) {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Reason: "added_at is not an RFC 3339 time"})
+			continue
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Reason: "invalid JSON"})
+			continue
+		}
+		// Anything after the object, such as a second one, makes the line invalid
+		if _, err := decoder.Token(); err != io.EOF {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Reason: "invalid JSON"})
+			continue
+		}
+
+		if entry.Asset == nil || entry.Asset.ID == "" {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Reason: "asset.id is required"})
+			continue
+		}
+		if _, err := uuid.Parse(entry.Asset.ID); err != nil {
+			result.Errors = append(result.Errors, ImportLineError{Line: line, Reason: "asset.id is not a valid UUID"})
+			continue
+		}
+		if entry.DescriptionOverride != nil && *entry.DescriptionOverride == "" {
+			entry.DescriptionOverride = nil
+		}
+		if entry.Notes != nil && *entry.Notes == "" {
+			entry.Notes = nil
+		}
+		imports = append(imports, favoriteImport{
+			line:        line,
+			assetID:     entry.Asset.ID,
+			description: entry.DescriptionOverride,
+			notes:       entry.Notes,
+			addedAt:     entry.AddedAt,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading import: %w", err)
+	}
+
+	// Validate assets exist, in any organization if cross-org favorites are allowed
+	assetOrgID := orgID
+	if s.allowCrossOrgAssets {
+		assetOrgID = ""
+	}
+
+	var importErr error
+	for start := 0; start < len(imports); start += ImportBatchSize {
+		end := start + ImportBatchSize
+		if end > len(imports) {
+			end = len(imports)
+		}
+		batch := imports[start:end]
+		var imported, skipped int
+		var lineErrors []ImportLineError
+		err := s.storage.WithTransaction(func(tx *sql.Tx) error {
+			for _, item := range batch {
+				_, err := s.storage.GetAssetTx(tx, assetOrgID, item.assetID)
+				if errors.Is(err, ErrAssetNotFound) {
+					lineErrors = append(lineErrors, ImportLineError{Line: item.line, Reason: err.Error()})
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("error getting asset: %w", err)
+				}
+
+				favoriteID, _, _, err := s.storage.AddToFavoritesTx(tx, orgID, userID, item.assetID, item.description, item.notes, item.addedAt)
+				if err != nil {
+					return fmt.Errorf("error adding favorite: %w", err)
+				}
+				if favoriteID == "" {
+					// Empty ID means already favorited
+					skipped++
+					continue
+				}
+				imported++
+			}
+			return nil
+		})
+		if err != nil {
+			importErr = fmt.Errorf("error importing from line %d: %w", batch[0].line, err)
+			break
+		}
+		result.Imported += imported
+		result.Skipped += skipped
+		result.Errors = append(result.Errors, lineErrors...)
+	}
+
+	// Batches committed before a failed one stay imported
+	if result.Imported > 0 {
+		s.invalidateFavorites(userID)
+	}
+
+	sort.Slice(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Line < result.Errors[j].Line
+	})
+	return result, importErr
+}
+
+// GetFavoritesGrouped returns a user's newest favorites for each asset type.
+// Every valid type is present in the result, with an empty list if the user
+// has no favorites of that type.
+func (s *Service) GetFavoritesGrouped(orgID string, userID string, perGroup int) (map[string][]*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	if perGroup < 1 {
+		perGroup = 1
+	}
+	if perGroup > s.maxLimit() {
+		perGroup = s.maxLimit()
+	}
+
+	groups, err := s.storage.GetFavoritesByType(orgID, userID, perGroup)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorites: %w", err)
+	}
+
+	for _, name := range ValidAssetTypes.Names() {
+		if groups[name] == nil {
+			groups[name] = []*Favorite{}
+		}
+	}
+
+	return groups, nil
+}
+
+// GetMostRecentFavoritePerType returns the user's newest favorite of every
+// asset type; types without favorites map to nil.
+func (s *Service) GetMostRecentFavoritePerType(orgID string, userID string) (map[string]*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	latest, err := s.storage.GetMostRecentFavoritePerType(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorites: %w", err)
+	}
+
+	for _, name := range ValidAssetTypes.Names() {
+		if _, ok := latest[name]; !ok {
+			latest[name] = nil
+		}
+	}
+
+	return latest, nil
+}
+
+// SearchFavorites finds the user's favorites whose description contains query.
+func (s *Service) SearchFavorites(orgID string, userID string, query string, page int, limit int) (*PaginatedResponse, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrSearchQueryRequired
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate and constrain pagination
+	limit, err = s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+
+	favorites, total, err := s.storage.SearchFavorites(orgID, userID, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error searching favorites: %w", err)
+	}
+
+	return &PaginatedResponse{
+		Favorites:  favorites,
+		Pagination: newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// GetRandomFavorite returns one of the user's favorites at random, for rediscovery.
+func (s *Service) GetRandomFavorite(orgID string, userID string) (*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	favorite, err := s.storage.GetRandomFavorite(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching random favorite: %w", err)
+	}
+	if favorite == nil {
+		return nil, ErrNoFavorites
+	}
+
+	return favorite, nil
+}
+
+// GetFavoriteAssetTypes returns the asset types the user has favorited, so
+// clients only render filters that match something. Cached like favorites pages.
+func (s *Service) GetFavoriteAssetTypes(orgID string, userID string) ([]string, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Kept under the favorites key so any change to the user's favorites drops it
+	cacheKey := favoritesCacheKey(userID) + ":asset-types"
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			var types []string
+			if err := json.Unmarshal(cached, &types); err == nil {
+				return types, nil
+			}
+		}
+	}
+
+	types, err := s.storage.GetFavoriteAssetTypes(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite asset types: %w", err)
+	}
+
+	if s.cache != nil {
+		if data, err := json.Marshal(types); err == nil {
+			s.cache.Set(cacheKey, data, CacheTTLSeconds*time.Second)
+		}
+	}
+
+	return types, nil
+}
+
+// GetFavoriteStats returns statistics about the user's favorites for profile
+// pages. Cached for FavoriteStatsCacheTTL and dropped when favorites change.
+func (s *Service) GetFavoriteStats(orgID string, userID string) (*FavoriteStats, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Kept under the favorites key so any change to the user's favorites drops it
+	cacheKey := favoritesCacheKey(userID) + ":stats"
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			var stats FavoriteStats
+			if err := json.Unmarshal(cached, &stats); err == nil {
+				return &stats, nil
+			}
+		}
+	}
+
+	stats, err := s.storage.GetUserFavoriteStats(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite stats: %w", err)
+	}
+
+	if s.cache != nil {
+		if data, err := json.Marshal(stats); err == nil {
+			s.cache.Set(cacheKey, data, FavoriteStatsCacheTTL)
+		}
+	}
+
+	return stats, nil
+}
+
+// GetFavoriteBadges returns the user's progress towards every badge in
+// FavoriteBadgeRules, ordered by asset type.
+func (s *Service) GetFavoriteBadges(orgID string, userID string) ([]*FavoriteBadge, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	counts, err := s.storage.CountFavoritesByType(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting favorites: %w", err)
+	}
+
+	badges := make([]*FavoriteBadge, 0, len(FavoriteBadgeRules))
+	for assetType, rule := range FavoriteBadgeRules {
+		badges = append(badges, &FavoriteBadge{
+			Type:      assetType,
+			Count:     counts[assetType],
+			Threshold: rule.Threshold,
+			Badge:     rule.Badge,
+			Earned:    counts[assetType] >= rule.Threshold,
+		})
+	}
+	sort.Slice(badges, func(i, j int) bool {
+		return badges[i].Type < badges[j].Type
+	})
+
+	return badges, nil
+}
+
+// CompareFavorites returns the assets favorited by both userID and otherUserID.
+func (s *Service) CompareFavorites(orgID string, userID string, otherUserID string) ([]*Asset, error) {
+	// Validate both users exist
+	for _, id := range []string{userID, otherUserID} {
+		exists, err := s.storage.UserExists(orgID, id)
+		if err != nil {
+			return nil, fmt.Errorf("error checking user: %w", err)
+		}
+		if !exists {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	assets, err := s.storage.GetCommonFavorites(orgID, userID, otherUserID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching common favorites: %w", err)
+	}
+
+	return assets, nil
+}
+
+// GetFavoriteCalendar returns how many favorites the user added on each day
+// of year, with every day of the year present and empty days counted as 0.
+func (s *Service) GetFavoriteCalendar(orgID string, userID string, year int) ([]*CalendarDay, error) {
+	if year < MinCalendarYear || year > MaxCalendarYear {
+		return nil, ErrInvalidYear
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	counts, err := s.storage.GetFavoriteCalendarData(orgID, userID, year)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite calendar: %w", err)
+	}
+
+	calendar := make([]*CalendarDay, 0, 366)
+	for day := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC); day.Year() == year; day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		calendar = append(calendar, &CalendarDay{Date: date, Count: counts[date]})
+	}
+	return calendar, nil
+}
+
+// GetFavoritesTimeline returns the user's favorites of the last days days,
+// grouped by the day they were added, with at most perDay listed per day.
+func (s *Service) GetFavoritesTimeline(orgID string, userID string, days int, perDay int) ([]*TimelineDay, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	if days < 1 {
+		days = 1
+	}
+	if days > MaxTimelineDays {
+		days = MaxTimelineDays
+	}
+	if perDay < 1 {
+		perDay = 1
+	}
+	if perDay > s.maxLimit() {
+		perDay = s.maxLimit()
+	}
+
+	timeline, err := s.storage.GetFavoritesTimeline(orgID, userID, days, perDay)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorites timeline: %w", err)
+	}
+
+	return timeline, nil
+}
+
+// RecommendedFavorites returns assets favorited by the users whose
+// favorites overlap most with userID's, excluding ones userID already has.
+func (s *Service) RecommendedFavorites(orgID string, userID string, limit int) ([]*Asset, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > s.maxLimit() {
+		limit = s.maxLimit()
+	}
+
+	assets, err := s.storage.GetRecommendedAssets(orgID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching recommendations: %w", err)
+	}
+
+	return assets, nil
+}
+
+// GetTrending returns the organization's most favorited assets of the last
+// hours hours. Results are cached for TrendingCacheTTL and not invalidated
+// by favorite changes; a slightly stale list is fine for discovery.
+func (s *Service) GetTrending(orgID string, hours int, limit int) ([]*TrendingAsset, error) {
+	if hours < 1 || hours > MaxTrendingHours {
+		return nil, ErrInvalidTrendingHours
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > s.maxLimit() {
+		limit = s.maxLimit()
+	}
+
+	cacheKey := fmt.Sprintf("trending:%s:%d:%d", orgID, hours, limit)
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			var trending []*TrendingAsset
+			if err := json.Unmarshal(cached, &trending); err == nil {
+				return trending, nil
+			}
+		}
+	}
+
+	trending, err := s.storage.GetTrendingAssets(orgID, hours, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching trending assets: %w", err)
+	}
+
+	if s.cache != nil {
+		if data, err := json.Marshal(trending); err == nil {
+			s.cache.Set(cacheKey, data, TrendingCacheTTL)
+		}
+	}
+
+	return trending, nil
+}
+
+// GetFavorite returns the user's favorite of an asset, with the asset.
+func (s *Service) GetFavorite(orgID string, userID string, assetID string) (*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	favorite, err := s.storage.GetFavorite(orgID, userID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite: %w", err)
+	}
+	if favorite == nil {
+		return nil, ErrAssetNotInFavorites
+	}
+	return favorite, nil
+}
+
+// UpdateFavoriteDescription updates a favorite's description.
+func (s *Service) UpdateFavoriteDescription(
+	orgID string,
+	userID string,
+	assetID string,
+	description string,
+) (*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Get current favorite to return full object, ID included
+	favorite, err := s.storage.GetFavorite(orgID, userID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite: %w", err)
+	}
+	if favorite == nil {
+		return nil, ErrAssetNotInFavorites
+	}
+
+	// Update description
+	success, err := s.storage.UpdateFavoriteDescription(orgID, userID, assetID, description)
+	if err != nil {
+		return nil, fmt.Errorf("error updating favorite: %w", err)
+	}
+	if !success {
+		return nil, fmt.Errorf("failed to update description")
+	}
+
+	s.invalidateFavorites(userID)
+
+	// Update and return
+	favorite.DescriptionOverride = &description
+	return favorite, nil
+}
+
+// UpdateFavoriteNotes sets a favorite's private notes; nil or "" clears them.
+func (s *Service) UpdateFavoriteNotes(orgID string, userID string, assetID string, notes *string) (*Favorite, error) {
+	if notes != nil && *notes == "" {
+		notes = nil
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Get current favorite to return full object, ID included
+	favorite, err := s.storage.GetFavorite(orgID, userID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite: %w", err)
+	}
+	if favorite == nil {
+		return nil, ErrAssetNotInFavorites
+	}
+
+	success, err := s.storage.UpdateFavoriteNotes(orgID, userID, assetID, notes)
+	if err != nil {
+		return nil, fmt.Errorf("error updating favorite notes: %w", err)
+	}
+	if !success {
+		return nil, ErrAssetNotInFavorites
+	}
+
+	s.invalidateFavorites(userID)
+
+	favorite.Notes = notes
+	return favorite, nil
+}
+
+// SetFavoritePinned pins or unpins a favorite. Pinned favorites are listed
+// first by the default sort. Setting the current value again is a no-op.
+func (s *Service) SetFavoritePinned(orgID string, userID string, assetID string, pinned bool) (*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Get current favorite to return full object, ID included
+	favorite, err := s.storage.GetFavorite(orgID, userID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite: %w", err)
+	}
+	if favorite == nil {
+		return nil, ErrAssetNotInFavorites
+	}
+
+	success, err := s.storage.SetFavoritePinned(orgID, userID, assetID, pinned)
+	if err != nil {
+		return nil, fmt.Errorf("error updating favorite pin: %w", err)
+	}
+	if !success {
+		return nil, ErrAssetNotInFavorites
+	}
+
+	s.invalidateFavorites(userID)
+
+	favorite.IsPinned = pinned
+	return favorite, nil
+}
+
+// GetDescriptionHistory returns the previous descriptions of a favorite, newest first.
+func (s *Service) GetDescriptionHistory(orgID string, userID string, assetID string) ([]*DescriptionChange, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	history, found, err := s.storage.GetDescriptionHistory(orgID, userID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching description history: %w", err)
+	}
+	if !found {
+		return nil, ErrAssetNotInFavorites
+	}
+
+	return history, nil
+}
+
+// RemoveAllFavorites clears a user's favorites list.
+// Returns the number of favorites actually removed.
+func (s *Service) RemoveAllFavorites(orgID string, userID string) (int, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return 0, ErrUserNotFound
+	}
+
+	removed, err := s.storage.RemoveAllFavorites(orgID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error removing favorites: %w", err)
+	}
+
+	if removed > 0 {
+		s.invalidateFavorites(userID)
+		s.notify(Event{
+			Type:      EventFavoritesCleared,
+			UserID:    userID,
+			Timestamp: time.Now().UTC(),
+		})
+	}
+
+	return removed, nil
+}
+
+// CreateShareLink issues a token that lets anyone read the user's favorites for ttl.
+func (s *Service) CreateShareLink(orgID string, userID string, ttl time.Duration) (*ShareToken, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	share, err := s.storage.CreateShareToken(orgID, userID, uuid.New().String(), time.Now().Add(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("error creating share token: %w", err)
+	}
+
+	return share, nil
+}
+
+// GetSharedFavorites returns the favorites of the user who created the share token.
+func (s *Service) GetSharedFavorites(token string, page int, limit int) (*PaginatedResponse, error) {
+	// Tokens are UUIDs; anything else can't match, and PostgreSQL would reject it
+	if _, err := uuid.Parse(token); err != nil {
+		return nil, ErrShareLinkNotFound
+	}
+
+	share, err := s.storage.GetShareToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching share token: %w", err)
+	}
+	if share == nil {
+		return nil, ErrShareLinkNotFound
+	}
+	if time.Now().After(share.ExpiresAt) {
+		return nil, ErrShareLinkExpired
+	}
+
+	result, err := s.GetFavorites(share.OrgID, share.UserID, page, limit, nil, "newest", "", nil)
+	if err != nil {
+		// The user was deleted after sharing; the link no longer points anywhere
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, err
+	}
+
+	// Notes are private and the owner stays anonymous. The favorites may be
+	// cached, so they are copied rather than cleared in place.
+	shared := make([]*Favorite, len(result.Favorites))
+	for i, favorite := range result.Favorites {
+		copied := *favorite
+		copied.UserID = ""
+		copied.Notes = nil
+		shared[i] = &copied
+	}
+
+	return &PaginatedResponse{Favorites: shared, Pagination: result.Pagination}, nil
+}
+
+// GetIdempotentResponse returns the stored response for a retried request, if any.
+func (s *Service) GetIdempotentResponse(userID string, key string) (*IdempotentResponse, error) {
+	resp, err := s.storage.GetIdempotentResponse(userID, key)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching idempotency key: %w", err)
+	}
+	return resp, nil
+}
+
+// SaveIdempotentResponse stores a response so retries with the same key replay it.
+func (s *Service) SaveIdempotentResponse(userID string, key string, statusCode int, body []byte) error {
+	if err := s.storage.SaveIdempotentResponse(userID, key, statusCode, body); err != nil {
+		return fmt.Errorf("error saving idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReorderFavorites stores the user's custom order of their favorites,
+// used when listing with sort=custom. Favorites not listed keep their index.
+func (s *Service) ReorderFavorites(orgID string, userID string, order []FavoriteOrder) error {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	seen := make(map[string]bool, len(order))
+	for _, item := range order {
+		if seen[item.AssetID] {
+			return ErrDuplicateAssetID
+		}
+		seen[item.AssetID] = true
+		// Anything that isn't a UUID can't be a favorite
+		if _, err := uuid.Parse(item.AssetID); err != nil {
+			return ErrAssetNotInFavorites
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+
+	success, err := s.storage.ReorderFavorites(orgID, userID, order)
+	if err != nil {
+		return fmt.Errorf("error reordering favorites: %w", err)
+	}
+	if !success {
+		return ErrAssetNotInFavorites
+	}
+	s.invalidateFavorites(userID)
+
+	return nil
+}
+
+// FavoriteExists reports whether the user has favorited the asset.
+// Unknown users and assets are simply not favorited; no extra lookups are made.
+func (s *Service) FavoriteExists(orgID string, userID string, assetID string) (bool, error) {
+	exists, err := s.storage.FavoriteExists(orgID, userID, assetID)
+	if err != nil {
+		return false, fmt.Errorf("error checking favorite: %w", err)
+	}
+	return exists, nil
+}
+
+// CheckFavorites maps each of assetIDs to whether the user has favorited it.
+// IDs that aren't UUIDs can't be favorited and are reported false without
+// reaching the database, where they would fail the uuid cast.
+func (s *Service) CheckFavorites(orgID string, userID string, assetIDs []string) (map[string]bool, error) {
+	if len(assetIDs) > MaxCheckFavoritesIDs {
+		return nil, ErrTooManyAssetIDs
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	result := make(map[string]bool, len(assetIDs))
+	valid := make([]string, 0, len(assetIDs))
+	for _, assetID := range assetIDs {
+		result[assetID] = false
+		if _, err := uuid.Parse(assetID); err == nil {
+			valid = append(valid, assetID)
+		}
+	}
+	if len(valid) == 0 {
+		return result, nil
+	}
+
+	favorited, err := s.storage.CheckFavorites(orgID, userID, valid)
+	if err != nil {
+		return nil, fmt.Errorf("error checking favorites: %w", err)
+	}
+	for assetID := range favorited {
+		result[assetID] = true
+	}
+
+	return result, nil
+}
+
+// RemoveFavorite removes an asset from user's favorites.
+func (s *Service) RemoveFavorite(orgID string, userID string, assetID string) error {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	// Remove favorite
+	success, err := s.storage.RemoveFromFavorites(orgID, userID, assetID)
+	if err != nil {
+		return fmt.Errorf("error removing favorite: %w", err)
+	}
+	if !success {
+		return ErrAssetNotInFavorites
+	}
+
+	s.invalidateFavorites(userID)
+	s.notify(Event{
+		Type:      EventFavoriteRemoved,
+		UserID:    userID,
+		AssetID:   assetID,
+		Timestamp: time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// RestoreFavorite brings back a favorite removed within FavoriteRestoreWindow.
+func (s *Service) RestoreFavorite(orgID string, userID string, assetID string) (*Favorite, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	restored, err := s.storage.RestoreFavorite(orgID, userID, assetID, time.Now().Add(-FavoriteRestoreWindow))
+	if err != nil {
+		return nil, fmt.Errorf("error restoring favorite: %w", err)
+	}
+	if !restored {
+		return nil, ErrNoRemovedFavorite
+	}
+
+	s.invalidateFavorites(userID)
+
+	// Get the restored favorite to return full object, ID included
+	favorite, err := s.storage.GetFavorite(orgID, userID, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching favorite: %w", err)
+	}
+	if favorite == nil {
+		return nil, ErrNoRemovedFavorite
+	}
+
+	s.notify(Event{
+		Type:      EventFavoriteAdded,
+		UserID:    userID,
+		AssetID:   assetID,
+		Favorite:  favorite,
+		Timestamp: time.Now().UTC(),
+	})
+
+	return favorite, nil
+}
+
+// ListDeletedFavorites retrieves the user's favorites that can still be
+// restored, most recently removed first.
+func (s *Service) ListDeletedFavorites(orgID string, userID string, page int, limit int) (*PaginatedResponse, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate and constrain pagination
+	limit, err = s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+
+	favorites, total, err := s.storage.GetDeletedFavorites(orgID, userID, time.Now().Add(-FavoriteRestoreWindow), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching deleted favorites: %w", err)
+	}
+
+	return &PaginatedResponse{
+		Favorites:  favorites,
+		Pagination: newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// CreateWebhook registers a webhook notified when the user's favorites change.
+func (s *Service) CreateWebhook(orgID string, userID string, webhookURL string, secret string) (*Webhook, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+
+	webhook, err := s.storage.CreateWebhook(orgID, userID, webhookURL, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// ListWebhooks returns the webhooks registered by a user.
+func (s *Service) ListWebhooks(orgID string, userID string) ([]*Webhook, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	webhooks, err := s.storage.ListWebhooks(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook unregisters one of a user's webhooks.
+func (s *Service) DeleteWebhook(orgID string, userID string, webhookID string) error {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	success, err := s.storage.DeleteWebhook(orgID, userID, webhookID)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if !success {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// CreateAPIKey issues a new API key for a user.
+// Returns the stored key and the plaintext value, which is never retrievable again.
+func (s *Service) CreateAPIKey(orgID string, userID string, rateLimitRPS int, expiresAt *time.Time) (*APIKey, string, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, "", ErrUserNotFound
+	}
+
+	if rateLimitRPS == 0 {
+		rateLimitRPS = DefaultAPIKeyRateLimit
+	}
+	if rateLimitRPS < 1 || rateLimitRPS > MaxAPIKeyRateLimit {
+		return nil, "", ErrInvalidRateLimit
+	}
+
+	// 32 random bytes; the prefix makes leaked keys easy to grep for
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("error generating api key: %w", err)
+	}
+	plaintext := "gwi_" + hex.EncodeToString(secret)
+
+	key, err := s.storage.CreateAPIKey(orgID, userID, hashAPIKey(plaintext), rateLimitRPS, expiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating api key: %w", err)
+	}
+
+	return key, plaintext, nil
+}
+
+// AuthenticateAPIKey resolves a plaintext API key.
+// Returns nil if the key is unknown or expired.
+func (s *Service) AuthenticateAPIKey(plaintext string) (*APIKey, error) {
+	key, err := s.storage.GetAPIKeyByHash(hashAPIKey(plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api key: %w", err)
+	}
+	if key == nil {
+		return nil, nil
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, nil
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns all API keys (without their values).
+func (s *Service) ListAPIKeys(orgID string) ([]*APIKey, error) {
+	keys, err := s.storage.ListAPIKeys(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey revokes an API key.
+func (s *Service) DeleteAPIKey(orgID string, keyID string) error {
+	success, err := s.storage.DeleteAPIKey(orgID, keyID)
+	if err != nil {
+		return fmt.Errorf("error deleting api key: %w", err)
+	}
+	if !success {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// hashAPIKey returns the hex SHA-256 of a plaintext API key.
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListAuditLog retrieves the organization's audit log, newest first, with pagination.
+func (s *Service) ListAuditLog(orgID string, page int, limit int) (map[string]interface{}, error) {
+	// Validate and constrain pagination
+	limit, err := s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+
+	entries, total, err := s.storage.ListAuditLog(orgID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching audit log: %w", err)
+	}
+
+	return map[string]interface{}{
+		"entries":    entries,
+		"pagination": newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// GetUserActivity retrieves a user's audit trail, newest first.
+func (s *Service) GetUserActivity(orgID string, userID string, page int, limit int) (map[string]interface{}, error) {
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	// Validate and constrain pagination
+	limit, err = s.clampLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	offset := (page - 1) * limit
+
+	events, total, err := s.storage.GetUserActivity(orgID, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user activity: %w", err)
+	}
+
+	return map[string]interface{}{
+		"activity":   events,
+		"pagination": newPaginationInfo(page, limit, total),
+	}, nil
+}
+
+// RecordRequestMetric queues a completed request's metric for SLO tracking.
+func (s *Service) RecordRequestMetric(metric *RequestMetric) {
+	s.storage.RecordRequestMetric(metric)
+}
+
+// GetEndpointSLOs returns p50/p95/p99 latencies per endpoint over the last
+// hours hours.
+func (s *Service) GetEndpointSLOs(hours int) ([]*EndpointSLO, error) {
+	if hours < 1 || hours > MaxSLOWindowHours {
+		return nil, ErrInvalidSLOHours
+	}
+
+	slos, err := s.storage.GetEndpointSLOs(hours)
+	if err != nil {
+		return nil, fmt.Errorf("error computing endpoint SLOs: %w", err)
+	}
+	return slos, nil
+}
+
+// SubscribeFavorites registers for real-time changes to a user's favorites.
+// Callers must Unsubscribe with the returned ID when done.
+func (s *Service) SubscribeFavorites(orgID string, userID string) (string, <-chan Event, error) {
+	if s.broker == nil {
+		return "", nil, fmt.Errorf("streaming not available")
+	}
+
+	// Validate user exists
+	exists, err := s.storage.UserExists(orgID, userID)
+	if err != nil {
+		return "", nil, fmt.Errorf("error checking user: %w", err)
+	}
+	if !exists {
+		return "", nil, ErrUserNotFound
+	}
+
+	id, events := s.broker.Subscribe(userID)
+	return id, events, nil
+}
+
+// UnsubscribeFavorites stops delivery to a subscription from SubscribeFavorites.
+func (s *Service) UnsubscribeFavorites(id string) {
+	s.broker.Unsubscribe(id)
+}
+
+// ============================================================================
+// HTTP HANDLERS
+// ============================================================================
+
+// RequestHandler holds dependencies for all HTTP handlers.
+// storage is used directly only for infrastructure checks (health);
+// everything else goes through service.
+type RequestHandler struct {
+	service         *Service
+	storage         *Storage
+	shareLinkTTL    time.Duration // zero means DefaultShareLinkTTL
+	defaultPageSize int           // zero means DefaultPageSize
+	heartbeat       *Heartbeat    // nil means GET /api/v1/livez always fails
+}
+
+// Helper to send error responses with proper status codes.
+func (h *RequestHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	writeError(w, statusCode, message)
+}
+
+// writeError writes a ProblemDetail. Shared by handlers and middleware,
+// which have no RequestHandler.
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ProblemDetail{
+		Type:   problemType(message),
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: message,
+		Error:  message,
+	})
+}
+
+// problemType turns an error message into a problem type URI,
+// e.g. "user not found" becomes ProblemTypeBaseURI + "user-not-found".
+func problemType(message string) string {
+	slug := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(message))
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	return ProblemTypeBaseURI + strings.Trim(slug, "-")
+}
+
+// Helper to send JSON responses.
+func (h *RequestHandler) sendJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+// parsePagination reads page and limit from the query string, falling back
+// to the X-Page-Number and X-Page-Size headers for gateways that can't add
+// query parameters. Missing or invalid values default to page 1 and the
+// configured default page size; the service clamps the rest.
+func (h *RequestHandler) parsePagination(r *http.Request) (page int, limit int) {
+	value := func(param string, header string) int {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			raw = r.Header.Get(header)
+		}
+		n, _ := strconv.Atoi(raw)
+		return n
+	}
+
+	page = value("page", "X-Page-Number")
+	if page == 0 {
+		page = 1
+	}
+
+	limit = value("limit", "X-Page-Size")
+	if limit == 0 {
+		limit = h.defaultPageSize
+	}
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	return page, limit
+}
+
+// setPaginationLinks sets an RFC 5988 Link header with the next and prev
+// pages of a list response, keeping the request's other query parameters.
+// Cursor pages (TotalPages -1) link to the next page by before instead of page.
+func setPaginationLinks(w http.ResponseWriter, r *http.Request, pagination PaginationInfo) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	link := func(rel string, set func(query url.Values)) string {
+		query := r.URL.Query()
+		// The limit may have come from X-Page-Size; put it in the URL so the link stands alone
+		query.Set("limit", strconv.Itoa(pagination.Limit))
+		set(query)
+		target := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel)
+	}
+
+	var links []string
+	cursor := pagination.TotalPages < 0
+	if pagination.HasNext {
+		if cursor && pagination.NextBefore != nil {
+			links = append(links, link("next", func(query url.Values) {
+				query.Del("page")
+				query.Set("before", pagination.NextBefore.UTC().Format(time.RFC3339Nano))
+				query.Del("before_id")
+				if pagination.NextBeforeID != "" {
+					query.Set("before_id", pagination.NextBeforeID)
+				}
+			}))
+		} else if !cursor {
+			links = append(links, link("next", func(query url.Values) {
+				query.Set("page", strconv.Itoa(pagination.Page+1))
+			}))
+		}
+	}
+	// A cursor page can't be walked back
+	if pagination.HasPrev && !cursor {
+		links = append(links, link("prev", func(query url.Values) {
+			query.Set("page", strconv.Itoa(pagination.Page-1))
+		}))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// responseCapture passes writes through to the client while keeping a copy
+// of the status code and body, so a handler's output can be inspected afterwards.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseCapture(w http.ResponseWriter) *responseCapture {
+	return &responseCapture{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (c *responseCapture) WriteHeader(statusCode int) {
+	c.status = statusCode
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// ============================================================================
+// USER HANDLERS
+// ============================================================================
+
+// CreateUser handles POST /api/v1/users
+func (h *RequestHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	// Create new user
+	result, err := h.service.CreateUser(orgID)
+	if err != nil {
+		log.Printf("Error creating user: %v", err)
+		h.sendError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, result)
+}
+
+// ListUsers handles GET /api/v1/users
+func (h *RequestHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	// Fetch users
+	result, err := h.service.ListUsers(orgID, page, limit)
+	if err != nil {
+		if errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error listing users: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	setPaginationLinks(w, r, result["pagination"].(PaginationInfo))
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// GetUser handles GET /api/v1/users/{userID}
+func (h *RequestHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	user, err := h.service.GetUser(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching user: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, user)
+}
+
+// SearchUsers handles GET /api/v1/users/search
+// Query: q (required), matched against display name and email.
+func (h *RequestHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	result, err := h.service.SearchUsers(orgID, r.URL.Query().Get("q"), page, limit)
+	if err != nil {
+		if errors.Is(err, ErrSearchQueryRequired) || errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error searching users: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	setPaginationLinks(w, r, result["pagination"].(PaginationInfo))
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// UpdateUser handles PUT /api/v1/users/{userID}
+// Body: {"display_name": "...", "email": "..."}; a missing, null or "" field is cleared.
+func (h *RequestHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	var req struct {
+		DisplayName *string `json:"display_name"`
+		Email       *string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.service.UpdateUser(orgID, userID, req.DisplayName, req.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrDisplayNameTooLong) || errors.Is(err, ErrEmailTooLong) || errors.Is(err, ErrInvalidEmail) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error updating user: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, user)
+}
+
+// ============================================================================
+// USER DELETE HANDLER
+// ============================================================================
+
+// DeleteUser handles DELETE /api/v1/users/{userID}
+func (h *RequestHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Delete user
+	err := h.service.DeleteUser(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error deleting user: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================================
+// ASSET HANDLERS
+// ============================================================================
+
+// CreateAsset handles POST /api/v1/assets
+func (h *RequestHandler) CreateAsset(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	// Parse request body
+	var req struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+		Tags []string        `json:"tags"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Type == "" {
+		h.sendError(w, http.StatusBadRequest, "type is required")
+		return
+	}
+
+	// An explicit "data": null decodes to the literal null, not an empty message
+	if len(req.Data) == 0 || string(req.Data) == "null" {
+		h.sendError(w, http.StatusBadRequest, "data is required")
+		return
+	}
+
+	// Create asset
+	asset, err := h.service.CreateAsset(orgID, req.Type, req.Data, req.Tags)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAssetType) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error creating asset: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, asset)
+}
+
+// BulkCreateAssets handles POST /api/v1/assets/bulk
+// Body: [{"type": "...", "data": {...}, "tags": [...]}, ...] (at most 50).
+// Response: {"ids": [...]} in the order of the request.
+func (h *RequestHandler) BulkCreateAssets(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+
+	var items []BulkAssetInput
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ids, err := h.service.BulkCreateAssets(orgID, items)
+	if err != nil {
+		if errors.Is(err, ErrTooManyAssets) {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("at most %d assets per request", MaxBulkAssets))
+		} else if errors.Is(err, ErrNoAssets) || errors.Is(err, ErrInvalidAssetType) ||
+			errors.Is(err, ErrAssetDataRequired) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error bulk creating assets: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, map[string]interface{}{"ids": ids})
+}
+
+// ListAssets handles GET /api/v1/assets
+func (h *RequestHandler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	// type may be repeated (?type=chart&type=insight) to match any of them
+	assetTypes := r.URL.Query()["type"]
+
+	tag := r.URL.Query().Get("tags")
+	var tagPtr *string
+	if tag != "" {
+		tagPtr = &tag
+	}
+
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	var searchPtr *string
+	if search != "" {
+		searchPtr = &search
+	}
+
+	sort := r.URL.Query().Get("sort")
+
+	// Fetch assets
+	result, err := h.service.ListAssets(orgID, page, limit, assetTypes, tagPtr, searchPtr, sort)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAssetType) || errors.Is(err, ErrInvalidSort) || errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error listing assets: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	setPaginationLinks(w, r, result["pagination"].(PaginationInfo))
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// GetAsset handles GET /api/v1/assets/{assetID}
+// ?fields=id,type,data.title returns only those fields.
+func (h *RequestHandler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	asset, err := h.service.GetAsset(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching asset: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	fields := splitList(r.URL.Query().Get("fields"))
+	w.Header().Set("ETag", AssetETag(asset))
+	h.sendJSON(w, http.StatusOK, ProjectAsset(asset, fields))
+}
+
+// GetChartData handles GET /api/v1/assets/{assetID}/chart-data
+func (h *RequestHandler) GetChartData(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	chart, err := h.service.GetChartData(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrNotAChart) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrInvalidChartData) {
+			h.sendError(w, http.StatusUnprocessableEntity, err.Error())
+		} else {
+			log.Printf("Error fetching chart data: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, chart)
+}
+
+// GetInsightText handles GET /api/v1/assets/{assetID}/insight-text
+// The text is sent as text/plain for copy-paste flows; errors are still JSON.
+func (h *RequestHandler) GetInsightText(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	text, err := h.service.GetInsightText(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrNotAnInsight) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrInsightHasNoText) {
+			h.sendError(w, http.StatusUnprocessableEntity, err.Error())
+		} else {
+			log.Printf("Error fetching insight text: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, text)
+}
+
+// GetAudienceSize handles GET /api/v1/assets/{assetID}/audience-size
+// Responds with {"size": 1234567}.
+func (h *RequestHandler) GetAudienceSize(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	size, err := h.service.GetAudienceSize(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrNotAnAudience) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrAudienceHasNoSize) || errors.Is(err, ErrAudienceSizeNotInteger) {
+			h.sendError(w, http.StatusUnprocessableEntity, err.Error())
+		} else {
+			log.Printf("Error fetching audience size: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]int64{"size": size})
+}
+
+// DownloadAsset handles GET /api/v1/assets/{assetID}/download
+// Streams the file at a chart's download_url with the Content-Type it was
+// served with. The upstream content is untrusted, so it is sent as an
+// attachment that browsers must neither sniff nor run scripts in.
+func (h *RequestHandler) DownloadAsset(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	resp, err := h.service.OpenAssetDownload(r.Context(), orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrNotAChart) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrNoDownloadURL) || errors.Is(err, ErrInvalidDownloadURL) {
+			h.sendError(w, http.StatusUnprocessableEntity, err.Error())
+		} else if errors.Is(err, ErrDownloadFailed) {
+			log.Printf("Error downloading asset %s: %v", assetID, err)
+			h.sendError(w, http.StatusBadGateway, "download failed")
+		} else {
+			log.Printf("Error fetching asset download: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	// A large file can outlast the server's WriteTimeout; lift it for this response only
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not clear write deadline for download: %v", err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure here can only be logged
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("Error streaming download of asset %s: %v", assetID, err)
+	}
+}
+
+// PatchAsset handles PATCH /api/v1/assets/{assetID}
+// The body is a JSON merge patch for the asset's data. An If-Match header
+// that doesn't match the current ETag gets 409.
+func (h *RequestHandler) PatchAsset(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	var patch json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	asset, err := h.service.PatchAsset(orgID, assetID, patch, r.Header.Get("If-Match"))
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrETagMismatch) {
+			h.sendError(w, http.StatusConflict, err.Error())
+		} else if errors.Is(err, ErrInvalidPatch) || errors.Is(err, ErrInvalidAssetData) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error patching asset: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", AssetETag(asset))
+	h.sendJSON(w, http.StatusOK, asset)
+}
+
+// GetAssetVersions handles GET /api/v1/assets/{assetID}/versions
+func (h *RequestHandler) GetAssetVersions(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	versions, err := h.service.GetAssetVersions(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching asset versions: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"versions": versions,
+	})
+}
+
+// GetAssetVersion handles GET /api/v1/assets/{assetID}/versions/{version}
+func (h *RequestHandler) GetAssetVersion(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		h.sendError(w, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
+	result, err := h.service.GetAssetVersion(orgID, assetID, version)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) || errors.Is(err, ErrVersionNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching asset version: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// RestoreAssetVersion handles PUT /api/v1/assets/{assetID}/versions/{version}/restore
+func (h *RequestHandler) RestoreAssetVersion(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		h.sendError(w, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
+	asset, err := h.service.RestoreAssetVersion(orgID, assetID, version)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) || errors.Is(err, ErrVersionNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error restoring asset version: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", AssetETag(asset))
+	h.sendJSON(w, http.StatusOK, asset)
+}
+
+// GetSimilarAssets handles GET /api/v1/assets/{assetID}/similar
+func (h *RequestHandler) GetSimilarAssets(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	assets, err := h.service.GetSimilarAssets(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching similar assets: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, assets)
+}
+
+// DeleteAsset handles DELETE /api/v1/assets/{assetID}
+func (h *RequestHandler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	assetID := vars["assetID"]
+
+	// Delete asset
+	favoritesRemoved, err := h.service.DeleteAsset(orgID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error deleting asset: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"asset_id":          assetID,
+		"favorites_removed": favoritesRemoved,
+	})
+}
+
+// BulkDeleteAssets handles DELETE /api/v1/assets/bulk
+// Body: {"asset_ids": [...]} (at most 50). Responds 207 Multi-Status listing
+// the missing IDs when some weren't found; the others are still deleted.
+func (h *RequestHandler) BulkDeleteAssets(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+
+	var req struct {
+		AssetIDs []string `json:"asset_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.service.BulkDeleteAssets(orgID, req.AssetIDs)
+	if err != nil {
+		if errors.Is(err, ErrTooManyAssetIDs) {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("at most %d asset_ids per request", MaxBulkAssets))
+		} else if errors.Is(err, ErrNoAssetIDs) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error bulk deleting assets: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if len(result.Missing) > 0 {
+		status = http.StatusMultiStatus
+	}
+	h.sendJSON(w, status, result)
+}
+
+// ============================================================================
+// FAVORITE HANDLERS
+// ============================================================================
+
+// GetFavorites handles GET /api/v1/users/{userID}/favorites
+// Responds with a JSON page, or with every matching favorite as CSV when the
+// Accept header asks for text/csv.
+func (h *RequestHandler) GetFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	assetType := r.URL.Query().Get("type")
+	if assetType == "" {
+		assetType = ""
+	} else if !ValidAssetTypes.IsValid(assetType) {
+		h.sendError(w, http.StatusBadRequest, "invalid asset type")
+		return
+	}
+
+	// sort=asset_type,added_at&order=asc,desc sorts by several fields
+	sort := r.URL.Query().Get("sort")
+	order := r.URL.Query().Get("order")
+
+	// Cursor for infinite scroll: the next_before and next_before_id of the
+	// previous page. before alone still works, but may skip favorites that
+	// share the last added_at.
+	var before *FavoriteCursor
+	if value := r.URL.Query().Get("before"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "before must be an RFC3339 timestamp")
+			return
+		}
+		before = &FavoriteCursor{AddedAt: parsed}
+	}
+	if value := r.URL.Query().Get("before_id"); value != "" {
+		if before == nil {
+			h.sendError(w, http.StatusBadRequest, "before_id requires before")
+			return
+		}
+		if _, err := uuid.Parse(value); err != nil {
+			h.sendError(w, http.StatusBadRequest, "before_id must be a favorite ID")
+			return
+		}
+		before.ID = value
+	}
+
+	// Spreadsheet clients get every matching favorite as CSV instead of a page
+	if acceptsMediaType(r.Header.Get("Accept"), "text/csv") {
+		h.exportFavoritesCSV(w, orgID, userID, &assetType, sort, order)
+		return
+	}
+
+	// Fetch favorites
+	result, err := h.service.GetFavorites(orgID, userID, page, limit, &assetType, sort, order, before)
+	if err != nil {
+		if isFavoriteSortError(err) || errors.Is(err, ErrBeforeRequiresNewest) ||
+			errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	setPaginationLinks(w, r, result.Pagination)
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// isFavoriteSortError reports whether err is ParseFavoriteSort rejecting
+// the sort or order of a request.
+func isFavoriteSortError(err error) bool {
+	return errors.Is(err, ErrInvalidSort) || errors.Is(err, ErrInvalidOrder) ||
+		errors.Is(err, ErrOrderWithoutSort) || errors.Is(err, ErrSortOrderMismatch)
+}
+
+// favoritesCSVHeader is the first row of a favorites CSV export.
+var favoritesCSVHeader = []string{"id", "asset_id", "asset_type", "description", "notes", "added_at", "asset_data"}
+
+// exportFavoritesCSV streams all of a user's favorites as CSV.
+// Headers are only sent with the first row, so validation errors still get
+// a JSON error response; a failure after that truncates the download.
+func (h *RequestHandler) exportFavoritesCSV(w http.ResponseWriter, orgID string, userID string, assetType *string, sort string, order string) {
+	cw := csv.NewWriter(w)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="favorites.csv"`)
+		w.WriteHeader(http.StatusOK)
+		return cw.Write(favoritesCSVHeader)
+	}
+
+	err := h.service.ExportFavorites(orgID, userID, assetType, sort, order, func(favorite *Favorite) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		description := ""
+		if favorite.DescriptionOverride != nil {
+			description = *favorite.DescriptionOverride
+		}
+		notes := ""
+		if favorite.Notes != nil {
+			notes = *favorite.Notes
+		}
+		return cw.Write([]string{
+			favorite.ID,
+			favorite.Asset.ID,
+			favorite.Asset.Type,
+			description,
+			notes,
+			favorite.AddedAt.UTC().Format(time.RFC3339),
+			string(favorite.Asset.Data),
+		})
+	})
+	if err == nil && !started {
+		// No favorites: still send the header row
+		err = start()
+	}
+	if err != nil {
+		if started {
+			log.Printf("Error exporting favorites: %v", err)
+		} else if isFavoriteSortError(err) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error exporting favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error exporting favorites: %v", err)
+	}
+}
+
+// ExportFavoritesNDJSON handles GET /api/v1/users/{userID}/favorites/export/json-lines
+// Streams every favorite, newest first, as one JSON object per line.
+// Like the CSV export, headers are only sent with the first favorite, so
+// validation errors still get a JSON error response.
+func (h *RequestHandler) ExportFavoritesNDJSON(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	assetType := r.URL.Query().Get("type")
+	if assetType != "" && !ValidAssetTypes.IsValid(assetType) {
+		h.sendError(w, http.StatusBadRequest, "invalid asset type")
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="favorites.ndjson"`)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	err := h.service.StreamFavorites(orgID, userID, &assetType, func(favorite *Favorite) error {
+		if !started {
+			start()
+		}
+		return encoder.Encode(favorite)
+	})
+	if err == nil && !started {
+		// No favorites: an empty stream
+		start()
+	}
+	if err != nil {
+		if started {
+			log.Printf("Error exporting favorites: %v", err)
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error exporting favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+	}
+}
+
+// ImportFavoritesNDJSON handles POST /api/v1/users/{userID}/favorites/import/json-lines
+// The body is NDJSON as produced by the json-lines export, at most MaxImportBytes.
+func (h *RequestHandler) ImportFavoritesNDJSON(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Without a Content-Length the limit is enforced while reading
+	if r.ContentLength > MaxImportBytes {
+		h.sendError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("import must be at most %d bytes", MaxImportBytes))
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, MaxImportBytes)
+
+	result, err := h.service.ImportFavorites(orgID, userID, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.sendError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("import must be at most %d bytes", MaxImportBytes))
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if result != nil {
+			// Earlier batches were committed; report what was imported
+			log.Printf("Error importing favorites: %v", err)
+			result.Error = "internal server error"
+			h.sendJSON(w, http.StatusInternalServerError, result)
+		} else {
+			log.Printf("Error importing favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// acceptsMediaType reports whether an Accept or Accept-Encoding header
+// lists value, such as "text/csv" or "gzip". A zero weight ("gzip;q=0")
+// explicitly refuses it.
+func acceptsMediaType(header string, value string) bool {
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), value) {
+			continue
+		}
+		for _, param := range params[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				weight, err := strconv.ParseFloat(q, 64)
+				return err != nil || weight > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// AddFavorite handles POST /api/v1/users/{userID}/favorites
+// Clients may send an Idempotency-Key header so retries on flaky networks
+// replay the first response instead of adding the favorite again.
+func (h *RequestHandler) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		h.addFavorite(w, r)
+		return
+	}
+
+	if len(key) > MaxIdempotencyKeyLength {
+		h.sendError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+		return
+	}
+
+	// Replay the stored response for a retry
+	cached, err := h.service.GetIdempotentResponse(userID, key)
+	if err != nil {
+		log.Printf("Error checking idempotency key: %v", err)
+		h.sendError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if cached != nil {
+		// Stored 4xx responses are problem details
+		if cached.StatusCode >= 400 {
+			w.Header().Set("Content-Type", "application/problem+json")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(cached.StatusCode)
+		w.Write(cached.Body)
+		return
+	}
+
+	capture := newResponseCapture(w)
+	h.addFavorite(capture, r)
+
+	// Server errors are not stored so the client can retry them
+	if capture.status < 500 {
+		if err := h.service.SaveIdempotentResponse(userID, key, capture.status, capture.body.Bytes()); err != nil {
+			log.Printf("Error saving idempotency key: %v", err)
+		}
+	}
+}
+
+// addFavorite does the actual work of AddFavorite.
+func (h *RequestHandler) addFavorite(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Parse request body
+	var req struct {
+		AssetID     string `json:"asset_id"`
+		Description string `json:"description"`
+		Notes       string `json:"notes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.AssetID == "" {
+		h.sendError(w, http.StatusBadRequest, "asset_id is required")
+		return
+	}
+
+	// Add favorite
+	var description *string
+	if req.Description != "" {
+		description = &req.Description
+	}
+	var notes *string
+	if req.Notes != "" {
+		notes = &req.Notes
+	}
+
+	favorite, restored, err := h.service.AddFavorite(orgID, userID, req.AssetID, description, notes)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrAlreadyFavorited) {
+			h.sendError(w, http.StatusConflict, err.Error())
+		} else {
+			log.Printf("Error adding favorite: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Restoring a removed favorite is not a new resource
+	if restored {
+		h.sendJSON(w, http.StatusOK, favorite)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, favorite)
+}
+
+// GetFavoriteGroups handles GET /api/v1/users/{userID}/favorites/groups
+func (h *RequestHandler) GetFavoriteGroups(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	perGroup, _ := strconv.Atoi(r.URL.Query().Get("per_group"))
+	if perGroup == 0 {
+		perGroup = DefaultFavoritesPerGroup
+	}
+
+	groups, err := h.service.GetFavoritesGrouped(orgID, userID, perGroup)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching grouped favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, groups)
+}
+
+// GetMostRecentFavoritePerType handles GET /api/v1/users/{userID}/favorites/most-recent-per-type
+// Responds with {"chart": <Favorite|null>, "insight": ..., ...}, one key per asset type.
+func (h *RequestHandler) GetMostRecentFavoritePerType(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	latest, err := h.service.GetMostRecentFavoritePerType(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching most recent favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, latest)
+}
+
+// SearchFavorites handles GET /api/v1/users/{userID}/favorites/search?q=...
+func (h *RequestHandler) SearchFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	result, err := h.service.SearchFavorites(orgID, userID, r.URL.Query().Get("q"), page, limit)
+	if err != nil {
+		if errors.Is(err, ErrSearchQueryRequired) || errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error searching favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	setPaginationLinks(w, r, result.Pagination)
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// ListDeletedFavorites handles GET /api/v1/users/{userID}/favorites/deleted
+// Lists removed favorites that can still be restored, with their deleted_at.
+func (h *RequestHandler) ListDeletedFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	result, err := h.service.ListDeletedFavorites(orgID, userID, page, limit)
+	if err != nil {
+		if errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error listing deleted favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	setPaginationLinks(w, r, result.Pagination)
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// GetRandomFavorite handles GET /api/v1/users/{userID}/favorites/random
+func (h *RequestHandler) GetRandomFavorite(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	favorite, err := h.service.GetRandomFavorite(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrNoFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching random favorite: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, favorite)
+}
+
+// GetFavoriteAssetTypes handles GET /api/v1/users/{userID}/favorites/asset-types
+func (h *RequestHandler) GetFavoriteAssetTypes(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	types, err := h.service.GetFavoriteAssetTypes(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorite asset types: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string][]string{"types": types})
+}
+
+// CompareFavorites handles GET /api/v1/users/{userID}/favorites/compare/{otherUserID}
+// Only the two users compared may see their shared favorites.
+func (h *RequestHandler) CompareFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	otherUserID := vars["otherUserID"]
+
+	// The auth middleware already ties userID to the caller; this keeps the
+	// rule local in case the route is ever mounted elsewhere
+	if requester, ok := AuthenticatedUserID(r.Context()); ok && requester != userID && requester != otherUserID {
+		h.sendError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	assets, err := h.service.CompareFavorites(orgID, userID, otherUserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error comparing favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, assets)
+}
+
+// GetFavoriteStats handles GET /api/v1/users/{userID}/favorites/stats
+func (h *RequestHandler) GetFavoriteStats(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	stats, err := h.service.GetFavoriteStats(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorite stats: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, stats)
+}
+
+// GetFavoriteBadges handles GET /api/v1/users/{userID}/favorites/badges
+func (h *RequestHandler) GetFavoriteBadges(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	badges, err := h.service.GetFavoriteBadges(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorite badges: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, badges)
+}
+
+// GetFavoritesTimeline handles GET /api/v1/users/{userID}/favorites/timeline
+func (h *RequestHandler) GetFavoritesTimeline(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days == 0 {
+		days = DefaultTimelineDays
+	}
+	perDay, _ := strconv.Atoi(r.URL.Query().Get("per_day"))
+	if perDay == 0 {
+		perDay = DefaultTimelinePerDay
+	}
+
+	timeline, err := h.service.GetFavoritesTimeline(orgID, userID, days, perDay)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorites timeline: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, timeline)
+}
+
+// GetFavoriteCalendar handles GET /api/v1/users/{userID}/favorites/calendar-heatmap
+// The year query parameter defaults to the current year (UTC).
+func (h *RequestHandler) GetFavoriteCalendar(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	year := time.Now().UTC().Year()
+	if value := r.URL.Query().Get("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "year must be an integer")
+			return
+		}
+		year = parsed
+	}
+
+	calendar, err := h.service.GetFavoriteCalendar(orgID, userID, year)
+	if err != nil {
+		if errors.Is(err, ErrInvalidYear) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorite calendar: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, calendar)
+}
+
+// RecommendedFavorites handles GET /api/v1/users/{userID}/favorites/recommended
+func (h *RequestHandler) RecommendedFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit == 0 {
+		limit = DefaultRecommendationsLimit
+	}
+
+	assets, err := h.service.RecommendedFavorites(orgID, userID, limit)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching recommended favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, assets)
+}
+
+// GetTrending handles GET /api/v1/trending
+// Query: hours (window, default 24) and limit (default 10).
+func (h *RequestHandler) GetTrending(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+
+	hours, _ := strconv.Atoi(r.URL.Query().Get("hours"))
+	if hours == 0 {
+		hours = DefaultTrendingHours
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit == 0 {
+		limit = DefaultTrendingLimit
+	}
+
+	trending, err := h.service.GetTrending(orgID, hours, limit)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTrendingHours) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error fetching trending assets: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, trending)
+}
+
+// GetFavorite handles GET /api/v1/users/{userID}/favorites/{assetID}
+// An asset ID that isn't a UUID, such as a mistyped sub-route, can't be a
+// favorite and gets 404 without querying the database.
+func (h *RequestHandler) GetFavorite(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	if _, err := uuid.Parse(assetID); err != nil {
+		h.sendError(w, http.StatusNotFound, ErrAssetNotInFavorites.Error())
+		return
+	}
+
+	favorite, err := h.service.GetFavorite(orgID, userID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching favorite: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, favorite)
+}
+
+// UpdateFavorite handles PUT /api/v1/users/{userID}/favorites/{assetID}
+func (h *RequestHandler) UpdateFavorite(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	// Parse request body
+	var req struct {
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// A blank description would show as an empty label in the list
+	if strings.TrimSpace(req.Description) == "" {
+		h.sendError(w, http.StatusBadRequest, "description is required")
+		return
+	}
+
+	// Update favorite
+	favorite, err := h.service.UpdateFavoriteDescription(orgID, userID, assetID, req.Description)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error updating favorite: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, favorite)
+}
+
+// UpdateFavoriteNotes handles PATCH /api/v1/users/{userID}/favorites/{assetID}/notes
+// Body: {"notes": "..."}; null or "" clears the notes.
+func (h *RequestHandler) UpdateFavoriteNotes(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	var req struct {
+		Notes *string `json:"notes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	favorite, err := h.service.UpdateFavoriteNotes(orgID, userID, assetID, req.Notes)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error updating favorite notes: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, favorite)
+}
+
+// PinFavorite handles POST /api/v1/users/{userID}/favorites/{assetID}/pin
+func (h *RequestHandler) PinFavorite(w http.ResponseWriter, r *http.Request) {
+	h.setFavoritePinned(w, r, true)
+}
+
+// UnpinFavorite handles DELETE /api/v1/users/{userID}/favorites/{assetID}/pin
+func (h *RequestHandler) UnpinFavorite(w http.ResponseWriter, r *http.Request) {
+	h.setFavoritePinned(w, r, false)
+}
+
+func (h *RequestHandler) setFavoritePinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	favorite, err := h.service.SetFavoritePinned(orgID, userID, assetID, pinned)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error updating favorite pin: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, favorite)
+}
+
+// ReorderFavorites handles PUT /api/v1/users/{userID}/favorites/reorder
+// Body: [{"asset_id": "...", "order_index": 1}, ...]
+func (h *RequestHandler) ReorderFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	var order []FavoriteOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	err := h.service.ReorderFavorites(orgID, userID, order)
+	if err != nil {
+		if errors.Is(err, ErrDuplicateAssetID) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error reordering favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveFavorite handles DELETE /api/v1/users/{userID}/favorites/{assetID}
+func (h *RequestHandler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	// Remove favorite
+	err := h.service.RemoveFavorite(orgID, userID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error removing favorite: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreFavorite handles POST /api/v1/users/{userID}/favorites/{assetID}/restore
+// Undoes a removal made within the last FavoriteRestoreWindow.
+func (h *RequestHandler) RestoreFavorite(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	favorite, err := h.service.RestoreFavorite(orgID, userID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrNoRemovedFavorite) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error restoring favorite: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, favorite)
+}
+
+// RemoveAllFavorites handles DELETE /api/v1/users/{userID}/favorites
+func (h *RequestHandler) RemoveAllFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	removed, err := h.service.RemoveAllFavorites(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error removing all favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]int{"removed": removed})
+}
+
+// StreamFavorites handles GET /api/v1/users/{userID}/favorites/stream
+// Server-sent events: each favorite change is written as
+//
+//	event: favorite_added
+//	data: {...Event JSON...}
+//
+// The stream stays open until the client disconnects.
+func (h *RequestHandler) StreamFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.sendError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	id, events, err := h.service.SubscribeFavorites(orgID, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error subscribing to favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	defer h.service.UnsubscribeFavorites(id)
+
+	// The server's WriteTimeout would cut the stream; lift it for this response only
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not clear write deadline for stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep idle connections open through proxies
+	keepAlive := time.NewTicker(StreamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// Client disconnected
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// GetFavoriteHistory handles GET /api/v1/users/{userID}/favorites/{assetID}/history
+func (h *RequestHandler) GetFavoriteHistory(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	history, err := h.service.GetDescriptionHistory(orgID, userID, assetID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrAssetNotInFavorites) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error fetching description history: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"history": history,
+	})
+}
+
+// FavoriteExists handles GET /api/v1/users/{userID}/favorites/{assetID}/exists
+// The status code alone answers the question: 200 if favorited, 404 if not.
+// An asset ID that isn't a UUID is never favorited, so it gets 404 without a query.
+func (h *RequestHandler) FavoriteExists(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	assetID := vars["assetID"]
+
+	if _, err := uuid.Parse(assetID); err != nil {
+		h.sendJSON(w, http.StatusNotFound, map[string]bool{"favorited": false})
+		return
+	}
+
+	favorited, err := h.service.FavoriteExists(orgID, userID, assetID)
+	if err != nil {
+		log.Printf("Error checking favorite: %v", err)
+		h.sendError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	status := http.StatusOK
+	if !favorited {
+		status = http.StatusNotFound
+	}
+	h.sendJSON(w, status, map[string]bool{"favorited": favorited})
+}
+
+// CheckFavorites handles POST /api/v1/users/{userID}/favorites/check
+// Body: {"asset_ids": [...]} (at most 100). Response: {"<asset_id>": true|false, ...}
+func (h *RequestHandler) CheckFavorites(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	var req struct {
+		AssetIDs []string `json:"asset_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
 	}
 
-	// Delete asset
-	_, err = s.storage.DeleteAsset(assetID)
+	result, err := h.service.CheckFavorites(orgID, userID, req.AssetIDs)
 	if err != nil {
-		return fmt.Errorf("error deleting asset: %w", err)
+		if errors.Is(err, ErrTooManyAssetIDs) {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("at most %d asset_ids per request", MaxCheckFavoritesIDs))
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error checking favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
 	}
 
-	return nil
+	h.sendJSON(w, http.StatusOK, result)
 }
 
-// ============================================================================
-// FAVORITES SERVICE METHODS
-// ============================================================================
+// CreateShareLink handles GET /api/v1/users/{userID}/favorites/shared-link
+// Each call issues a new token; earlier links keep working until they expire.
+func (h *RequestHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
 
-// AddFavorite adds an asset to user's favorites with validation.
-func (s *Service) AddFavorite(
-	userID string,
-	assetID string,
-	description *string,
-) (*Favorite, error) {
-	// Validate user exists
-	exists, err := s.storage.UserExists(userID)
-	if err != nil {
-		return nil, fmt.Errorf("error checking user: %w", err)
-	}
-	if !exists {
-		return nil, fmt.Errorf("user not found")
+	ttl := h.shareLinkTTL
+	if ttl == 0 {
+		ttl = DefaultShareLinkTTL
 	}
 
-	// Validate asset exists
-	asset, err := s.storage.GetAsset(assetID)
+	share, err := h.service.CreateShareLink(orgID, userID, ttl)
 	if err != nil {
-		return nil, fmt.Errorf("error getting asset: %w", err)
-	}
-	if asset == nil {
-		return nil, fmt.Errorf("asset not found")
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error creating share link: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
 	}
 
-	// Try to add to favorites
-	favoriteID, err := s.storage.AddToFavorites(userID, assetID, description)
-	if err != nil {
-		return nil, fmt.Errorf("error adding favorite: %w", err)
-	}
-	if favoriteID == "" {
-		// Empty ID means already favorited
-		return nil, fmt.Errorf("asset already in favorites")
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
 	}
 
-	return &Favorite{
-		ID:                  favoriteID,
-		UserID:              userID,
-		Asset:               asset,
-		DescriptionOverride: description,
-		AddedAt:             time.Now(),
-	}, nil
+	h.sendJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":      share.Token,
+		"url":        fmt.Sprintf("%s://%s/api/v1/shared/%s/favorites", scheme, r.Host, share.Token),
+		"expires_at": share.ExpiresAt,
+	})
 }
 
-// GetFavorites retrieves user's favorites with pagination.
-func (s *Service) GetFavorites(
-	userID string,
-	page int,
-	limit int,
-	assetType *string,
-) (*PaginatedResponse, error) {
-	// Validate user exists
-	exists, err := s.storage.UserExists(userID)
+// GetSharedFavorites handles GET /api/v1/shared/{token}/favorites
+// Public: the token itself is the credential.
+func (h *RequestHandler) GetSharedFavorites(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
+
+	result, err := h.service.GetSharedFavorites(token, page, limit)
 	if err != nil {
-		return nil, fmt.Errorf("error checking user: %w", err)
-	}
-	if !exists {
-		return nil, fmt.Errorf("user not found")
+		if errors.Is(err, ErrLimitExceeded) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrShareLinkNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrShareLinkExpired) {
+			h.sendError(w, http.StatusGone, err.Error())
+		} else {
+			log.Printf("Error fetching shared favorites: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
 	}
 
-	// Validate and constrain pagination
-	if limit < 1 {
-		limit = 1
-	}
-	if limit > MaxPageSize {
-		limit = MaxPageSize
+	setPaginationLinks(w, r, result.Pagination)
+	h.sendJSON(w, http.StatusOK, result)
+}
+
+// HealthCheck handles GET /health
+// Liveness only: reports connection pool stats without touching the database,
+// so an outage doesn't get the process restarted. See Readyz.
+func (h *RequestHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	var resp HealthResponse
+	resp.Status = "ok"
+	resp.DB.Stats = h.storage.Stats()
+
+	h.sendJSON(w, http.StatusOK, resp)
+}
+
+// Livez handles GET /api/v1/livez
+// Returns 503 once the heartbeat hasn't advanced for LivenessMaxHeartbeatAge,
+// meaning goroutines no longer get scheduled. Never touches the database.
+func (h *RequestHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	if h.heartbeat == nil {
+		h.sendJSON(w, http.StatusServiceUnavailable, LivenessResponse{Status: "stalled"})
+		return
 	}
-	if page < 1 {
-		page = 1
+
+	beats, alive := h.heartbeat.Alive(LivenessMaxHeartbeatAge)
+	if !alive {
+		log.Printf("Liveness check: no heartbeat for over %s (%d so far)", LivenessMaxHeartbeatAge, beats)
+		h.sendJSON(w, http.StatusServiceUnavailable, LivenessResponse{Status: "stalled", Heartbeats: beats})
+		return
 	}
 
-	offset := (page - 1) * limit
+	h.sendJSON(w, http.StatusOK, LivenessResponse{Status: "alive", Heartbeats: beats})
+}
 
-	// Fetch from storage
-	favorites, total, err := s.storage.GetFavorites(userID, limit, offset, assetType)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching favorites: %w", err)
-	}
+// Readyz handles GET /api/v1/readyz
+// Returns 503 until the database answers SELECT 1 within ReadinessTimeout,
+// so orchestrators stop routing traffic here before their own probe times out.
+func (h *RequestHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), ReadinessTimeout)
+	defer cancel()
 
-	// Calculate pagination metadata
-	totalPages := (total + limit - 1) / limit // Ceiling division
-	if totalPages == 0 {
-		totalPages = 1
+	if err := h.storage.Ready(ctx); err != nil {
+		log.Printf("Readiness check: database query failed: %v", err)
+		h.sendJSON(w, http.StatusServiceUnavailable, ReadinessResponse{Status: "unavailable"})
+		return
 	}
 
-	return &PaginatedResponse{
-		Favorites: favorites,
-		Pagination: PaginationInfo{
-			Page:       page,
-			Limit:      limit,
-			Total:      total,
-			TotalPages: totalPages,
-			HasNext:    page < totalPages,
-			HasPrev:    page > 1,
-		},
-	}, nil
+	h.sendJSON(w, http.StatusOK, ReadinessResponse{Status: "ready"})
 }
 
-// UpdateFavoriteDescription updates a favorite's description.
-func (s *Service) UpdateFavoriteDescription(
-	userID string,
-	assetID string,
-	description string,
-) (*Favorite, error) {
-	// Validate user exists
-	exists, err := s.storage.UserExists(userID)
-	if err != nil {
-		return nil, fmt.Errorf("error checking user: %w", err)
+// DBHealthCheck handles GET /health/db
+// Pings the database with a DBHealthTimeout deadline and reports the round trip,
+// so monitoring can watch the database separately from /health.
+func (h *RequestHandler) DBHealthCheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), DBHealthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := h.storage.Ping(ctx); err != nil {
+		log.Printf("DB health check: ping failed: %v", err)
+		h.sendJSON(w, http.StatusServiceUnavailable, DBHealthResponse{Status: "error", Error: "internal server error"})
+		return
 	}
-	if !exists {
-		return nil, fmt.Errorf("user not found")
+
+	h.sendJSON(w, http.StatusOK, DBHealthResponse{Status: "ok", LatencyMs: time.Since(start).Milliseconds()})
+}
+
+// ============================================================================
+// WEBHOOK HANDLERS
+// ============================================================================
+
+// CreateWebhook handles POST /api/v1/users/{userID}/webhooks
+func (h *RequestHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+
+	// Parse request body
+	var req struct {
+		URL    string `json:"url"`
+		Secret string `json:"secret"`
 	}
 
-	// Get current favorite to return full object
-	favorites, _, err := s.storage.GetFavorites(userID, 1000, 0, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching favorites: %w", err)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
 	}
 
-	var favorite *Favorite
-	for _, f := range favorites {
-		if f.Asset.ID == assetID {
-			favorite = f
-			break
-		}
+	if req.URL == "" {
+		h.sendError(w, http.StatusBadRequest, "url is required")
+		return
 	}
 
-	if favorite == nil {
-		return nil, fmt.Errorf("asset not in user's favorites")
+	if req.Secret == "" {
+		h.sendError(w, http.StatusBadRequest, "secret is required")
+		return
 	}
 
-	// Update description
-	success, err := s.storage.UpdateFavoriteDescription(userID, assetID, description)
+	webhook, err := h.service.CreateWebhook(orgID, userID, req.URL, req.Secret)
 	if err != nil {
-		return nil, fmt.Errorf("error updating favorite: %w", err)
-	}
-	if !success {
-		return nil, fmt.Errorf("failed to update description")
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrInvalidWebhookURL) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error creating webhook: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
 	}
 
-	// Update and return
-	favorite.DescriptionOverride = &description
-	return favorite, nil
+	h.sendJSON(w, http.StatusCreated, webhook)
 }
 
-// RemoveFavorite removes an asset from user's favorites.
-func (s *Service) RemoveFavorite(userID string, assetID string) error {
-	// Validate user exists
-	exists, err := s.storage.UserExists(userID)
-	if err != nil {
-		return fmt.Errorf("error checking user: %w", err)
-	}
-	if !exists {
-		return fmt.Errorf("user not found")
-	}
+// ListWebhooks handles GET /api/v1/users/{userID}/webhooks
+func (h *RequestHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
 
-	// Remove favorite
-	success, err := s.storage.RemoveFromFavorites(userID, assetID)
+	webhooks, err := h.service.ListWebhooks(orgID, userID)
 	if err != nil {
-		return fmt.Errorf("error removing favorite: %w", err)
-	}
-	if !success {
-		return fmt.Errorf("asset not in user's favorites")
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error listing webhooks: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
 	}
 
-	return nil
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"webhooks": webhooks,
+	})
 }
 
-// ============================================================================
-// HTTP HANDLERS
-// ============================================================================
-
-// RequestHandler holds dependencies for all HTTP handlers.
-type RequestHandler struct {
-	service *Service
-}
+// DeleteWebhook handles DELETE /api/v1/users/{userID}/webhooks/{webhookID}
+func (h *RequestHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	webhookID := vars["webhookID"]
 
-// Helper to send error responses with proper status codes.
-func (h *RequestHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
-}
+	err := h.service.DeleteWebhook(orgID, userID, webhookID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrWebhookNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else {
+			log.Printf("Error deleting webhook: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
 
-// Helper to send JSON responses.
-func (h *RequestHandler) sendJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // ============================================================================
-// USER HANDLERS
+// ADMIN HANDLERS
 // ============================================================================
 
-// CreateUser handles POST /api/v1/users
-func (h *RequestHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	// Create new user
-	result, err := h.service.CreateUser()
-	if err != nil {
-		log.Printf("Error creating user: %v", err)
-		h.sendError(w, http.StatusInternalServerError, "internal server error")
-		return
+// CreateAPIKey handles POST /api/v1/admin/api-keys
+func (h *RequestHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	// Parse request body
+	var req struct {
+		UserID       string     `json:"user_id"`
+		RateLimitRPS int        `json:"rate_limit_rps"`
+		ExpiresAt    *time.Time `json:"expires_at"`
 	}
 
-	h.sendJSON(w, http.StatusCreated, result)
-}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
 
-// ListUsers handles GET /api/v1/users
-func (h *RequestHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page == 0 {
-		page = 1
+	if req.UserID == "" {
+		h.sendError(w, http.StatusBadRequest, "user_id is required")
+		return
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit == 0 {
-		limit = DefaultPageSize
+	key, plaintext, err := h.service.CreateAPIKey(orgID, req.UserID, req.RateLimitRPS, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, ErrInvalidRateLimit) {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("rate_limit_rps must be between 1 and %d", MaxAPIKeyRateLimit))
+		} else {
+			log.Printf("Error creating api key: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
 	}
 
-	// Fetch users
-	result, err := h.service.ListUsers(page, limit)
+	// The plaintext key is only ever returned here
+	h.sendJSON(w, http.StatusCreated, map[string]interface{}{
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+// ListAPIKeys handles GET /api/v1/admin/api-keys
+func (h *RequestHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	keys, err := h.service.ListAPIKeys(orgID)
 	if err != nil {
-		log.Printf("Error listing users: %v", err)
+		log.Printf("Error listing api keys: %v", err)
 		h.sendError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
 
-	h.sendJSON(w, http.StatusOK, result)
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+	})
 }
 
-// ============================================================================
-// USER DELETE HANDLER
-// ============================================================================
-
-// DeleteUser handles DELETE /api/v1/users/{userID}
-func (h *RequestHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+// DeleteAPIKey handles DELETE /api/v1/admin/api-keys/{keyID}
+func (h *RequestHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
 	vars := mux.Vars(r)
-	userID := vars["userID"]
+	keyID := vars["keyID"]
 
-	// Delete user
-	err := h.service.DeleteUser(userID)
+	err := h.service.DeleteAPIKey(orgID, keyID)
 	if err != nil {
-		if err.Error() == "user not found" {
+		if errors.Is(err, ErrAPIKeyNotFound) {
 			h.sendError(w, http.StatusNotFound, err.Error())
 		} else {
-			log.Printf("Error deleting user: %v", err)
+			log.Printf("Error deleting api key: %v", err)
 			h.sendError(w, http.StatusInternalServerError, "internal server error")
 		}
 		return
@@ -1024,16 +8980,26 @@ func (h *RequestHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// ============================================================================
-// ASSET HANDLERS
-// ============================================================================
+// ListAssetTypes handles GET /api/v1/admin/asset-types
+func (h *RequestHandler) ListAssetTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.service.ListAssetTypes()
+	if err != nil {
+		log.Printf("Error listing asset types: %v", err)
+		h.sendError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
 
-// CreateAsset handles POST /api/v1/assets
-func (h *RequestHandler) CreateAsset(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"asset_types": types,
+	})
+}
+
+// CreateAssetType handles POST /api/v1/admin/asset-types
+func (h *RequestHandler) CreateAssetType(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req struct {
-		Type string          `json:"type"`
-		Data json.RawMessage `json:"data"`
+		Name   string          `json:"name"`
+		Schema json.RawMessage `json:"schema_json"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1041,286 +9007,890 @@ func (h *RequestHandler) CreateAsset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Type == "" {
-		h.sendError(w, http.StatusBadRequest, "type is required")
+	assetType, err := h.service.CreateAssetType(OrganizationID(r.Context()), req.Name, req.Schema)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAssetTypeName) || errors.Is(err, ErrInvalidSchemaJSON) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrAssetTypeExists) {
+			h.sendError(w, http.StatusConflict, err.Error())
+		} else {
+			log.Printf("Error creating asset type: %v", err)
+			h.sendError(w, http.StatusInternalServerError, "internal server error")
+		}
 		return
 	}
 
-	if req.Data == nil || len(req.Data) == 0 {
-		h.sendError(w, http.StatusBadRequest, "data is required")
-		return
-	}
+	h.sendJSON(w, http.StatusCreated, assetType)
+}
 
-	// Create asset
-	asset, err := h.service.CreateAsset(req.Type, req.Data)
+// ListAuditLog handles GET /api/v1/admin/audit-log
+func (h *RequestHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	// Parse query parameters
+	orgID := OrganizationID(r.Context())
+	page, limit := h.parsePagination(r)
+
+	result, err := h.service.ListAuditLog(orgID, page, limit)
 	if err != nil {
-		if err.Error() == "invalid asset type" {
+		if errors.Is(err, ErrLimitExceeded) {
 			h.sendError(w, http.StatusBadRequest, err.Error())
 		} else {
-			log.Printf("Error creating asset: %v", err)
+			log.Printf("Error listing audit log: %v", err)
 			h.sendError(w, http.StatusInternalServerError, "internal server error")
 		}
 		return
 	}
 
-	h.sendJSON(w, http.StatusCreated, asset)
+	setPaginationLinks(w, r, result["pagination"].(PaginationInfo))
+	h.sendJSON(w, http.StatusOK, result)
 }
 
-// ListAssets handles GET /api/v1/assets
-func (h *RequestHandler) ListAssets(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page == 0 {
-		page = 1
-	}
-
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit == 0 {
-		limit = DefaultPageSize
-	}
+// GetUserActivity handles GET /api/v1/users/{userID}/activity
+func (h *RequestHandler) GetUserActivity(w http.ResponseWriter, r *http.Request) {
+	orgID := OrganizationID(r.Context())
+	vars := mux.Vars(r)
+	userID := vars["userID"]
 
-	assetType := r.URL.Query().Get("type")
-	var assetTypePtr *string
-	if assetType != "" {
-		assetTypePtr = &assetType
-	}
+	// Parse query parameters
+	page, limit := h.parsePagination(r)
 
-	// Fetch assets
-	result, err := h.service.ListAssets(page, limit, assetTypePtr)
+	result, err := h.service.GetUserActivity(orgID, userID, page, limit)
 	if err != nil {
-		if err.Error() == "invalid asset type" {
+		if errors.Is(err, ErrLimitExceeded) {
 			h.sendError(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, ErrUserNotFound) {
+			h.sendError(w, http.StatusNotFound, err.Error())
 		} else {
-			log.Printf("Error listing assets: %v", err)
+			log.Printf("Error fetching user activity: %v", err)
 			h.sendError(w, http.StatusInternalServerError, "internal server error")
 		}
 		return
 	}
 
+	setPaginationLinks(w, r, result["pagination"].(PaginationInfo))
 	h.sendJSON(w, http.StatusOK, result)
 }
 
-// DeleteAsset handles DELETE /api/v1/assets/{assetID}
-func (h *RequestHandler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	assetID := vars["assetID"]
+// GetEndpointSLOs handles GET /api/v1/admin/metrics/slo
+// Query: hours (window, default 24).
+func (h *RequestHandler) GetEndpointSLOs(w http.ResponseWriter, r *http.Request) {
+	hours := DefaultSLOWindowHours
+	if value := r.URL.Query().Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "hours must be an integer")
+			return
+		}
+		hours = parsed
+	}
 
-	// Delete asset
-	err := h.service.DeleteAsset(assetID)
+	slos, err := h.service.GetEndpointSLOs(hours)
 	if err != nil {
-		if err.Error() == "asset not found" {
-			h.sendError(w, http.StatusNotFound, err.Error())
+		if errors.Is(err, ErrInvalidSLOHours) {
+			h.sendError(w, http.StatusBadRequest, err.Error())
 		} else {
-			log.Printf("Error deleting asset: %v", err)
+			log.Printf("Error computing endpoint SLOs: %v", err)
 			h.sendError(w, http.StatusInternalServerError, "internal server error")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"hours":     hours,
+		"endpoints": slos,
+	})
 }
 
 // ============================================================================
-// FAVORITE HANDLERS
+// MIDDLEWARE
 // ============================================================================
 
-// GetFavorites handles GET /api/v1/users/{userID}/favorites
-func (h *RequestHandler) GetFavorites(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID := vars["userID"]
+// contextKey namespaces values this package stores in request contexts.
+type contextKey string
 
-	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page == 0 {
-		page = 1
+// userIDContextKey holds the authenticated user's ID.
+const userIDContextKey contextKey = "user_id"
+
+// orgIDContextKey holds the organization the request acts within.
+const orgIDContextKey contextKey = "org_id"
+
+// requestBodyContextKey holds the request body read so far, when debugging.
+const requestBodyContextKey contextKey = "request_body"
+
+// AuthenticatedUserID returns the user ID set by the auth middleware, if any.
+func AuthenticatedUserID(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(string)
+	return userID, ok
+}
+
+// RequestBody returns the part of the request body handlers have read so far,
+// as recorded by DebugBodyLogMiddleware. It is nil when debugging is off.
+func RequestBody(ctx context.Context) []byte {
+	if body, ok := ctx.Value(requestBodyContextKey).(*bytes.Buffer); ok {
+		return body.Bytes()
 	}
+	return nil
+}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit == 0 {
-		limit = DefaultPageSize
+// OrganizationID returns the organization set by the auth middleware,
+// or DefaultOrganizationID if none was set.
+func OrganizationID(ctx context.Context) string {
+	if orgID, ok := ctx.Value(orgIDContextKey).(string); ok && orgID != "" {
+		return orgID
 	}
+	return DefaultOrganizationID
+}
 
-	assetType := r.URL.Query().Get("type")
-	if assetType == "" {
-		assetType = ""
-	} else if !ValidAssetTypes[assetType] {
-		h.sendError(w, http.StatusBadRequest, "invalid asset type")
-		return
+// withClaims stores the token's user and organization in ctx.
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, userIDContextKey, claims.Subject)
+	return context.WithValue(ctx, orgIDContextKey, claims.OrgID)
+}
+
+// Claims are the JWT claims this service reads.
+type Claims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`              // Unix seconds
+	Role      string `json:"role,omitempty"`   // "admin" grants /api/v1/admin
+	OrgID     string `json:"org_id,omitempty"` // empty means DefaultOrganizationID
+}
+
+// parseJWT verifies an HS256 token and returns its claims.
+// Only HS256 is accepted: trusting the header's alg would let a token
+// signed with "none" (or another key type) through.
+func parseJWT(token string, secretKey []byte) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
 	}
 
-	// Fetch favorites
-	result, err := h.service.GetFavorites(userID, page, limit, &assetType)
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
 	if err != nil {
-		if err.Error() == "user not found" {
-			h.sendError(w, http.StatusNotFound, err.Error())
-		} else {
-			log.Printf("Error fetching favorites: %v", err)
-			h.sendError(w, http.StatusInternalServerError, "internal server error")
-		}
-		return
+		return nil, fmt.Errorf("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm")
 	}
 
-	h.sendJSON(w, http.StatusOK, result)
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+
+	if claims.ExpiresAt == 0 || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	return &claims, nil
 }
 
-// AddFavorite handles POST /api/v1/users/{userID}/favorites
-func (h *RequestHandler) AddFavorite(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID := vars["userID"]
+// authenticateBearer validates the request's bearer token.
+// On failure it writes the 401 response and returns false.
+func authenticateBearer(w http.ResponseWriter, r *http.Request, secretKey []byte) (*Claims, bool) {
+	authHeader := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" || token == authHeader {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing bearer token")
+		return nil, false
+	}
 
-	// Parse request body
-	var req struct {
-		AssetID     string `json:"asset_id"`
-		Description string `json:"description"`
+	claims, err := parseJWT(token, secretKey)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return nil, false
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid request body")
-		return
+	return claims, true
+}
+
+// JWTMiddleware authenticates requests with an HS256 bearer token.
+// The token's sub claim is the user ID; it must match the {userID} in the path.
+//
+//	401: token missing, malformed, badly signed or expired
+//	403: valid token for a different user
+func JWTMiddleware(secretKey []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := authenticateBearer(w, r, secretKey)
+			if !ok {
+				return
+			}
+
+			if userID, ok := mux.Vars(r)["userID"]; ok && userID != claims.Subject {
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
 	}
+}
 
-	if req.AssetID == "" {
-		h.sendError(w, http.StatusBadRequest, "asset_id is required")
-		return
+// AdminMiddleware requires a valid bearer token with role "admin".
+// Admins act within the organization of their token. Without a secret no
+// token can be checked, so every request is refused with 403.
+func AdminMiddleware(secretKey []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(secretKey) == 0 {
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+
+			claims, ok := authenticateBearer(w, r, secretKey)
+			if !ok {
+				return
+			}
+
+			if claims.Role != "admin" {
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
 	}
+}
 
-	// Add favorite
-	var description *string
-	if req.Description != "" {
-		description = &req.Description
+// OrganizationMiddleware scopes routes that don't require authentication
+// (user and asset management) to the organization of the caller's token.
+// Requests without a bearer token use DefaultOrganizationID; a token that is
+// present but invalid is rejected with 401.
+func OrganizationMiddleware(secretKey []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, ok := authenticateBearer(w, r, secretKey)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
 	}
+}
 
-	favorite, err := h.service.AddFavorite(userID, req.AssetID, description)
-	if err != nil {
-		if err.Error() == "user not found" || err.Error() == "asset not found" {
-			h.sendError(w, http.StatusNotFound, err.Error())
-		} else if err.Error() == "asset already in favorites" {
-			h.sendError(w, http.StatusConflict, err.Error())
-		} else {
-			log.Printf("Error adding favorite: %v", err)
-			h.sendError(w, http.StatusInternalServerError, "internal server error")
-		}
-		return
+// tokenBucket allows rate requests per second with bursts up to rate.
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per key, in memory.
+// Limits are per instance: N replicas allow up to N times the configured rate.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow reports whether one more request for key fits in rate per second.
+func (l *rateLimiter) Allow(key string, rate int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rate), lastSeen: now}
+		l.buckets[key] = bucket
 	}
 
-	h.sendJSON(w, http.StatusCreated, favorite)
+	// Refill for the time since the last request, capped at one second's worth
+	bucket.tokens += now.Sub(bucket.lastSeen).Seconds() * float64(rate)
+	if bucket.tokens > float64(rate) {
+		bucket.tokens = float64(rate)
+	}
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
 }
 
-// UpdateFavorite handles PUT /api/v1/users/{userID}/favorites/{assetID}
-func (h *RequestHandler) UpdateFavorite(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID := vars["userID"]
-	assetID := vars["assetID"]
+// APIKeyMiddleware authenticates server-to-server clients with an X-API-Key header.
+// Requests without the header are passed to fallback (the JWT middleware);
+// a nil fallback lets them through unauthenticated.
+//
+//	401: unknown or expired key
+//	403: key belongs to a different user than {userID}
+//	429: key's rate_limit_rps exceeded
+func APIKeyMiddleware(service *Service, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	limiter := newRateLimiter()
+
+	return func(next http.Handler) http.Handler {
+		var withoutKey http.Handler = next
+		if fallback != nil {
+			withoutKey = fallback(next)
+		}
 
-	// Parse request body
-	var req struct {
-		Description string `json:"description"`
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plaintext := r.Header.Get("X-API-Key")
+			if plaintext == "" {
+				withoutKey.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := service.AuthenticateAPIKey(plaintext)
+			if err != nil {
+				log.Printf("Error authenticating api key: %v", err)
+				writeError(w, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			if key == nil {
+				writeError(w, http.StatusUnauthorized, "invalid api key")
+				return
+			}
+
+			if userID, ok := mux.Vars(r)["userID"]; ok && userID != key.UserID {
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+
+			if !limiter.Allow(key.KeyHash, key.RateLimitRPS) {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDContextKey, key.UserID)
+			ctx = context.WithValue(ctx, orgIDContextKey, key.OrganizationID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
 	}
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid request body")
-		return
+// CORSMiddleware adds CORS headers for requests from allowed origins and
+// answers preflight requests directly.
+//
+// It wraps the whole router rather than being registered with router.Use:
+// mux only runs route middleware on matched routes, and no route is
+// registered for OPTIONS, so preflights would never reach it. Without it the
+// router still answers OPTIONS (see methodNotAllowedHandler), just with no
+// CORS headers.
+func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
 	}
 
-	if req.Description == "" {
-		h.sendError(w, http.StatusBadRequest, "description is required")
-		return
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+
+			// Echo the matched origin back; never use "*"
+			if origin != "" && allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Idempotency-Key, If-Match, X-Page-Number, X-Page-Size")
+				// Let browser clients read pagination links
+				w.Header().Set("Access-Control-Expose-Headers", "Link")
+				w.Header().Set("Access-Control-Max-Age", "600") // 10 minutes
+			}
+
+			// Preflight: answer here, the browser only needs the headers
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	// Update favorite
-	favorite, err := h.service.UpdateFavoriteDescription(userID, assetID, req.Description)
-	if err != nil {
-		if err.Error() == "user not found" || err.Error() == "asset not in user's favorites" {
-			h.sendError(w, http.StatusNotFound, err.Error())
-		} else {
-			log.Printf("Error updating favorite: %v", err)
-			h.sendError(w, http.StatusInternalServerError, "internal server error")
+// routeMethods are the methods routes are registered for.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods lists the methods router has a route for at r's path.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, method := range routeMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
 		}
-		return
 	}
+	return methods
+}
 
-	h.sendJSON(w, http.StatusOK, favorite)
+// methodNotAllowedHandler answers requests to a routed path with a method it
+// has no route for. OPTIONS gets 204 and everything else 405, both with an
+// Allow header listing the path's methods. Paths with no routes get 404.
+// It is also the router's NotFoundHandler: mux loses the method mismatch
+// when the route sits in a subrouter and reports it as not found.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := allowedMethods(router, r)
+		if len(methods) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
 }
 
-// RemoveFavorite handles DELETE /api/v1/users/{userID}/favorites/{assetID}
-func (h *RequestHandler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID := vars["userID"]
-	assetID := vars["assetID"]
+// ContentTypeMiddleware rejects POST, PUT and PATCH requests whose body is
+// not JSON with 415, instead of letting handlers fail to decode it.
+// PATCH also accepts application/merge-patch+json.
+// Requests without a body (e.g. POST /users) are let through.
+func ContentTypeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType := strings.ToLower(r.Header.Get("Content-Type"))
+		switch r.Method {
+		case http.MethodPatch:
+			if r.ContentLength != 0 && !strings.HasPrefix(contentType, "application/json") && !strings.HasPrefix(contentType, "application/merge-patch+json") {
+				writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json or application/merge-patch+json")
+				return
+			}
+		case http.MethodPost, http.MethodPut:
+			// NDJSON imports are the one non-JSON body
+			if strings.HasSuffix(r.URL.Path, "/json-lines") && strings.HasPrefix(contentType, "application/x-ndjson") {
+				break
+			}
+			if r.ContentLength != 0 && !strings.HasPrefix(contentType, "application/json") {
+				writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	// Remove favorite
-	err := h.service.RemoveFavorite(userID, assetID)
-	if err != nil {
-		if err.Error() == "user not found" || err.Error() == "asset not in user's favorites" {
-			h.sendError(w, http.StatusNotFound, err.Error())
-		} else {
-			log.Printf("Error removing favorite: %v", err)
-			h.sendError(w, http.StatusInternalServerError, "internal server error")
+// statusRecorder remembers the status code a handler wrote. Unlike
+// responseCapture it keeps no copy of the body, so it suits every request.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.status = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush keeps streaming responses working through the wrapper.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, so handlers
+// can still lift the write deadline.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RequestMetricsMiddleware records the duration and status of every routed
+// request for GET /admin/metrics/slo. Requests are grouped by route template,
+// so IDs in the path don't split an endpoint into many.
+func RequestMetricsMiddleware(service *Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			endpoint := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					endpoint = template
+				}
+			}
+			service.RecordRequestMetric(&RequestMetric{
+				Endpoint:   endpoint,
+				Method:     r.Method,
+				StatusCode: recorder.status,
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+				RecordedAt: time.Now().UTC(),
+			})
+		})
+	}
+}
+
+// sensitiveBodyField matches a JSON string member whose key names a credential
+// or personal data, up to the end of its value even when the body is cut off.
+var sensitiveBodyField = regexp.MustCompile(`("[^"]*(?i:secret|password|token|key|email)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// redactBody replaces the string values of sensitive JSON keys with
+// "[REDACTED]". It works on the raw bytes, so malformed bodies, which are
+// the ones worth logging, are redacted too.
+func redactBody(body []byte) []byte {
+	return sensitiveBodyField.ReplaceAll(body, []byte(`$1"[REDACTED]"`))
+}
+
+// DebugBodyLogMiddleware logs the body of POST, PUT and PATCH requests that
+// end in a 4xx or 5xx, which is otherwise gone by the time the error is seen.
+// The body is copied as handlers read it, and whatever they left unread is
+// drained afterwards; at most MaxDebugBodyLogBytes are logged, with the
+// values of keys such as secret, password, token, key and email redacted.
+// When enabled is false requests pass through untouched.
+func DebugBodyLogMiddleware(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
 		}
-		return
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := &bytes.Buffer{}
+			tee := io.TeeReader(r.Body, body)
+			r.Body = io.NopCloser(tee)
+			r = r.WithContext(context.WithValue(r.Context(), requestBodyContextKey, body))
+
+			capture := newResponseCapture(w)
+			next.ServeHTTP(capture, r)
+
+			if capture.status < http.StatusBadRequest {
+				return
+			}
+			if body.Len() < MaxDebugBodyLogBytes {
+				io.Copy(io.Discard, io.LimitReader(tee, int64(MaxDebugBodyLogBytes-body.Len())))
+			}
+			// Redact before truncating, so a value cut in half is still caught
+			logged := redactBody(body.Bytes())
+			if len(logged) > MaxDebugBodyLogBytes {
+				logged = logged[:MaxDebugBodyLogBytes]
+			}
+			log.Printf("DEBUG: %s %s returned %d, request_body: %s", r.Method, r.URL.Path, capture.status, logged)
+		})
 	}
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// GzipMiddleware compresses responses for clients sending
+// "Accept-Encoding: gzip". Content-Length is dropped so compressed bodies
+// use chunked transfer encoding, and Flush pushes buffered compressed data
+// to the client so server-sent events keep working.
+func GzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsMediaType(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
 }
 
-// HealthCheck handles GET /health
-func (h *RequestHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	h.sendJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+// gzipResponseWriter compresses the body written through it.
+// The gzip.Writer is created on the first write so responses without a
+// body (204, 304, HEAD) are passed through untouched.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	head        bool
+	wroteHeader bool
 }
 
-// ============================================================================
-// MAIN
-// ============================================================================
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	bodyless := w.head || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified
+	if !bodyless && header.Get("Content-Encoding") == "" {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
 
-func main() {
-	// Initialize database
-	storage, err := NewStorage()
-	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// Sniff before compressing; the default would sniff gzip bytes
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
 	}
-	defer storage.Close()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
 
-	// Create service and handler
-	service := NewService(storage)
-	handler := &RequestHandler{service: service}
+// Flush sends everything written so far to the client.
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
 
-	// Setup routes using gorilla/mux for better routing
+// Unwrap lets http.ResponseController reach the connection, so handlers
+// can still lift the write deadline.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close writes the gzip footer. Called once the handler returns.
+func (w *gzipResponseWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// NewRouter registers every route on a gorilla/mux router.
+// Path variables are named assetID, userID, otherUserID, version, webhookID, keyID and token,
+// matching what the handlers read with mux.Vars.
+func NewRouter(config *Config, service *Service, handler *RequestHandler) *mux.Router {
 	router := mux.NewRouter()
+	// Applies to subrouters too, so every routed request is measured
+	router.Use(RequestMetricsMiddleware(service))
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router)
+	router.NotFoundHandler = router.MethodNotAllowedHandler
+
+	// Kubernetes probes, registered ahead of the API subrouter so they need no token
+	router.HandleFunc("/api/v1/livez", handler.Livez).Methods("GET")
+	router.HandleFunc("/api/v1/readyz", handler.Readyz).Methods("GET")
 
 	// API routes
+	// Requests are scoped to the organization in the bearer token's org_id claim
 	api := router.PathPrefix("/api/v1").Subrouter()
+	// First, so bodies rejected by the other middleware are logged too
+	api.Use(DebugBodyLogMiddleware(config.Debug))
+	api.Use(ContentTypeMiddleware)
+	if len(config.JWTSecret) > 0 {
+		api.Use(OrganizationMiddleware(config.JWTSecret))
+	}
 
 	// User routes
 	api.HandleFunc("/users", handler.ListUsers).Methods("GET")
 	api.HandleFunc("/users", handler.CreateUser).Methods("POST")
-	api.HandleFunc("/users/{userID}", handler.DeleteUser).Methods("DELETE")
+
+	// User search exposes other users' emails, so it needs a token with role
+	// "admin" like the /admin routes. It is registered before /users/{userID},
+	// which would otherwise take "search" as a user ID.
+	userSearch := api.Path("/users/search").Subrouter()
+	userSearch.Use(AdminMiddleware(config.JWTSecret))
+	userSearch.HandleFunc("", handler.SearchUsers).Methods("GET")
+
+	// Everything under /users/{userID} acts on one user's data and requires
+	// that user's token when authentication is enabled
+	// An X-API-Key header is checked first; otherwise a bearer token is required.
+	userAPI := api.PathPrefix("/users/{userID}").Subrouter()
+	var jwtAuth func(http.Handler) http.Handler
+	if len(config.JWTSecret) > 0 {
+		jwtAuth = JWTMiddleware(config.JWTSecret)
+	} else {
+		log.Println("WARNING: JWT_SECRET not set, authentication is disabled and admin routes are closed")
+	}
+	userAPI.Use(APIKeyMiddleware(service, jwtAuth))
+
+	userAPI.HandleFunc("", handler.GetUser).Methods("GET")
+	userAPI.HandleFunc("", handler.UpdateUser).Methods("PUT")
+	userAPI.HandleFunc("", handler.DeleteUser).Methods("DELETE")
+	userAPI.HandleFunc("/activity", handler.GetUserActivity).Methods("GET")
 
 	// Asset routes
 	api.HandleFunc("/assets", handler.ListAssets).Methods("GET")
 	api.HandleFunc("/assets", handler.CreateAsset).Methods("POST")
+	api.HandleFunc("/assets/bulk", handler.BulkCreateAssets).Methods("POST")
+	api.HandleFunc("/assets/bulk", handler.BulkDeleteAssets).Methods("DELETE")
+	api.HandleFunc("/assets/{assetID}", handler.GetAsset).Methods("GET")
+	api.HandleFunc("/assets/{assetID}", handler.PatchAsset).Methods("PATCH")
 	api.HandleFunc("/assets/{assetID}", handler.DeleteAsset).Methods("DELETE")
+	api.HandleFunc("/assets/{assetID}/similar", handler.GetSimilarAssets).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/chart-data", handler.GetChartData).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/insight-text", handler.GetInsightText).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/audience-size", handler.GetAudienceSize).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/download", handler.DownloadAsset).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/versions", handler.GetAssetVersions).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/versions/{version}", handler.GetAssetVersion).Methods("GET")
+	api.HandleFunc("/assets/{assetID}/versions/{version}/restore", handler.RestoreAssetVersion).Methods("PUT")
+
+	// Trending: most favorited assets of the organization, recently
+	api.HandleFunc("/trending", handler.GetTrending).Methods("GET")
 
 	// Favorite routes
-	api.HandleFunc("/users/{userID}/favorites", handler.GetFavorites).Methods("GET")
-	api.HandleFunc("/users/{userID}/favorites", handler.AddFavorite).Methods("POST")
-	api.HandleFunc("/users/{userID}/favorites/{assetID}", handler.UpdateFavorite).Methods("PUT")
-	api.HandleFunc("/users/{userID}/favorites/{assetID}", handler.RemoveFavorite).Methods("DELETE")
+	userAPI.HandleFunc("/favorites", handler.GetFavorites).Methods("GET")
+	userAPI.HandleFunc("/favorites", handler.AddFavorite).Methods("POST")
+	userAPI.HandleFunc("/favorites", handler.RemoveAllFavorites).Methods("DELETE")
+	userAPI.HandleFunc("/favorites/stream", handler.StreamFavorites).Methods("GET")
+	userAPI.HandleFunc("/favorites/shared-link", handler.CreateShareLink).Methods("GET")
+	userAPI.HandleFunc("/favorites/groups", handler.GetFavoriteGroups).Methods("GET")
+	userAPI.HandleFunc("/favorites/most-recent-per-type", handler.GetMostRecentFavoritePerType).Methods("GET")
+	userAPI.HandleFunc("/favorites/recommended", handler.RecommendedFavorites).Methods("GET")
+	userAPI.HandleFunc("/favorites/check", handler.CheckFavorites).Methods("POST")
+	userAPI.HandleFunc("/favorites/timeline", handler.GetFavoritesTimeline).Methods("GET")
+	userAPI.HandleFunc("/favorites/calendar-heatmap", handler.GetFavoriteCalendar).Methods("GET")
+	userAPI.HandleFunc("/favorites/random", handler.GetRandomFavorite).Methods("GET")
+	userAPI.HandleFunc("/favorites/asset-types", handler.GetFavoriteAssetTypes).Methods("GET")
+	userAPI.HandleFunc("/favorites/stats", handler.GetFavoriteStats).Methods("GET")
+	userAPI.HandleFunc("/favorites/badges", handler.GetFavoriteBadges).Methods("GET")
+	userAPI.HandleFunc("/favorites/compare/{otherUserID}", handler.CompareFavorites).Methods("GET")
+	userAPI.HandleFunc("/favorites/search", handler.SearchFavorites).Methods("GET")
+	userAPI.HandleFunc("/favorites/deleted", handler.ListDeletedFavorites).Methods("GET")
+	userAPI.HandleFunc("/favorites/export/json-lines", handler.ExportFavoritesNDJSON).Methods("GET")
+	userAPI.HandleFunc("/favorites/import/json-lines", handler.ImportFavoritesNDJSON).Methods("POST")
+	// Registered before /favorites/{assetID}, which would otherwise match "reorder"
+	userAPI.HandleFunc("/favorites/reorder", handler.ReorderFavorites).Methods("PUT")
+	userAPI.HandleFunc("/favorites/{assetID}", handler.GetFavorite).Methods("GET")
+	userAPI.HandleFunc("/favorites/{assetID}", handler.UpdateFavorite).Methods("PUT")
+	userAPI.HandleFunc("/favorites/{assetID}", handler.RemoveFavorite).Methods("DELETE")
+	userAPI.HandleFunc("/favorites/{assetID}/history", handler.GetFavoriteHistory).Methods("GET")
+	userAPI.HandleFunc("/favorites/{assetID}/notes", handler.UpdateFavoriteNotes).Methods("PATCH")
+	userAPI.HandleFunc("/favorites/{assetID}/pin", handler.PinFavorite).Methods("POST")
+	userAPI.HandleFunc("/favorites/{assetID}/pin", handler.UnpinFavorite).Methods("DELETE")
+	userAPI.HandleFunc("/favorites/{assetID}/exists", handler.FavoriteExists).Methods("GET")
+	userAPI.HandleFunc("/favorites/{assetID}/restore", handler.RestoreFavorite).Methods("POST")
+
+	// Shared favorites: public, the token in the path is the credential
+	api.HandleFunc("/shared/{token}/favorites", handler.GetSharedFavorites).Methods("GET")
+
+	// Webhook routes
+	userAPI.HandleFunc("/webhooks", handler.ListWebhooks).Methods("GET")
+	userAPI.HandleFunc("/webhooks", handler.CreateWebhook).Methods("POST")
+	userAPI.HandleFunc("/webhooks/{webhookID}", handler.DeleteWebhook).Methods("DELETE")
+
+	// Admin routes: require a token with role "admin", so they are closed
+	// entirely when authentication is disabled
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminMiddleware(config.JWTSecret))
+	admin.HandleFunc("/api-keys", handler.ListAPIKeys).Methods("GET")
+	admin.HandleFunc("/api-keys", handler.CreateAPIKey).Methods("POST")
+	admin.HandleFunc("/api-keys/{keyID}", handler.DeleteAPIKey).Methods("DELETE")
+	admin.HandleFunc("/asset-types", handler.ListAssetTypes).Methods("GET")
+	admin.HandleFunc("/asset-types", handler.CreateAssetType).Methods("POST")
+	admin.HandleFunc("/audit-log", handler.ListAuditLog).Methods("GET")
+	admin.HandleFunc("/metrics/slo", handler.GetEndpointSLOs).Methods("GET")
 
 	// Health check
 	router.HandleFunc("/health", handler.HealthCheck).Methods("GET")
+	router.HandleFunc("/health/db", handler.DBHealthCheck).Methods("GET")
+
+	return router
+}
+
+// ============================================================================
+// MAIN
+// ============================================================================
+
+func main() {
+	config := LoadConfig()
+
+	// Cancelled on SIGINT or SIGTERM to stop background jobs and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize database
+	storage, err := NewStorage(DBConnString, config.DBMaxRetries)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storage.Close()
+
+	// Expire idempotency keys in the background
+	go cleanupIdempotencyKeys(ctx, storage, IdempotencyKeyCleanupInterval)
+
+	// Drop request metrics older than the longest SLO window
+	go cleanupRequestMetrics(ctx, storage, RequestMetricsCleanupInterval)
+
+	// Purge removed favorites once they can no longer be restored, and old deleted assets
+	go NewJanitor(storage, FavoriteRestoreWindow, DeletedAssetRetention).Run(ctx, JanitorInterval)
+
+	// Tick a heartbeat so the liveness probe can tell the process still schedules goroutines
+	heartbeat := NewHeartbeat()
+	go heartbeat.Run(ctx, HeartbeatInterval)
+
+	// Cache favorites pages and sweep expired entries in the background
+	cache := NewMemoryCache()
+	go sweepCache(ctx, cache, CacheSweepInterval)
+
+	// Create service and handler
+	service := NewService(storage, NewBroker(), NewWebhookDispatcher(storage), cache, config.AllowCrossOrgAssets, config.LoosePagination, config.MaxPageSize)
+	handler := &RequestHandler{service: service, storage: storage, shareLinkTTL: config.ShareLinkTTL, defaultPageSize: config.DefaultPageSize, heartbeat: heartbeat}
+
+	// Load asset types added at runtime; the built-ins remain valid if this fails
+	if err := service.ReloadAssetTypes(); err != nil {
+		log.Printf("WARNING: failed to load asset types: %v", err)
+	}
+	go refreshAssetTypes(ctx, service, AssetTypeRefreshInterval)
+
+	// Setup routes using gorilla/mux for better routing
+	router := NewRouter(config, service, handler)
 
 	// Start server
 	// Using gorilla/mux router which is more robust than default mux
-	log.Println("Starting server on :8080")
+	addr := ":" + strconv.Itoa(config.Port)
+	log.Printf("Starting server on %s", addr)
 	server := &http.Server{
-		Addr:         ":8080",
-		Handler:      router,
+		Addr:         addr,
+		Handler:      CORSMiddleware(config.AllowedOrigins)(GzipMiddleware(router)),
 		ReadTimeout:  RequestTimeout,
 		WriteTimeout: RequestTimeout,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	if err := server.ListenAndServe(); err != nil {
+	// In-flight requests get up to RequestTimeout to finish
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
+	<-shutdownDone
 }
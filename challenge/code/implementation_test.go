@@ -1,12 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 // ============================================================================
@@ -75,6 +95,28 @@ func TestListUsersSuccess(t *testing.T) {
 	}
 }
 
+// TestListUsersHidesEmails tests the public user list doesn't expose emails
+func TestListUsersHidesEmails(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	router := NewRouter(&Config{}, mockService, &RequestHandler{service: mockService})
+
+	req := httptest.NewRequest("GET", "/api/v1/users", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); strings.Contains(body, "email") || strings.Contains(body, "alice@example.com") {
+		t.Errorf("Expected no emails in the user list, got %s", body)
+	}
+}
+
 // TestListUsersEmpty tests listing when no users exist
 func TestListUsersEmpty(t *testing.T) {
 	mockService := &Service{
@@ -138,216 +180,293 @@ func TestListUsersPaginationDefaults(t *testing.T) {
 	}
 }
 
-// ============================================================================
-// ASSET TESTS
-// ============================================================================
-
-// TestCreateAssetSuccess tests creating an asset (chart, insight, or audience)
-func TestCreateAssetSuccess(t *testing.T) {
+// TestListUsersLimitExceedsMaximum tests 400 response for a limit above MaxPageSize
+func TestListUsersLimitExceedsMaximum(t *testing.T) {
 	mockService := &Service{
 		storage: &mockStorage{},
 	}
 	handler := &RequestHandler{service: mockService}
 
-	assetData := map[string]interface{}{
-		"type": "chart",
-		"data": map[string]interface{}{
-			"title": "Sales Data",
-			"x_axis": "Month",
-			"y_axis": "Revenue",
-			"data":   []float64{100, 200, 300},
-		},
-	}
-	bodyBytes, _ := json.Marshal(assetData)
-
-	req := httptest.NewRequest("POST", "/api/v1/assets", bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest("GET", "/api/v1/users?limit=99999", nil)
 	w := httptest.NewRecorder()
 
-	handler.CreateAsset(w, req)
+	handler.ListUsers(w, req)
 
-	if w.Code != http.StatusCreated {
-		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
 
-	var result map[string]interface{}
-	json.NewDecoder(w.Body).Decode(&result)
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
 
-	if result["id"] == nil {
-		t.Error("Expected id field in asset response")
-	}
-	if result["type"] != "chart" {
-		t.Error("Expected type field in asset response")
+	if errorResp.Error != "limit exceeds maximum of 100" {
+		t.Errorf("Expected 'limit exceeds maximum of 100', got %q", errorResp.Error)
 	}
 }
 
-// TestListAssetsSuccess tests retrieving all assets with optional type filter
-func TestListAssetsSuccess(t *testing.T) {
+// TestListUsersLoosePaginationClamps tests the deprecated loose mode still clamps limit
+func TestListUsersLoosePaginationClamps(t *testing.T) {
 	mockService := &Service{
-		storage: &mockStorage{},
+		storage:         &mockStorage{},
+		loosePagination: true,
 	}
 	handler := &RequestHandler{service: mockService}
 
-	// Test with type filter
-	req := httptest.NewRequest("GET", "/api/v1/assets?page=1&limit=20&type=chart", nil)
+	req := httptest.NewRequest("GET", "/api/v1/users?limit=99999", nil)
 	w := httptest.NewRecorder()
 
-	handler.ListAssets(w, req)
+	handler.ListUsers(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
 	var result map[string]interface{}
 	json.NewDecoder(w.Body).Decode(&result)
 
-	if _, ok := result["assets"]; !ok {
-		t.Error("Expected 'assets' array in response")
-	}
-	if _, ok := result["pagination"]; !ok {
-		t.Error("Expected 'pagination' object in response")
+	pagination, _ := result["pagination"].(map[string]interface{})
+	if pagination["limit"] != float64(MaxPageSize) {
+		t.Errorf("Expected limit clamped to %d, got %v", MaxPageSize, pagination["limit"])
 	}
 }
 
-// ============================================================================
-// FAVORITES TESTS
-// ============================================================================
-
-// TestGetFavoritesUserNotFound tests 404 response when user doesn't exist
-func TestGetFavoritesUserNotFound(t *testing.T) {
+// TestConfiguredPageSizes tests the configured default and maximum replace the constants
+func TestConfiguredPageSizes(t *testing.T) {
 	mockService := &Service{
-		storage: &mockStorage{
-			userExists: false, // User doesn't exist
-		},
+		storage:     &mockStorage{},
+		maxPageSize: 30,
 	}
-	handler := &RequestHandler{service: mockService}
+	handler := &RequestHandler{service: mockService, defaultPageSize: 5}
 
-	req := httptest.NewRequest("GET", "/api/v1/users/nonexistent-user-id/favorites?page=1", nil)
+	if _, limit := handler.parsePagination(httptest.NewRequest("GET", "/api/v1/users", nil)); limit != 5 {
+		t.Errorf("Expected the configured default limit 5, got %d", limit)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/users?limit=31", nil)
 	w := httptest.NewRecorder()
 
-	handler.GetFavorites(w, req)
+	handler.ListUsers(w, req)
 
-	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
 	}
 
 	var errorResp ErrorResponse
 	json.NewDecoder(w.Body).Decode(&errorResp)
 
-	if errorResp.Error == "" {
-		t.Error("Expected error message in response")
+	if errorResp.Error != "limit exceeds maximum of 30" {
+		t.Errorf("Expected 'limit exceeds maximum of 30', got %q", errorResp.Error)
 	}
 }
 
-// TestGetFavoritesSuccess tests retrieving user's favorite assets with pagination
-func TestGetFavoritesSuccess(t *testing.T) {
-	mockService := &Service{
-		storage: &mockStorage{
-			userExists: true,
-		},
+// TestLoadConfigPageSizes tests page sizes are read from the environment and
+// fall back to the constants when invalid
+func TestLoadConfigPageSizes(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultSize string
+		maxSize     string
+		wantDefault int
+		wantMax     int
+	}{
+		{"unset", "", "", DefaultPageSize, MaxPageSize},
+		{"both", "50", "500", 50, 500},
+		{"not a number", "ten", "", DefaultPageSize, MaxPageSize},
+		{"default above max", "200", "", DefaultPageSize, MaxPageSize},
+		{"max below default", "", "10", 10, 10},
+		{"both above fallback default", "80", "50", DefaultPageSize, 50},
 	}
-	handler := &RequestHandler{service: mockService}
 
-	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?page=1&limit=20", nil)
-	w := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PAGINATION_DEFAULT_SIZE", tt.defaultSize)
+			t.Setenv("PAGINATION_MAX_SIZE", tt.maxSize)
 
-	handler.GetFavorites(w, req)
+			config := LoadConfig()
+			if config.DefaultPageSize != tt.wantDefault || config.MaxPageSize != tt.wantMax {
+				t.Errorf("Expected default %d max %d, got default %d max %d", tt.wantDefault, tt.wantMax, config.DefaultPageSize, config.MaxPageSize)
+			}
+		})
+	}
+}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+// TestLoadConfigPort tests PORT is read from the environment and falls back
+// to DefaultPort when unset or invalid
+func TestLoadConfigPort(t *testing.T) {
+	tests := []struct {
+		port     string
+		expected int
+	}{
+		{"", DefaultPort},
+		{"9090", 9090},
+		{"http", DefaultPort},
+		{"0", DefaultPort},
+		{"70000", DefaultPort},
 	}
 
-	var result PaginatedResponse
-	json.NewDecoder(w.Body).Decode(&result)
+	for _, tt := range tests {
+		t.Setenv("PORT", tt.port)
 
-	// Verify response structure
-	if result.Pagination.Page != 1 {
-		t.Errorf("Expected page 1, got %d", result.Pagination.Page)
+		if port := LoadConfig().Port; port != tt.expected {
+			t.Errorf("PORT=%q: expected %d, got %d", tt.port, tt.expected, port)
+		}
 	}
 }
 
-// TestGetFavoritesWithTypeFilter tests filtering favorites by asset type
-func TestGetFavoritesWithTypeFilter(t *testing.T) {
-	mockService := &Service{
-		storage: &mockStorage{
-			userExists: true,
-		},
+// TestLoadConfigDBMaxRetries tests DB_MAX_RETRIES is read from the environment
+// and falls back to DefaultDBMaxRetries when unset or invalid
+func TestLoadConfigDBMaxRetries(t *testing.T) {
+	tests := []struct {
+		retries  string
+		expected int
+	}{
+		{"", DefaultDBMaxRetries},
+		{"0", 0},
+		{"10", 10},
+		{"-1", DefaultDBMaxRetries},
+		{"many", DefaultDBMaxRetries},
 	}
-	handler := &RequestHandler{service: mockService}
-
-	// Filter for only 'chart' type assets
-	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?page=1&type=chart", nil)
-	w := httptest.NewRecorder()
 
-	handler.GetFavorites(w, req)
+	for _, tt := range tests {
+		t.Setenv("DB_MAX_RETRIES", tt.retries)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+		if retries := LoadConfig().DBMaxRetries; retries != tt.expected {
+			t.Errorf("DB_MAX_RETRIES=%q: expected %d, got %d", tt.retries, tt.expected, retries)
+		}
 	}
 }
 
-// TestAddFavoriteSuccess tests adding an asset to user's favorites
-func TestAddFavoriteSuccess(t *testing.T) {
-	mockService := &Service{
-		storage: &mockStorage{
-			userExists: true,
-		},
-	}
-	handler := &RequestHandler{service: mockService}
+// TestPingWithRetry tests the startup ping is retried until it succeeds,
+// and fails only once the retries are exhausted
+func TestPingWithRetry(t *testing.T) {
+	errNotReady := errors.New("connection refused")
 
-	// Request body: asset_id and optional description
-	body := map[string]interface{}{
-		"asset_id":    "asset-456",
-		"description": "Important quarterly report",
+	tests := []struct {
+		name       string
+		failures   int // pings that fail before one succeeds
+		maxRetries int
+		wantErr    bool
+		wantPings  int
+	}{
+		{"ready at once", 0, 3, false, 1},
+		{"ready after two retries", 2, 3, false, 3},
+		{"never ready", 10, 3, true, 4},
+		{"no retries", 1, 0, true, 1},
 	}
-	bodyBytes, _ := json.Marshal(body)
 
-	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites", bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	for _, tt := range tests {
+		pings := 0
+		ping := func() error {
+			pings++
+			if pings <= tt.failures {
+				return errNotReady
+			}
+			return nil
+		}
 
-	handler.AddFavorite(w, req)
+		err := pingWithRetry(ping, tt.maxRetries, time.Millisecond)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if err != nil && !errors.Is(err, errNotReady) {
+			t.Errorf("%s: expected the last ping error to be wrapped, got %v", tt.name, err)
+		}
+		if pings != tt.wantPings {
+			t.Errorf("%s: expected %d pings, got %d", tt.name, tt.wantPings, pings)
+		}
+	}
+}
 
-	if w.Code != http.StatusCreated {
-		t.Errorf("Expected status %d (Created), got %d", http.StatusCreated, w.Code)
+// TestPaginationLinkHeader tests list responses link to the next and prev pages,
+// keeping other query parameters
+func TestPaginationLinkHeader(t *testing.T) {
+	storage := &mockStorage{assets: map[string]*Asset{}}
+	for i := 0; i < 5; i++ {
+		id := "asset-" + strconv.Itoa(i)
+		storage.assets[id] = &Asset{ID: id, Type: "chart"}
 	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
 
-	var result map[string]interface{}
-	json.NewDecoder(w.Body).Decode(&result)
+	tests := []struct {
+		name     string
+		target   string
+		headers  map[string]string
+		expected string
+	}{
+		{"first page", "/api/v1/assets?type=chart&limit=2", nil,
+			`<http://example.com/api/v1/assets?limit=2&page=2&type=chart>; rel="next"`},
+		{"middle page", "/api/v1/assets?page=2&limit=2", nil,
+			`<http://example.com/api/v1/assets?limit=2&page=3>; rel="next", <http://example.com/api/v1/assets?limit=2&page=1>; rel="prev"`},
+		{"last page", "/api/v1/assets?page=3&limit=2", nil,
+			`<http://example.com/api/v1/assets?limit=2&page=2>; rel="prev"`},
+		{"header pagination", "/api/v1/assets", map[string]string{"X-Page-Size": "2"},
+			`<http://example.com/api/v1/assets?limit=2&page=2>; rel="next"`},
+		{"single page", "/api/v1/assets", nil, ""},
+	}
 
-	if result["id"] == nil {
-		t.Error("Expected favorite id in response")
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ListAssets(w, req)
+
+		if got := w.Header().Get("Link"); got != tt.expected {
+			t.Errorf("%s: expected Link %q, got %q", tt.name, tt.expected, got)
+		}
 	}
 }
 
-// TestAddFavoriteWithoutDescription tests adding favorite without custom description
-func TestAddFavoriteWithoutDescription(t *testing.T) {
-	mockService := &Service{
-		storage: &mockStorage{
-			userExists: true,
-		},
-	}
-	handler := &RequestHandler{service: mockService}
+// TestPaginationLinkHeaderCursor tests cursor pages link forward by before only
+func TestPaginationLinkHeaderCursor(t *testing.T) {
+	nextBefore := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?page=4&before=2024-03-02T00:00:00Z", nil)
+	w := httptest.NewRecorder()
 
-	// Request body: only asset_id (description is optional)
-	body := map[string]interface{}{
-		"asset_id": "asset-789",
+	setPaginationLinks(w, req, PaginationInfo{
+		Page: 1, Limit: 20, Total: -1, TotalPages: -1, HasNext: true, HasPrev: true,
+		NextBefore: &nextBefore, NextBeforeID: "3f1c2b9e-8d4a-4c1e-9b7a-2e5d6f8a9c0b",
+	})
+
+	expected := `<http://example.com/api/v1/users/user-123/favorites?before=2024-03-01T12%3A00%3A00Z&before_id=3f1c2b9e-8d4a-4c1e-9b7a-2e5d6f8a9c0b&limit=20>; rel="next"`
+	if got := w.Header().Get("Link"); got != expected {
+		t.Errorf("Expected Link %q, got %q", expected, got)
 	}
-	bodyBytes, _ := json.Marshal(body)
+}
 
-	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites", bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+// TestParsePagination tests page and limit fall back to headers, with query parameters first
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		headers   map[string]string
+		wantPage  int
+		wantLimit int
+	}{
+		{"defaults", "", nil, 1, DefaultPageSize},
+		{"query", "?page=3&limit=50", nil, 3, 50},
+		{"headers", "", map[string]string{"X-Page-Number": "2", "X-Page-Size": "10"}, 2, 10},
+		{"query wins", "?page=4", map[string]string{"X-Page-Number": "2", "X-Page-Size": "10"}, 4, 10},
+		{"invalid header", "", map[string]string{"X-Page-Number": "two"}, 1, DefaultPageSize},
+	}
 
-	handler.AddFavorite(w, req)
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/users"+tt.query, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
 
-	if w.Code != http.StatusCreated {
-		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+		page, limit := (&RequestHandler{}).parsePagination(req)
+		if page != tt.wantPage || limit != tt.wantLimit {
+			t.Errorf("%s: expected page %d limit %d, got page %d limit %d", tt.name, tt.wantPage, tt.wantLimit, page, limit)
+		}
 	}
 }
 
-// TestAddFavoriteUserNotFound tests adding favorite when user doesn't exist
-func TestAddFavoriteUserNotFound(t *testing.T) {
+// TestErrorResponseProblemDetail tests error responses are RFC 7807 problem details
+func TestErrorResponseProblemDetail(t *testing.T) {
 	mockService := &Service{
 		storage: &mockStorage{
 			userExists: false,
@@ -355,155 +474,4807 @@ func TestAddFavoriteUserNotFound(t *testing.T) {
 	}
 	handler := &RequestHandler{service: mockService}
 
-	body := map[string]interface{}{
-		"asset_id": "asset-456",
-	}
-	bodyBytes, _ := json.Marshal(body)
-
-	req := httptest.NewRequest("POST", "/api/v1/users/nonexistent/favorites", bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest("GET", "/api/v1/users/nonexistent-user-id", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "nonexistent-user-id"})
 	w := httptest.NewRecorder()
 
-	handler.AddFavorite(w, req)
+	handler.GetUser(w, req)
 
-	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected Content-Type application/problem+json, got %q", ct)
+	}
+
+	var problem ProblemDetail
+	json.NewDecoder(w.Body).Decode(&problem)
+
+	want := ProblemDetail{
+		Type:   "https://gwi.example.com/errors/user-not-found",
+		Title:  "Not Found",
+		Status: http.StatusNotFound,
+		Detail: "user not found",
+		Error:  "user not found",
+	}
+	if problem != want {
+		t.Errorf("Expected %+v, got %+v", want, problem)
 	}
 }
 
-// TestUpdateFavoriteDescriptionSuccess tests updating a favorite's custom description
-func TestUpdateFavoriteDescriptionSuccess(t *testing.T) {
+// TestDeleteUser_NotFound tests deleting a user that doesn't exist
+func TestDeleteUser_NotFound(t *testing.T) {
 	mockService := &Service{
 		storage: &mockStorage{
-			userExists: true,
+			userExists: false,
 		},
 	}
-	handler := &RequestHandler{service: mockService}
 
-	updateBody := map[string]interface{}{
-		"description": "Updated: Critical metrics for Q4 review",
+	err := mockService.DeleteUser("org-1", "nonexistent-user-id")
+	if err == nil {
+		t.Fatal("Expected error for nonexistent user")
 	}
-	bodyBytes, _ := json.Marshal(updateBody)
-
-	req := httptest.NewRequest("PUT", "/api/v1/users/user-123/favorites/asset-456", bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	handler.UpdateFavoriteDescription(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d (OK), got %d", http.StatusOK, w.Code)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
 	}
 }
 
-// TestRemoveFavoriteSuccess tests soft-deleting a favorite (removes from user's list)
-func TestRemoveFavoriteSuccess(t *testing.T) {
-	mockService := &Service{
-		storage: &mockStorage{
-			userExists: true,
-		},
+// TestUpdateUser tests setting, clearing and validating user metadata
+func TestUpdateUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		userExists  bool
+		body        string
+		wantStatus  int
+		wantName    string
+		wantEmail   string
+		wantMessage string
+	}{
+		{"sets both", true, `{"display_name": " Alice ", "email": "alice@example.com"}`, http.StatusOK, "Alice", "alice@example.com", ""},
+		{"clears both", true, `{"display_name": "", "email": null}`, http.StatusOK, "", "", ""},
+		{"invalid email", true, `{"email": "not an email"}`, http.StatusBadRequest, "", "", "email is not a valid address"},
+		{"email with name", true, `{"email": "Alice <alice@example.com>"}`, http.StatusBadRequest, "", "", "email is not a valid address"},
+		{"long display name", true, `{"display_name": "` + strings.Repeat("a", MaxDisplayNameLength+1) + `"}`, http.StatusBadRequest, "", "", "display_name must be at most 100 characters"},
+		{"invalid body", true, `{`, http.StatusBadRequest, "", "", "invalid request body"},
+		{"unknown user", false, `{"display_name": "Alice"}`, http.StatusNotFound, "", "", "user not found"},
 	}
-	handler := &RequestHandler{service: mockService}
 
-	req := httptest.NewRequest("DELETE", "/api/v1/users/user-123/favorites/asset-456", nil)
-	w := httptest.NewRecorder()
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
 
-	handler.RemoveFromFavorites(w, req)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &RequestHandler{service: &Service{storage: &mockStorage{userExists: tt.userExists}}}
 
-	// Soft delete returns 204 No Content
-	if w.Code != http.StatusNoContent {
-		t.Errorf("Expected status %d (No Content), got %d", http.StatusNoContent, w.Code)
+			req := httptest.NewRequest("PUT", "/api/v1/users/user-1", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"userID": "user-1"})
+			w := httptest.NewRecorder()
+
+			handler.UpdateUser(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				var errorResp ErrorResponse
+				json.NewDecoder(w.Body).Decode(&errorResp)
+				if errorResp.Error != tt.wantMessage {
+					t.Errorf("Expected %q, got %q", tt.wantMessage, errorResp.Error)
+				}
+				return
+			}
+
+			var user UserRecord
+			json.NewDecoder(w.Body).Decode(&user)
+			if name := deref(user.DisplayName); name != tt.wantName {
+				t.Errorf("Expected display_name %q, got %q", tt.wantName, name)
+			}
+			if email := deref(user.Email); email != tt.wantEmail {
+				t.Errorf("Expected email %q, got %q", tt.wantEmail, email)
+			}
+		})
 	}
 }
 
-// TestRemoveFavoriteUserNotFound tests removing favorite when user doesn't exist
-func TestRemoveFavoriteUserNotFound(t *testing.T) {
-	mockService := &Service{
-		storage: &mockStorage{
-			userExists: false,
-		},
+// TestAdminRoutesWithoutSecret tests admin-only routes are refused, not
+// opened, when no JWT secret is configured
+func TestAdminRoutesWithoutSecret(t *testing.T) {
+	mockService := &Service{storage: &mockStorage{userExists: true}}
+	router := NewRouter(&Config{}, mockService, &RequestHandler{service: mockService})
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/api/v1/admin/api-keys"},
+		{"POST", "/api/v1/admin/api-keys"},
+		{"GET", "/api/v1/admin/asset-types"},
+		{"GET", "/api/v1/admin/audit-log"},
+		{"GET", "/api/v1/admin/metrics/slo"},
+		{"GET", "/api/v1/users/search?q=alice"},
 	}
-	handler := &RequestHandler{service: mockService}
 
-	req := httptest.NewRequest("DELETE", "/api/v1/users/nonexistent/favorites/asset-456", nil)
-	w := httptest.NewRecorder()
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
 
-	handler.RemoveFromFavorites(w, req)
+		router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, http.StatusForbidden, w.Code)
+		}
 	}
 }
 
-// ============================================================================
-// HEALTH CHECK TEST
-// ============================================================================
-
-// TestHealthCheck verifies the service health endpoint
-// Used by Docker HEALTHCHECK and monitoring systems
-func TestHealthCheck(t *testing.T) {
-	handler := &RequestHandler{}
+// TestSearchUsers tests user search needs an admin token and a query, and
+// isn't mistaken for GET /users/{userID}
+func TestSearchUsers(t *testing.T) {
+	secret := []byte("test-secret")
+	mockService := &Service{storage: &mockStorage{userExists: true}}
+	router := NewRouter(&Config{JWTSecret: secret}, mockService, &RequestHandler{service: mockService})
 
-	req := httptest.NewRequest("GET", "/health", nil)
-	w := httptest.NewRecorder()
+	adminToken := "Bearer " + signTestClaims(secret, Claims{Subject: "admin-1", Role: "admin", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	tests := []struct {
+		name     string
+		query    string
+		auth     string
+		expected int
+	}{
+		{"no token", "q=alice", "", http.StatusUnauthorized},
+		{"user token", "q=alice", "Bearer " + signTestToken(secret, "user-123", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"missing query", "", adminToken, http.StatusBadRequest},
+		{"blank query", "q=%20", adminToken, http.StatusBadRequest},
+		{"admin", "q=alice", adminToken, http.StatusOK},
+	}
 
-	handler.HealthCheck(w, req)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/users/search?"+tt.query, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
-	}
+			router.ServeHTTP(w, req)
 
-	var result map[string]string
-	json.NewDecoder(w.Body).Decode(&result)
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
 
-	if result["status"] != "ok" {
-		t.Errorf("Expected status 'ok', got '%s'", result["status"])
+			var result struct {
+				Users []UserRecord `json:"users"`
+			}
+			json.NewDecoder(w.Body).Decode(&result)
+			if len(result.Users) != 1 || result.Users[0].DisplayName == nil || *result.Users[0].DisplayName != "alice" {
+				t.Errorf("Expected one user matching %q, got %+v", "alice", result.Users)
+			}
+		})
 	}
 }
 
 // ============================================================================
-// MOCK STORAGE - For unit testing without database
+// ASSET TESTS
 // ============================================================================
 
-// mockStorage implements the Storage interface for testing.
-// It simulates database operations without requiring a real database connection.
-type mockStorage struct {
-	userExists bool
-	assets     map[string]*Asset
-	favorites  map[string][]*Favorite
+// TestCreateAssetSuccess tests creating an asset (chart, insight, or audience)
+func TestCreateAssetSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	assetData := map[string]interface{}{
+		"type": "chart",
+		"data": map[string]interface{}{
+			"title": "Sales Data",
+			"x_axis": "Month",
+			"y_axis": "Revenue",
+			"data":   []float64{100, 200, 300},
+		},
+	}
+	bodyBytes, _ := json.Marshal(assetData)
+
+	req := httptest.NewRequest("POST", "/api/v1/assets", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateAsset(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["id"] == nil {
+		t.Error("Expected id field in asset response")
+	}
+	if result["type"] != "chart" {
+		t.Error("Expected type field in asset response")
+	}
+}
+
+// TestCreateAsset_InvalidType tests 400 response for an asset type not in ValidAssetTypes
+func TestCreateAsset_InvalidType(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("POST", "/api/v1/assets", strings.NewReader(`{"type":"video","data":{}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateAsset(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "invalid asset type" {
+		t.Errorf("Expected 'invalid asset type', got %q", errorResp.Error)
+	}
+}
+
+// TestCreateAsset_MissingType tests 400 response for a request without a type
+func TestCreateAsset_MissingType(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("POST", "/api/v1/assets", strings.NewReader(`{"type":"","data":{}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateAsset(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "type is required" {
+		t.Errorf("Expected 'type is required', got %q", errorResp.Error)
+	}
+}
+
+// TestCreateAsset_MissingData tests 400 response for a request whose data is null
+func TestCreateAsset_MissingData(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("POST", "/api/v1/assets", strings.NewReader(`{"type":"chart","data":null}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateAsset(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "data is required" {
+		t.Errorf("Expected 'data is required', got %q", errorResp.Error)
+	}
+}
+
+// TestBulkCreateAssets tests creating several assets in one request returns their IDs in order
+func TestBulkCreateAssets(t *testing.T) {
+	storage := &mockStorage{}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	body := `[{"type":"chart","data":{"title":"A"}},{"type":"insight","data":{"text":"B"},"tags":["q1"]}]`
+	req := httptest.NewRequest("POST", "/api/v1/assets/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.BulkCreateAssets(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var result struct {
+		IDs []string `json:"ids"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result.IDs) != 2 {
+		t.Fatalf("Expected 2 ids, got %v", result.IDs)
+	}
+	if storage.assets[result.IDs[0]].Type != "chart" || storage.assets[result.IDs[1]].Type != "insight" {
+		t.Errorf("Expected ids in request order, got %v", result.IDs)
+	}
+	if tags := storage.assets[result.IDs[0]].Tags; tags == nil {
+		t.Error("Expected missing tags to be stored as an empty array")
+	}
+}
+
+// TestBulkCreateAssets_Invalid tests 400 responses for empty, oversized and invalid batches
+func TestBulkCreateAssets_Invalid(t *testing.T) {
+	tooMany := make([]string, MaxBulkAssets+1)
+	for i := range tooMany {
+		tooMany[i] = `{"type":"chart","data":{}}`
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"empty", `[]`, "no assets to create"},
+		{"too many", "[" + strings.Join(tooMany, ",") + "]", "at most " + strconv.Itoa(MaxBulkAssets) + " assets per request"},
+		{"invalid type", `[{"type":"chart","data":{}},{"type":"video","data":{}}]`, "invalid asset type at index 1"},
+		{"null data", `[{"type":"chart","data":null}]`, "data is required at index 0"},
+		{"not an array", `{"type":"chart","data":{}}`, "invalid request body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &mockStorage{}
+			handler := &RequestHandler{service: &Service{storage: storage}}
+
+			req := httptest.NewRequest("POST", "/api/v1/assets/bulk", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.BulkCreateAssets(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			var errorResp ErrorResponse
+			json.NewDecoder(w.Body).Decode(&errorResp)
+			if errorResp.Error != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, errorResp.Error)
+			}
+			if len(storage.assets) != 0 {
+				t.Errorf("Expected no assets to be created, got %d", len(storage.assets))
+			}
+		})
+	}
+}
+
+// TestBuildBulkInsertAssetsQuery tests each row of the bulk insert gets its own
+// five consecutive placeholders
+func TestBuildBulkInsertAssetsQuery(t *testing.T) {
+	items := []BulkAssetInput{
+		{Type: "chart", Data: json.RawMessage(`{}`), Tags: []string{}},
+		{Type: "insight", Data: json.RawMessage(`{}`), Tags: []string{}},
+		{Type: "audience", Data: json.RawMessage(`{}`), Tags: []string{}},
+	}
+	query, args := buildBulkInsertAssetsQuery(DefaultOrganizationID, []string{"a", "b", "c"}, items)
+
+	if len(args) != 15 {
+		t.Fatalf("Expected 15 args, got %d", len(args))
+	}
+	if !strings.HasSuffix(query, "($1, $2, $3, $4, $5), ($6, $7, $8, $9, $10), ($11, $12, $13, $14, $15)") {
+		t.Errorf("Unexpected placeholders in %s", query)
+	}
+	if args[5] != "b" || args[6] != "insight" || args[14] != DefaultOrganizationID {
+		t.Errorf("Expected args grouped per row, got %v", args)
+	}
+}
+
+// TestListAssetsSuccess tests retrieving all assets with optional type filter
+func TestListAssetsSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	// Test with type filter
+	req := httptest.NewRequest("GET", "/api/v1/assets?page=1&limit=20&type=chart", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListAssets(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if _, ok := result["assets"]; !ok {
+		t.Error("Expected 'assets' array in response")
+	}
+	if _, ok := result["pagination"]; !ok {
+		t.Error("Expected 'pagination' object in response")
+	}
+}
+
+// TestListAssets_InvalidTypeFilter tests an empty type is no filter while an unknown one is rejected
+func TestListAssets_InvalidTypeFilter(t *testing.T) {
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{
+		assets: map[string]*Asset{
+			"asset-1": {ID: "asset-1", Type: "chart"},
+			"asset-2": {ID: "asset-2", Type: "insight"},
+		},
+	}}}
+
+	tests := []struct {
+		query    string
+		expected int
+		assets   int
+	}{
+		{"type=", http.StatusOK, 2},
+		{"type=chart", http.StatusOK, 1},
+		{"type=chart&type=insight", http.StatusOK, 2},
+		{"type=chart&type=", http.StatusOK, 1},
+		{"type=dashboard", http.StatusBadRequest, 0},
+		{"type=chart&type=dashboard", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets?"+tt.query, nil)
+		w := httptest.NewRecorder()
+
+		handler.ListAssets(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.expected, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var result struct {
+			Assets []map[string]interface{} `json:"assets"`
+		}
+		json.NewDecoder(w.Body).Decode(&result)
+		if len(result.Assets) != tt.assets {
+			t.Errorf("%s: expected %d assets, got %d", tt.query, tt.assets, len(result.Assets))
+		}
+	}
+
+	// The service also accepts "" from other callers
+	result, err := handler.service.ListAssets(DefaultOrganizationID, 1, 20, []string{""}, nil, nil, "")
+	if err != nil {
+		t.Fatalf("ListAssets with an empty type failed: %v", err)
+	}
+	if assets := result["assets"].([]map[string]interface{}); len(assets) != 2 {
+		t.Errorf("Expected an empty type to return all 2 assets, got %d", len(assets))
+	}
+}
+
+// TestListAssets_Search tests q is passed on as a search and blank q is no filter
+func TestListAssets_Search(t *testing.T) {
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{
+		assets: map[string]*Asset{
+			"asset-1": {ID: "asset-1", Type: "chart", Data: json.RawMessage(`{"title":"Revenue by month"}`)},
+			"asset-2": {ID: "asset-2", Type: "insight", Data: json.RawMessage(`{"text":"Users grew 5%"}`)},
+		},
+	}}}
+
+	tests := []struct {
+		query  string
+		assets int
+	}{
+		{"q=revenue", 1},
+		{"q=%20", 2},
+		{"q=churn", 0},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets?"+tt.query, nil)
+		w := httptest.NewRecorder()
+
+		handler.ListAssets(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", tt.query, http.StatusOK, w.Code)
+			continue
+		}
+		var result struct {
+			Assets []map[string]interface{} `json:"assets"`
+		}
+		json.NewDecoder(w.Body).Decode(&result)
+		if len(result.Assets) != tt.assets {
+			t.Errorf("%s: expected %d assets, got %d", tt.query, tt.assets, len(result.Assets))
+		}
+	}
+}
+
+// TestListAssets_PlaceholderIndex tests the ListAssets queries number their placeholders
+// $1..$n to match their arguments for every combination of filters and sorts
+func TestListAssets_PlaceholderIndex(t *testing.T) {
+	placeholder := regexp.MustCompile(`\$(\d+)`)
+	// checkPlaceholders fails unless query uses exactly $1..$len(args)
+	checkPlaceholders := func(t *testing.T, query string, args []interface{}) {
+		t.Helper()
+		used := make(map[int]bool)
+		for _, match := range placeholder.FindAllStringSubmatch(query, -1) {
+			n, _ := strconv.Atoi(match[1])
+			if n < 1 || n > len(args) {
+				t.Fatalf("Placeholder $%d out of range for %d args in %s", n, len(args), query)
+			}
+			used[n] = true
+		}
+		if len(used) != len(args) {
+			t.Fatalf("Expected placeholders $1..$%d, got %v in %s", len(args), used, query)
+		}
+	}
+
+	chart, tag, search := []string{"chart"}, "sales", "revenue"
+	filters := []struct {
+		name       string
+		assetTypes []string
+		tag        *string
+		search     *string
+	}{
+		{"no filters", nil, nil, nil},
+		{"empty types", []string{}, nil, nil},
+		{"type", chart, nil, nil},
+		{"types", []string{"chart", "insight"}, nil, nil},
+		{"tag", nil, &tag, nil},
+		{"type and tag", chart, &tag, nil},
+		{"search", nil, nil, &search},
+		{"type, tag and search", chart, &tag, &search},
+	}
+
+	for _, f := range filters {
+		for _, sort := range []string{"newest", "popularity"} {
+			t.Run(f.name+" "+sort, func(t *testing.T) {
+				countQuery, countArgs, query, args := buildListAssetsQueries(DefaultOrganizationID, 20, 40, f.assetTypes, f.tag, f.search, sort)
+				checkPlaceholders(t, countQuery, countArgs)
+				checkPlaceholders(t, query, args)
+
+				// LIMIT and OFFSET take the last two arguments
+				if args[len(args)-2] != 20 || args[len(args)-1] != 40 {
+					t.Errorf("Expected LIMIT 20 OFFSET 40 as the last args, got %v", args)
+				}
+				if !strings.Contains(query, "LIMIT $"+strconv.Itoa(len(args)-1)+" OFFSET $"+strconv.Itoa(len(args))) {
+					t.Errorf("Expected LIMIT/OFFSET to use the last two placeholders in %s", query)
+				}
+			})
+		}
+	}
+}
+
+// TestCreateAssetTypeAllowsNewAssets tests a type added by an admin can be used right away
+func TestCreateAssetTypeAllowsNewAssets(t *testing.T) {
+	defer ValidAssetTypes.Replace([]string{"chart", "insight", "audience"})
+
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	tests := []struct {
+		body     string
+		expected int
+	}{
+		{`{"name": "dashboard", "schema_json": {"type": "object"}}`, http.StatusCreated},
+		{`{"name": "Dashboard"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/api/v1/admin/asset-types", bytes.NewBufferString(tt.body))
+		w := httptest.NewRecorder()
+
+		handler.CreateAssetType(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("Body %s: expected status %d, got %d", tt.body, tt.expected, w.Code)
+		}
+	}
+
+	if _, err := mockService.CreateAsset(DefaultOrganizationID, "dashboard", json.RawMessage(`{}`), nil); err != nil {
+		t.Errorf("Expected new type to be valid, got %v", err)
+	}
+}
+
+// TestDeleteAsset_Success tests deleting an existing asset through the router,
+// so the assetID comes from the path rather than injected mux vars
+func TestDeleteAsset_Success(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			assets: map[string]*Asset{"asset-456": {ID: "asset-456", Type: "chart"}},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}", handler.DeleteAsset).Methods("DELETE")
+
+	req := httptest.NewRequest("DELETE", "/api/v1/assets/asset-456", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["asset_id"] != "asset-456" {
+		t.Errorf("Expected asset_id asset-456, got %v", result["asset_id"])
+	}
+	if result["favorites_removed"] != float64(0) {
+		t.Errorf("Expected 0 favorites removed, got %v", result["favorites_removed"])
+	}
+}
+
+// TestGetAsset_NotFound tests an unknown asset ID gets 404 with "asset not found"
+func TestGetAsset_NotFound(t *testing.T) {
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{
+		assets: map[string]*Asset{},
+	}}}
+
+	req := httptest.NewRequest("GET", "/api/v1/assets/missing-asset", nil)
+	req = mux.SetURLVars(req, map[string]string{"assetID": "missing-asset"})
+	w := httptest.NewRecorder()
+
+	handler.GetAsset(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+	if errorResp.Error != "asset not found" {
+		t.Errorf("Expected 'asset not found', got %q", errorResp.Error)
+	}
+}
+
+// TestDeleteAsset_NotFound tests 404 response when the asset doesn't exist
+func TestDeleteAsset_NotFound(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			assets: map[string]*Asset{},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}", handler.DeleteAsset).Methods("DELETE")
+
+	req := httptest.NewRequest("DELETE", "/api/v1/assets/missing-asset", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "asset not found" {
+		t.Errorf("Expected 'asset not found', got %q", errorResp.Error)
+	}
+}
+
+// TestDeleteAssetRemovesFavorites tests the response reports how many favorites were cascaded
+func TestDeleteAssetRemovesFavorites(t *testing.T) {
+	asset := &Asset{ID: "asset-456", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			assets: map[string]*Asset{"asset-456": asset},
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: asset}},
+				"user-456": {{ID: "fav-2", Asset: asset}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/assets/asset-456", nil)
+	req = mux.SetURLVars(req, map[string]string{"assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.DeleteAsset(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["asset_id"] != "asset-456" {
+		t.Errorf("Expected asset_id asset-456, got %v", result["asset_id"])
+	}
+	if result["favorites_removed"] != float64(2) {
+		t.Errorf("Expected 2 favorites removed, got %v", result["favorites_removed"])
+	}
+
+	// Deleting again is a 404
+	w = httptest.NewRecorder()
+	handler.DeleteAsset(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestBulkDeleteAssets tests deleting several assets cascades to their favorites
+// and reports missing IDs with 207 Multi-Status
+func TestBulkDeleteAssets(t *testing.T) {
+	first := &Asset{ID: "11111111-1111-1111-1111-111111111111", Type: "chart"}
+	second := &Asset{ID: "22222222-2222-2222-2222-222222222222", Type: "insight"}
+	missing := "33333333-3333-3333-3333-333333333333"
+	storage := &mockStorage{
+		assets: map[string]*Asset{first.ID: first, second.ID: second},
+		favorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1", Asset: first}, {ID: "fav-2", Asset: second}},
+			"user-456": {{ID: "fav-3", Asset: first}},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	body := `{"asset_ids":["` + first.ID + `","` + missing + `","not-a-uuid","` + second.ID + `"]}`
+	req := httptest.NewRequest("DELETE", "/api/v1/assets/bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.BulkDeleteAssets(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusMultiStatus, w.Code, w.Body.String())
+	}
+
+	var result BulkDeleteResult
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result.DeletedAssets != 2 || result.CascadeFavorites != 3 {
+		t.Errorf("Expected 2 assets and 3 favorites deleted, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.Missing, []string{missing, "not-a-uuid"}) {
+		t.Errorf("Expected the missing IDs in request order, got %v", result.Missing)
+	}
+	if len(storage.assets) != 0 {
+		t.Errorf("Expected both assets deleted, %d left", len(storage.assets))
+	}
+
+	// Nothing missing is a plain 200 without the missing list
+	storage.assets = map[string]*Asset{first.ID: first}
+	req = httptest.NewRequest("DELETE", "/api/v1/assets/bulk", strings.NewReader(`{"asset_ids":["`+first.ID+`","`+first.ID+`"]}`))
+	w = httptest.NewRecorder()
+
+	handler.BulkDeleteAssets(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "missing") {
+		t.Errorf("Expected no missing field, got %s", w.Body.String())
+	}
+}
+
+// TestBulkDeleteAssets_Invalid tests 400 responses for empty and oversized batches
+func TestBulkDeleteAssets_Invalid(t *testing.T) {
+	tooMany := make([]string, MaxBulkAssets+1)
+	for i := range tooMany {
+		tooMany[i] = `"id-` + strconv.Itoa(i) + `"`
+	}
+
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"asset_ids":[]}`, "no asset_ids to delete"},
+		{`{}`, "no asset_ids to delete"},
+		{`{"asset_ids":[` + strings.Join(tooMany, ",") + `]}`, "at most " + strconv.Itoa(MaxBulkAssets) + " asset_ids per request"},
+	}
+
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{}}}
+	for _, tt := range tests {
+		req := httptest.NewRequest("DELETE", "/api/v1/assets/bulk", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+
+		handler.BulkDeleteAssets(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+		var errorResp ErrorResponse
+		json.NewDecoder(w.Body).Decode(&errorResp)
+		if errorResp.Error != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, errorResp.Error)
+		}
+	}
+}
+
+// TestListAssetsSort tests the sort parameter is validated
+func TestListAssetsSort(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	tests := []struct {
+		sort     string
+		expected int
+	}{
+		{"popularity", http.StatusOK},
+		{"newest", http.StatusOK},
+		{"alphabetical", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets?sort="+tt.sort, nil)
+		w := httptest.NewRecorder()
+
+		handler.ListAssets(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("Sort %s: expected status %d, got %d", tt.sort, tt.expected, w.Code)
+		}
+	}
+}
+
+// TestListAssetsIncludesFavoriteCount tests each listed asset reports its favorite count
+func TestListAssetsIncludesFavoriteCount(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			assets: map[string]*Asset{
+				"asset-1": {ID: "asset-1", Type: "chart", Data: json.RawMessage(`{}`), FavoriteCount: 3},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/assets", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListAssets(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result struct {
+		Assets []struct {
+			ID            string `json:"id"`
+			FavoriteCount int    `json:"favorite_count"`
+		} `json:"assets"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result.Assets) != 1 {
+		t.Fatalf("Expected 1 asset, got %d", len(result.Assets))
+	}
+	if result.Assets[0].FavoriteCount != 3 {
+		t.Errorf("Expected favorite_count 3, got %d", result.Assets[0].FavoriteCount)
+	}
+}
+
+// TestGetSimilarAssetsSuccess tests that similar assets come back as a flat array
+func TestGetSimilarAssetsSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/assets/asset-456/similar", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetSimilarAssets(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Expected JSON array in response: %v", err)
+	}
+}
+
+// TestGetChartData tests chart data is returned typed, with 400 for other asset
+// types and 422 for data that doesn't fit the chart schema
+func TestGetChartData(t *testing.T) {
+	storage := &mockStorage{
+		assets: map[string]*Asset{
+			"chart-1":   {ID: "chart-1", Type: "chart", Data: json.RawMessage(`{"title":"Sales","x_axis":"Month","y_axis":"Revenue","data":[100,200.5]}`)},
+			"chart-2":   {ID: "chart-2", Type: "chart", Data: json.RawMessage(`{"title":"Sales","data":["high","low"]}`)},
+			"insight-1": {ID: "insight-1", Type: "insight", Data: json.RawMessage(`{"text":"40% of users"}`)},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}/chart-data", handler.GetChartData).Methods("GET")
+
+	tests := []struct {
+		assetID  string
+		expected int
+		message  string
+	}{
+		{"chart-1", http.StatusOK, ""},
+		{"chart-2", http.StatusUnprocessableEntity, "invalid chart data: data has the wrong type"},
+		{"insight-1", http.StatusBadRequest, "asset is not a chart"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets/"+tt.assetID+"/chart-data", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.assetID, tt.expected, w.Code)
+			continue
+		}
+		if tt.message != "" {
+			var errorResp ErrorResponse
+			json.NewDecoder(w.Body).Decode(&errorResp)
+			if errorResp.Error != tt.message {
+				t.Errorf("%s: expected %q, got %q", tt.assetID, tt.message, errorResp.Error)
+			}
+			continue
+		}
+
+		var chart ChartData
+		json.NewDecoder(w.Body).Decode(&chart)
+		expected := ChartData{Title: "Sales", XAxis: "Month", YAxis: "Revenue", Series: []float64{100, 200.5}}
+		if !reflect.DeepEqual(chart, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, chart)
+		}
+	}
+}
+
+// TestGetInsightText tests an insight's text comes back as plain text, cut at
+// MaxInsightTextBytes on a character boundary
+func TestGetInsightText(t *testing.T) {
+	long := strings.Repeat("a", MaxInsightTextBytes-1) + "é" // é is 2 bytes, straddling the limit
+	longData, _ := json.Marshal(map[string]string{"text": long})
+	storage := &mockStorage{
+		assets: map[string]*Asset{
+			"insight-1": {ID: "insight-1", Type: "insight", Data: json.RawMessage(`{"text":"40% of millennials"}`)},
+			"insight-2": {ID: "insight-2", Type: "insight", Data: json.RawMessage(`{"topic":"social"}`)},
+			"insight-3": {ID: "insight-3", Type: "insight", Data: longData},
+			"chart-1":   {ID: "chart-1", Type: "chart", Data: json.RawMessage(`{"title":"Sales"}`)},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}/insight-text", handler.GetInsightText).Methods("GET")
+
+	tests := []struct {
+		assetID  string
+		expected int
+		body     string
+	}{
+		{"insight-1", http.StatusOK, "40% of millennials"},
+		{"insight-2", http.StatusUnprocessableEntity, ""},
+		{"insight-3", http.StatusOK, strings.Repeat("a", MaxInsightTextBytes-1)},
+		{"chart-1", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets/"+tt.assetID+"/insight-text", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.assetID, tt.expected, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+			t.Errorf("%s: expected text/plain, got %q", tt.assetID, got)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: expected %d bytes of text, got %d", tt.assetID, len(tt.body), w.Body.Len())
+		}
+	}
+}
+
+// TestGetAudienceSize tests sizes are read exactly, beyond float64 precision,
+// and other asset types and bad sizes are rejected
+func TestGetAudienceSize(t *testing.T) {
+	storage := &mockStorage{
+		assets: map[string]*Asset{
+			"audience-1": {ID: "audience-1", Type: "audience", Data: json.RawMessage(`{"size":1234567}`)},
+			"audience-2": {ID: "audience-2", Type: "audience", Data: json.RawMessage(`{"size":9007199254740993}`)},
+			"audience-3": {ID: "audience-3", Type: "audience", Data: json.RawMessage(`{"gender":"Male"}`)},
+			"audience-4": {ID: "audience-4", Type: "audience", Data: json.RawMessage(`{"size":"large"}`)},
+			"audience-5": {ID: "audience-5", Type: "audience", Data: json.RawMessage(`{"size":12.5}`)},
+			"chart-1":    {ID: "chart-1", Type: "chart", Data: json.RawMessage(`{"title":"Sales"}`)},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}/audience-size", handler.GetAudienceSize).Methods("GET")
+
+	tests := []struct {
+		assetID  string
+		expected int
+		body     string
+	}{
+		{"audience-1", http.StatusOK, `{"size":1234567}`},
+		{"audience-2", http.StatusOK, `{"size":9007199254740993}`},
+		{"audience-3", http.StatusUnprocessableEntity, ""},
+		{"audience-4", http.StatusUnprocessableEntity, ""},
+		{"audience-5", http.StatusUnprocessableEntity, ""},
+		{"chart-1", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets/"+tt.assetID+"/audience-size", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.assetID, tt.expected, w.Code)
+			continue
+		}
+		if w.Code == http.StatusOK && strings.TrimSpace(w.Body.String()) != tt.body {
+			t.Errorf("%s: expected %s, got %s", tt.assetID, tt.body, w.Body.String())
+		}
+	}
+}
+
+// TestDownloadAsset tests a chart's download_url is streamed with its
+// Content-Type, and the URL is cached
+func TestDownloadAsset(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/report.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		io.WriteString(w, "month,revenue\nJan,100\n")
+	}))
+	defer upstream.Close()
+
+	storage := &mockStorage{
+		assets: map[string]*Asset{
+			"chart-1":   {ID: "chart-1", Type: "chart", Data: json.RawMessage(`{"download_url":"` + upstream.URL + `/report.csv"}`)},
+			"chart-2":   {ID: "chart-2", Type: "chart", Data: json.RawMessage(`{"title":"Sales"}`)},
+			"chart-3":   {ID: "chart-3", Type: "chart", Data: json.RawMessage(`{"download_url":"` + upstream.URL + `/missing.csv"}`)},
+			"chart-4":   {ID: "chart-4", Type: "chart", Data: json.RawMessage(`{"download_url":"file:///etc/passwd"}`)},
+			"insight-1": {ID: "insight-1", Type: "insight", Data: json.RawMessage(`{"text":"B"}`)},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage, cache: NewMemoryCache(), downloadClient: upstream.Client()}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}/download", handler.DownloadAsset).Methods("GET")
+
+	tests := []struct {
+		assetID  string
+		expected int
+	}{
+		{"chart-1", http.StatusOK},
+		{"chart-2", http.StatusUnprocessableEntity},
+		{"chart-3", http.StatusBadGateway},
+		{"chart-4", http.StatusUnprocessableEntity},
+		{"insight-1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/assets/"+tt.assetID+"/download", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.assetID, tt.expected, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+			t.Errorf("%s: expected text/csv, got %q", tt.assetID, ct)
+		}
+		for header, value := range map[string]string{
+			"X-Content-Type-Options":  "nosniff",
+			"Content-Disposition":     "attachment",
+			"Content-Security-Policy": "sandbox",
+		} {
+			if got := w.Header().Get(header); got != value {
+				t.Errorf("%s: expected %s %q, got %q", tt.assetID, header, value, got)
+			}
+		}
+		if w.Body.String() != "month,revenue\nJan,100\n" {
+			t.Errorf("%s: unexpected body %q", tt.assetID, w.Body.String())
+		}
+	}
+
+	// The URL is served from the cache even after the asset loses it
+	storage.assets["chart-1"].Data = json.RawMessage(`{"title":"Sales"}`)
+	req := httptest.NewRequest("GET", "/api/v1/assets/chart-1/download", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected cached download URL to be used, got status %d", w.Code)
+	}
+}
+
+// TestDownloadClientRefusesPrivateAddresses tests download URLs can't reach
+// services on the server's own network
+func TestDownloadClientRefusesPrivateAddresses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to reach a loopback server")
+	}))
+	defer upstream.Close()
+
+	if resp, err := newDownloadClient().Get(upstream.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected a loopback download URL to be refused")
+	}
+
+	for _, ip := range []string{"127.0.0.1", "10.0.0.1", "192.168.1.1", "169.254.169.254", "::1", "0.0.0.0"} {
+		if isPublicIP(net.ParseIP(ip)) {
+			t.Errorf("Expected %s not to be public", ip)
+		}
+	}
+	if !isPublicIP(net.ParseIP("93.184.216.34")) {
+		t.Error("Expected 93.184.216.34 to be public")
+	}
+}
+
+// TestWebhookClientRefusesPrivateAddresses tests webhooks can't be pointed
+// at services on the server's own network
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to reach a loopback server")
+	}))
+	defer upstream.Close()
+
+	dispatcher := NewWebhookDispatcher(nil)
+	if resp, err := dispatcher.client.Post(upstream.URL, "application/json", strings.NewReader("{}")); err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected a loopback webhook URL to be refused")
+	}
+}
+
+// TestValidateAssetData_DownloadURL tests a chart's download_url must be an http(s) URL
+func TestValidateAssetData_DownloadURL(t *testing.T) {
+	tests := []struct {
+		downloadURL interface{}
+		valid       bool
+	}{
+		{"https://files.example.com/a.csv", true},
+		{"http://files.example.com/a.csv", true},
+		{"ftp://files.example.com/a.csv", false},
+		{"/a.csv", false},
+		{42, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateAssetData("chart", map[string]interface{}{"download_url": tt.downloadURL})
+		if (err == nil) != tt.valid {
+			t.Errorf("%v: expected valid=%v, got %v", tt.downloadURL, tt.valid, err)
+		}
+	}
+}
+
+// TestProjectAsset tests only requested top-level and nested data fields are returned
+func TestProjectAsset(t *testing.T) {
+	asset := &Asset{
+		ID:   "asset-123",
+		Type: "chart",
+		Data: json.RawMessage(`{"title": "Sales", "axes": {"x": "month", "y": "revenue"}, "points": [1, 2, 3]}`),
+	}
+
+	projected := ProjectAsset(asset, []string{"id", "data.title", "data.axes.x", "data.missing", "unknown"})
+
+	encoded, _ := json.Marshal(projected)
+	expected := `{"data":{"axes":{"x":"month"},"title":"Sales"},"id":"asset-123"}`
+	if string(encoded) != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+
+	// No fields returns everything
+	full := ProjectAsset(asset, nil)
+	for _, key := range []string{"id", "type", "data", "tags", "favorite_count"} {
+		if _, ok := full[key]; !ok {
+			t.Errorf("Expected %s in full asset", key)
+		}
+	}
+}
+
+// ============================================================================
+// FAVORITES TESTS
+// ============================================================================
+
+// TestGetFavoritesUserNotFound tests 404 response when user doesn't exist
+func TestGetFavoritesUserNotFound(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: false, // User doesn't exist
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/nonexistent-user-id/favorites?page=1", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetFavorites(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error == "" {
+		t.Error("Expected error message in response")
+	}
+}
+
+// TestGetFavorites_InvalidAssetTypeFilter tests 400 response for an unknown type filter
+func TestGetFavorites_InvalidAssetTypeFilter(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/users/{userID}/favorites", handler.GetFavorites).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?type=unknown", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "invalid asset type" {
+		t.Errorf("Expected 'invalid asset type', got %q", errorResp.Error)
+	}
+}
+
+// TestParseFavoriteSort tests named sorts, multi-field sorts and their order
+func TestParseFavoriteSort(t *testing.T) {
+	tests := []struct {
+		sort    string
+		order   string
+		want    []SortField
+		wantErr error
+	}{
+		{"", "", nil, nil},
+		{"newest", "", nil, nil},
+		{"custom", "", []SortField{{Field: "order_index"}, {Field: "added_at", Desc: true}}, nil},
+		{"asset_type,added_at", "", []SortField{{Field: "asset_type"}, {Field: "added_at"}}, nil},
+		{"asset_type,added_at", "asc,desc", []SortField{{Field: "asset_type"}, {Field: "added_at", Desc: true}}, nil},
+		{"is_pinned", "DESC", []SortField{{Field: "is_pinned", Desc: true}}, nil},
+		{"asset_type,added_at", "asc", nil, ErrSortOrderMismatch},
+		{"asset_type", "up", nil, ErrInvalidOrder},
+		{"asset_type,title", "", nil, ErrInvalidSort},
+		{"added_at,added_at", "", nil, ErrInvalidSort},
+		{"newest", "desc", nil, ErrOrderWithoutSort},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFavoriteSort(tt.sort, tt.order)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("sort=%q order=%q: expected error %q, got %v", tt.sort, tt.order, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sort=%q order=%q: unexpected error %v", tt.sort, tt.order, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort=%q order=%q: expected %v, got %v", tt.sort, tt.order, tt.want, got)
+		}
+	}
+
+	if got := favoriteOrderBy([]SortField{{Field: "asset_type"}, {Field: "added_at", Desc: true}}); got != "a.type ASC, f.added_at DESC, f.id DESC" {
+		t.Errorf("Expected ORDER BY a.type ASC, f.added_at DESC, f.id DESC, got %s", got)
+	}
+	if got := favoriteOrderBy([]SortField{{Field: "asset_type"}}); got != "a.type ASC, f.id ASC" {
+		t.Errorf("Expected ORDER BY a.type ASC, f.id ASC, got %s", got)
+	}
+}
+
+// TestFavoriteKeyset tests the keyset condition follows favoriteOrderBy's order
+func TestFavoriteKeyset(t *testing.T) {
+	addedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	last := &Favorite{ID: "fav-1", AddedAt: addedAt, OrderIndex: 3, Asset: &Asset{Type: "chart"}}
+
+	tests := []struct {
+		sort      []SortField
+		condition string
+		values    []interface{}
+	}{
+		{nil, "(f.added_at, f.id) < ($3, $4)", []interface{}{addedAt, "fav-1"}},
+		{
+			[]SortField{{Field: "order_index"}, {Field: "asset_type"}},
+			"(f.order_index, a.type, f.id) > ($3, $4, $5)",
+			[]interface{}{3, "chart", "fav-1"},
+		},
+		{
+			[]SortField{{Field: "asset_type"}, {Field: "added_at", Desc: true}},
+			"((a.type > $3) OR (a.type = $3 AND f.added_at < $4) OR (a.type = $3 AND f.added_at = $4 AND f.id < $5))",
+			[]interface{}{"chart", addedAt, "fav-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		condition, values := favoriteKeyset(tt.sort, last, 3)
+		if condition != tt.condition {
+			t.Errorf("%v: expected %s, got %s", tt.sort, tt.condition, condition)
+		}
+		if !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("%v: expected values %v, got %v", tt.sort, tt.values, values)
+		}
+	}
+}
+
+// TestGetFavorites_InvalidSortOrder tests sort and order mismatches get 400
+func TestGetFavorites_InvalidSortOrder(t *testing.T) {
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{userExists: true}}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/users/{userID}/favorites", handler.GetFavorites).Methods("GET")
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"sort=asset_type,added_at&order=asc,desc", http.StatusOK},
+		{"sort=asset_type,added_at&order=desc", http.StatusBadRequest},
+		{"sort=asset_type&order=sideways", http.StatusBadRequest},
+		{"sort=title", http.StatusBadRequest},
+		{"sort=asset_type&before=2024-01-01T00:00:00Z", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?"+tt.query, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.expected, w.Code)
+		}
+	}
+}
+
+// TestGetFavorites_TypeChart tests the type filter reaches storage
+func TestGetFavorites_TypeChart(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {
+					{ID: "fav-1", UserID: "user-123", Asset: &Asset{ID: "asset-1", Type: "chart"}},
+					{ID: "fav-2", UserID: "user-123", Asset: &Asset{ID: "asset-2", Type: "insight"}},
+					{ID: "fav-3", UserID: "user-123", Asset: &Asset{ID: "asset-3", Type: "chart"}},
+				},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/users/{userID}/favorites", handler.GetFavorites).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?type=chart", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result PaginatedResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result.Favorites) != 2 || result.Pagination.Total != 2 {
+		t.Fatalf("Expected 2 chart favorites, got %d of %d", len(result.Favorites), result.Pagination.Total)
+	}
+	for _, fav := range result.Favorites {
+		if fav.Asset.Type != "chart" {
+			t.Errorf("Expected only chart favorites, got %s", fav.Asset.Type)
+		}
+	}
+}
+
+// TestGetFavorites_AssetCreatedAt tests favorites list their asset's created_at
+func TestGetFavorites_AssetCreatedAt(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {
+				{ID: "fav-1", UserID: "user-123", Asset: &Asset{ID: "asset-1", Type: "chart", CreatedAt: createdAt}},
+			},
+		},
+	}}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/users/{userID}/favorites", handler.GetFavorites).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result PaginatedResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result.Favorites) != 1 {
+		t.Fatalf("Expected 1 favorite, got %d", len(result.Favorites))
+	}
+	if got := result.Favorites[0].Asset.CreatedAt; got.IsZero() || !got.Equal(createdAt) {
+		t.Errorf("Expected asset created_at %v, got %v", createdAt, got)
+	}
+}
+
+// TestGetFavoritesSuccess tests retrieving user's favorite assets with pagination
+func TestGetFavoritesSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?page=1&limit=20", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result PaginatedResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	// Verify response structure
+	if result.Pagination.Page != 1 {
+		t.Errorf("Expected page 1, got %d", result.Pagination.Page)
+	}
+}
+
+// TestGetFavoritesWithTypeFilter tests filtering favorites by asset type
+func TestGetFavoritesWithTypeFilter(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	// Filter for only 'chart' type assets
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?page=1&type=chart", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// TestAddFavoriteSuccess tests adding an asset to user's favorites
+func TestAddFavoriteSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	// Request body: asset_id and optional description
+	body := map[string]interface{}{
+		"asset_id":    "asset-456",
+		"description": "Important quarterly report",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.AddFavorite(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d (Created), got %d", http.StatusCreated, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["id"] == nil {
+		t.Error("Expected favorite id in response")
+	}
+	if addedAt, _ := result["added_at"].(string); !strings.HasSuffix(addedAt, "Z") {
+		t.Errorf("Expected added_at in UTC, got %q", addedAt)
+	}
+}
+
+// TestAddFavoriteIdempotencyKeyReplay tests that a retried request replays the first response
+func TestAddFavoriteIdempotencyKeyReplay(t *testing.T) {
+	storage := &mockStorage{
+		userExists: true,
+	}
+	mockService := &Service{
+		storage: storage,
+	}
+	handler := &RequestHandler{service: mockService}
+
+	body := map[string]interface{}{
+		"asset_id": "asset-456",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	var responses []*httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites", bytes.NewReader(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "retry-abc")
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+
+		handler.AddFavorite(w, req)
+		responses = append(responses, w)
+	}
+
+	if responses[1].Code != responses[0].Code {
+		t.Errorf("Expected replayed status %d, got %d", responses[0].Code, responses[1].Code)
+	}
+	if responses[1].Body.String() != responses[0].Body.String() {
+		t.Error("Expected replayed body to match the first response")
+	}
+	if responses[1].Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected Idempotent-Replayed header on retry")
+	}
+
+	// The favorite must only have been added once
+	if added := len(storage.favorites["user-123"]); added != 1 {
+		t.Errorf("Expected 1 favorite added, got %d", added)
+	}
+}
+
+// TestAddFavoriteWithoutDescription tests adding favorite without custom description
+func TestAddFavoriteWithoutDescription(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	// Request body: only asset_id (description is optional)
+	body := map[string]interface{}{
+		"asset_id": "asset-789",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.AddFavorite(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+// TestAddFavoriteConflict tests 409 response when the asset is already favorited
+func TestAddFavoriteConflict(t *testing.T) {
+	asset := &Asset{ID: "asset-456", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", UserID: "user-123", Asset: asset}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	body := map[string]interface{}{
+		"asset_id": "asset-456",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.AddFavorite(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d (Conflict), got %d", http.StatusConflict, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected Content-Type application/problem+json, got %q", ct)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "asset already in favorites" {
+		t.Errorf("Expected 'asset already in favorites', got %q", errorResp.Error)
+	}
+}
+
+// TestAddFavoriteUserNotFound tests adding favorite when user doesn't exist
+func TestAddFavoriteUserNotFound(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: false,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	body := map[string]interface{}{
+		"asset_id": "asset-456",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest("POST", "/api/v1/users/nonexistent/favorites", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.AddFavorite(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestGetFavorite tests fetching one favorite by asset ID, and 404 when it isn't favorited
+func TestGetFavorite(t *testing.T) {
+	const (
+		favorited = "11111111-1111-1111-1111-111111111111"
+		other     = "22222222-2222-2222-2222-222222222222"
+	)
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1", UserID: "user-123", Asset: &Asset{ID: favorited, Type: "chart"}}},
+		},
+	}}}
+	router := NewRouter(&Config{}, handler.service, handler)
+
+	tests := []struct {
+		path     string
+		expected int
+		errorMsg string
+	}{
+		{"/api/v1/users/user-123/favorites/" + favorited, http.StatusOK, ""},
+		{"/api/v1/users/user-123/favorites/" + other, http.StatusNotFound, "asset not in user's favorites"},
+		{"/api/v1/users/user-123/favorites/asset-789", http.StatusNotFound, "asset not in user's favorites"},
+		// POST-only sub-routes are taken for an asset ID by GET
+		{"/api/v1/users/user-123/favorites/check", http.StatusNotFound, "asset not in user's favorites"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.expected, w.Code)
+			continue
+		}
+		if tt.expected != http.StatusOK {
+			var errorResp ErrorResponse
+			json.NewDecoder(w.Body).Decode(&errorResp)
+			if errorResp.Error != tt.errorMsg {
+				t.Errorf("%s: expected %q, got %q", tt.path, tt.errorMsg, errorResp.Error)
+			}
+			continue
+		}
+
+		var result Favorite
+		json.NewDecoder(w.Body).Decode(&result)
+		if result.ID != "fav-1" || result.Asset == nil || result.Asset.ID != favorited {
+			t.Errorf("Expected favorite fav-1 with asset %s, got %+v", favorited, result)
+		}
+	}
+
+	// Static routes under /favorites still win over {assetID}
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+	if errorResp.Error == "asset not in user's favorites" {
+		t.Error("Expected /favorites/stats not to be treated as an asset ID")
+	}
+}
+
+// TestUpdateFavoriteDescription_SingleRead tests that updating one favorite of many reads only that favorite
+func TestUpdateFavoriteDescription_SingleRead(t *testing.T) {
+	favorites := make([]*Favorite, 0, 50)
+	for i := 0; i < 50; i++ {
+		favorites = append(favorites, &Favorite{
+			ID:    "fav-" + strconv.Itoa(i),
+			Asset: &Asset{ID: "asset-" + strconv.Itoa(i), Type: "chart"},
+		})
+	}
+	storage := &mockStorage{
+		userExists: true,
+		favorites:  map[string][]*Favorite{"user-123": favorites},
+	}
+	service := &Service{storage: storage}
+
+	favorite, err := service.UpdateFavoriteDescription(DefaultOrganizationID, "user-123", "asset-42", "Q3 numbers")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if favorite.ID != "fav-42" {
+		t.Errorf("Expected fav-42, got %s", favorite.ID)
+	}
+	if storage.favoriteReads != 1 {
+		t.Errorf("Expected 1 favorite read, got %d", storage.favoriteReads)
+	}
+}
+
+// TestUpdateFavoriteDescriptionSuccess tests updating a favorite's custom description
+func TestUpdateFavoriteDescriptionSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: &Asset{ID: "asset-456", Type: "chart"}}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	updateBody := map[string]interface{}{
+		"description": "Updated: Critical metrics for Q4 review",
+	}
+	bodyBytes, _ := json.Marshal(updateBody)
+
+	req := httptest.NewRequest("PUT", "/api/v1/users/user-123/favorites/asset-456", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.UpdateFavorite(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d (OK), got %d", http.StatusOK, w.Code)
+	}
+
+	var result Favorite
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result.DescriptionOverride == nil || *result.DescriptionOverride != "Updated: Critical metrics for Q4 review" {
+		t.Errorf("Expected updated description, got %v", result.DescriptionOverride)
+	}
+}
+
+// TestUpdateFavoriteDescription_EmptyDescriptionReturns400 tests a missing or blank description is rejected
+func TestUpdateFavoriteDescription_EmptyDescriptionReturns400(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: &Asset{ID: "asset-456", Type: "chart"}}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	for _, body := range []string{`{}`, `{"description": ""}`, `{"description": "   "}`} {
+		req := httptest.NewRequest("PUT", "/api/v1/users/user-123/favorites/asset-456", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": "asset-456"})
+		w := httptest.NewRecorder()
+
+		handler.UpdateFavorite(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d (Bad Request), got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// TestRemoveFavoriteSuccess tests soft-deleting a favorite (removes from user's list)
+func TestRemoveFavoriteSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/users/user-123/favorites/asset-456", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.RemoveFavorite(w, req)
+
+	// Soft delete returns 204 No Content
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d (No Content), got %d", http.StatusNoContent, w.Code)
+	}
+}
+
+// TestRemoveFavoriteUserNotFound tests removing favorite when user doesn't exist
+func TestRemoveFavoriteUserNotFound(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: false,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/users/nonexistent/favorites/asset-456", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "nonexistent", "assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.RemoveFavorite(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestRemoveFavoriteAssetNotInFavorites tests removing an asset the user never favorited
+func TestRemoveFavoriteAssetNotInFavorites(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/users/user-123/favorites/asset-456", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.RemoveFavorite(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d (Not Found), got %d", http.StatusNotFound, w.Code)
+	}
+
+	var result map[string]string
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["error"] != "asset not in user's favorites" {
+		t.Errorf("Expected asset not in user's favorites error, got %q", result["error"])
+	}
+}
+
+// TestRestoreFavoriteSuccess tests undoing a removal returns the favorite again
+func TestRestoreFavoriteSuccess(t *testing.T) {
+	description := "Weekly numbers"
+	asset := &Asset{ID: "asset-456", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", UserID: "user-123", Asset: asset, DescriptionOverride: &description}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	if err := mockService.RemoveFavorite(DefaultOrganizationID, "user-123", "asset-456"); err != nil {
+		t.Fatalf("RemoveFavorite failed: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/asset-456/restore", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.RestoreFavorite(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var favorite Favorite
+	json.NewDecoder(w.Body).Decode(&favorite)
+
+	if favorite.ID != "fav-1" {
+		t.Errorf("Expected restored favorite fav-1, got %q", favorite.ID)
+	}
+	if favorite.DescriptionOverride == nil || *favorite.DescriptionOverride != description {
+		t.Errorf("Expected description to survive the restore, got %v", favorite.DescriptionOverride)
+	}
+}
+
+// TestListDeletedFavorites tests removed favorites are listed most recent first
+func TestListDeletedFavorites(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {
+					{ID: "fav-1", UserID: "user-123", Asset: &Asset{ID: "asset-1", Type: "chart"}},
+					{ID: "fav-2", UserID: "user-123", Asset: &Asset{ID: "asset-2", Type: "insight"}},
+					{ID: "fav-3", UserID: "user-123", Asset: &Asset{ID: "asset-3", Type: "audience"}},
+				},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	for _, assetID := range []string{"asset-1", "asset-3"} {
+		if err := mockService.RemoveFavorite(DefaultOrganizationID, "user-123", assetID); err != nil {
+			t.Fatalf("RemoveFavorite failed: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/deleted", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.ListDeletedFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result PaginatedResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	var ids []string
+	for _, fav := range result.Favorites {
+		ids = append(ids, fav.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"fav-3", "fav-1"}) || result.Pagination.Total != 2 {
+		t.Errorf("Expected [fav-3 fav-1] of 2, got %v of %d", ids, result.Pagination.Total)
+	}
+}
+
+// TestRestoreFavoriteNotRemoved tests 404 response when there is nothing to restore
+func TestRestoreFavoriteNotRemoved(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/asset-456/restore", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": "asset-456"})
+	w := httptest.NewRecorder()
+
+	handler.RestoreFavorite(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var errorResp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&errorResp)
+
+	if errorResp.Error != "no removed favorite to restore" {
+		t.Errorf("Expected 'no removed favorite to restore', got %q", errorResp.Error)
+	}
+}
+
+// TestJanitorPurge tests the janitor purges removed favorites, then deleted assets, and stops with its context
+func TestJanitorPurge(t *testing.T) {
+	storage := &mockStorage{
+		removedFavorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1"}, {ID: "fav-2"}},
+		},
+	}
+	janitor := NewJanitor(storage, FavoriteRestoreWindow, DeletedAssetRetention)
+
+	janitor.purge()
+	if len(storage.removedFavorites) != 0 {
+		t.Errorf("Expected removed favorites to be purged, got %v", storage.removedFavorites)
+	}
+	if !reflect.DeepEqual(storage.purges, []string{"favorites", "assets"}) {
+		t.Errorf("Expected favorites purged before assets, got %v", storage.purges)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		janitor.Run(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once its context is cancelled")
+	}
+}
+
+// TestBackgroundJobsStopOnCancel tests that the periodic jobs return once
+// their context is cancelled. None of them touches its dependency before the
+// first tick, so nil ones are fine here.
+func TestBackgroundJobsStopOnCancel(t *testing.T) {
+	jobs := map[string]func(context.Context){
+		"cleanupIdempotencyKeys": func(ctx context.Context) { cleanupIdempotencyKeys(ctx, nil, time.Hour) },
+		"cleanupRequestMetrics":  func(ctx context.Context) { cleanupRequestMetrics(ctx, nil, time.Hour) },
+		"sweepCache":             func(ctx context.Context) { sweepCache(ctx, NewMemoryCache(), time.Hour) },
+		"refreshAssetTypes":      func(ctx context.Context) { refreshAssetTypes(ctx, nil, time.Hour) },
+	}
+
+	for name, job := range jobs {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			job(ctx)
+			close(done)
+		}()
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s to return once its context is cancelled", name)
+		}
+	}
+}
+
+// TestGetFavoriteHistorySuccess tests listing a favorite's previous descriptions
+func TestGetFavoriteHistorySuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/asset-456/history", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetFavoriteHistory(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if _, ok := result["history"]; !ok {
+		t.Error("Expected 'history' array in response")
+	}
+}
+
+// TestGetFavoriteGroups tests every asset type is present and groups respect per_group
+func TestGetFavoriteGroups(t *testing.T) {
+	chart := &Asset{ID: "asset-1", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {
+					{ID: "fav-1", Asset: chart},
+					{ID: "fav-2", Asset: chart},
+				},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/groups?per_group=1", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetFavoriteGroups(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string][]map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result["chart"]) != 1 {
+		t.Errorf("Expected 1 chart favorite, got %d", len(result["chart"]))
+	}
+	for _, assetType := range []string{"insight", "audience"} {
+		group, ok := result[assetType]
+		if !ok || len(group) != 0 {
+			t.Errorf("Expected empty %s group, got %v", assetType, group)
+		}
+	}
+}
+
+// TestGetMostRecentFavoritePerType tests one favorite per type, null for types without any
+func TestGetMostRecentFavoritePerType(t *testing.T) {
+	now := time.Now()
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {
+					{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}, AddedAt: now.Add(-2 * time.Hour)},
+					{ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "chart"}, AddedAt: now.Add(-time.Hour)},
+					{ID: "fav-3", Asset: &Asset{ID: "asset-3", Type: "insight"}, AddedAt: now.Add(-3 * time.Hour)},
+				},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/most-recent-per-type", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetMostRecentFavoritePerType(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]*Favorite
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["chart"] == nil || result["chart"].ID != "fav-2" {
+		t.Errorf("Expected newest chart fav-2, got %v", result["chart"])
+	}
+	if result["insight"] == nil || result["insight"].ID != "fav-3" {
+		t.Errorf("Expected insight fav-3, got %v", result["insight"])
+	}
+	if audience, ok := result["audience"]; !ok || audience != nil {
+		t.Errorf("Expected audience to be null, got %v (present: %v)", audience, ok)
+	}
+}
+
+// TestFavoriteJSON_DescriptionOverride tests description_override is omitted when unset
+func TestFavoriteJSON_DescriptionOverride(t *testing.T) {
+	override := "My chart"
+	tests := []struct {
+		name     string
+		override *string
+		want     interface{}
+		present  bool
+	}{
+		{"unset", nil, nil, false},
+		{"set", &override, "My chart", true},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(&Favorite{ID: "fav-1", UserID: "user-123", DescriptionOverride: tt.override})
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", tt.name, err)
+		}
+		var fields map[string]interface{}
+		json.Unmarshal(data, &fields)
+		value, ok := fields["description_override"]
+		if ok != tt.present || value != tt.want {
+			t.Errorf("%s: expected description_override %v (present: %v), got %v (present: %v) in %s", tt.name, tt.want, tt.present, value, ok, data)
+		}
+	}
+}
+
+// TestFavoriteResponsesIncludeID tests every handler returning favorites includes their id
+func TestFavoriteResponsesIncludeID(t *testing.T) {
+	asset := &Asset{ID: "asset-456", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", UserID: "user-123", Asset: asset}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+	vars := map[string]string{"userID": "user-123", "assetID": "asset-456"}
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handle  http.HandlerFunc
+		extract func(body []byte) []map[string]interface{}
+	}{
+		{"add", "POST", `{"asset_id": "asset-789"}`, handler.AddFavorite, decodeSingleFavorite},
+		{"update", "PUT", `{"description": "new"}`, handler.UpdateFavorite, decodeSingleFavorite},
+		{"random", "GET", "", handler.GetRandomFavorite, decodeSingleFavorite},
+		{"groups", "GET", "", handler.GetFavoriteGroups, func(body []byte) []map[string]interface{} {
+			var groups map[string][]map[string]interface{}
+			json.Unmarshal(body, &groups)
+			return groups["chart"]
+		}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/users/user-123/favorites", bytes.NewBufferString(tt.body))
+		req = mux.SetURLVars(req, vars)
+		w := httptest.NewRecorder()
+
+		tt.handle(w, req)
+
+		if w.Code >= 300 {
+			t.Errorf("%s: expected success, got %d", tt.name, w.Code)
+			continue
+		}
+		favorites := tt.extract(w.Body.Bytes())
+		if len(favorites) == 0 {
+			t.Errorf("%s: expected at least one favorite in response", tt.name)
+		}
+		for _, fav := range favorites {
+			if id, _ := fav["id"].(string); id == "" {
+				t.Errorf("%s: expected non-empty id, got %v", tt.name, fav["id"])
+			}
+		}
+	}
+}
+
+// decodeSingleFavorite decodes a response holding one favorite
+func decodeSingleFavorite(body []byte) []map[string]interface{} {
+	var fav map[string]interface{}
+	json.Unmarshal(body, &fav)
+	return []map[string]interface{}{fav}
+}
+
+// TestFavoriteExists tests 200 for a favorited asset and 404 otherwise
+func TestFavoriteExists(t *testing.T) {
+	const (
+		favorited = "11111111-1111-1111-1111-111111111111"
+		other     = "22222222-2222-2222-2222-222222222222"
+	)
+	mockService := &Service{
+		storage: &mockStorage{
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: &Asset{ID: favorited, Type: "chart"}}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	tests := []struct {
+		assetID  string
+		expected int
+		favorite bool
+	}{
+		{favorited, http.StatusOK, true},
+		{other, http.StatusNotFound, false},
+		{"asset-789", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/"+tt.assetID+"/exists", nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": tt.assetID})
+		w := httptest.NewRecorder()
+
+		handler.FavoriteExists(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.assetID, tt.expected, w.Code)
+		}
+
+		var result map[string]bool
+		json.NewDecoder(w.Body).Decode(&result)
+
+		if result["favorited"] != tt.favorite {
+			t.Errorf("%s: expected favorited %v, got %v", tt.assetID, tt.favorite, result["favorited"])
+		}
+	}
+}
+
+// TestCheckFavorites tests every requested ID is answered and the batch size is capped
+func TestCheckFavorites(t *testing.T) {
+	favorited := "11111111-1111-1111-1111-111111111111"
+	other := "22222222-2222-2222-2222-222222222222"
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: &Asset{ID: favorited, Type: "chart"}}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	body := `{"asset_ids": ["` + favorited + `", "` + other + `", "not-a-uuid"]}`
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/check", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.CheckFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]bool
+	json.NewDecoder(w.Body).Decode(&result)
+
+	expected := map[string]bool{favorited: true, other: false, "not-a-uuid": false}
+	if len(result) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), result)
+	}
+	for assetID, want := range expected {
+		if got, ok := result[assetID]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v", assetID, want, got)
+		}
+	}
+
+	// More than MaxCheckFavoritesIDs is rejected
+	ids := make([]string, MaxCheckFavoritesIDs+1)
+	for i := range ids {
+		ids[i] = other
+	}
+	tooMany, _ := json.Marshal(map[string][]string{"asset_ids": ids})
+	req = httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/check", bytes.NewBuffer(tooMany))
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w = httptest.NewRecorder()
+
+	handler.CheckFavorites(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestSearchFavorites tests descriptions are matched case-insensitively and q is required
+func TestSearchFavorites(t *testing.T) {
+	quarterly := "Quarterly revenue"
+	churn := "Churn by region"
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {
+					{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}, DescriptionOverride: &quarterly},
+					{ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "chart"}, DescriptionOverride: &churn},
+				},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/search?q=REVENUE", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.SearchFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result PaginatedResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result.Favorites) != 1 || result.Favorites[0].ID != "fav-1" {
+		t.Errorf("Expected only fav-1 to match, got %v", result.Favorites)
+	}
+
+	// Empty q is a bad request
+	req = httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/search?q=", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w = httptest.NewRecorder()
+
+	handler.SearchFavorites(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for empty q, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestGetFavoritesBeforeCursor tests cursor pages follow next_before and skip the count
+func TestGetFavoritesBeforeCursor(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {
+				{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}, AddedAt: now.Add(-1 * time.Hour)},
+				{ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "chart"}, AddedAt: now.Add(-2 * time.Hour)},
+				{ID: "fav-3", Asset: &Asset{ID: "asset-3", Type: "chart"}, AddedAt: now.Add(-3 * time.Hour)},
+			},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	get := func(query string) (int, PaginatedResponse) {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+		handler.GetFavorites(w, req)
+		var result PaginatedResponse
+		json.NewDecoder(w.Body).Decode(&result)
+		return w.Code, result
+	}
+
+	code, result := get("limit=2&before=" + now.Format(time.RFC3339))
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if len(result.Favorites) != 2 || !result.Pagination.HasNext || result.Pagination.Total != -1 {
+		t.Fatalf("Expected 2 favorites, has_next and no total, got %+v", result.Pagination)
+	}
+	if result.Pagination.NextBefore == nil || !result.Pagination.NextBefore.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("Expected next_before to be the last added_at, got %v", result.Pagination.NextBefore)
+	}
+
+	code, result = get("limit=2&before=" + result.Pagination.NextBefore.Format(time.RFC3339))
+	if code != http.StatusOK || len(result.Favorites) != 1 || result.Favorites[0].ID != "fav-3" || result.Pagination.HasNext {
+		t.Errorf("Expected only fav-3 on the last page, got %d %+v", code, result.Favorites)
+	}
+
+	if code, _ := get("before=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid before, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := get("sort=custom&before=" + now.Format(time.RFC3339)); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for before with sort=custom, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := get("before_id=3f1c2b9e-8d4a-4c1e-9b7a-2e5d6f8a9c0b"); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for before_id without before, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := get("before=" + now.Format(time.RFC3339) + "&before_id=fav-1"); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a before_id that isn't a UUID, got %d", http.StatusBadRequest, code)
+	}
+}
+
+// TestGetFavoritesBeforeCursorTies tests favorites sharing the last added_at
+// of a page are continued by before_id instead of skipped
+func TestGetFavoritesBeforeCursorTies(t *testing.T) {
+	addedAt := time.Now().UTC().Truncate(time.Second)
+	// Newest first, ties by ID descending, as the storage orders them
+	ids := []string{
+		"c0000000-0000-0000-0000-000000000000",
+		"b0000000-0000-0000-0000-000000000000",
+		"a0000000-0000-0000-0000-000000000000",
+	}
+	var favorites []*Favorite
+	for _, id := range ids {
+		favorites = append(favorites, &Favorite{ID: id, Asset: &Asset{ID: "asset-" + id, Type: "chart"}, AddedAt: addedAt})
+	}
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{
+		userExists: true,
+		favorites:  map[string][]*Favorite{"user-123": favorites},
+	}}}
+
+	var seen []string
+	query := "limit=1"
+	for i := 0; i < len(ids)+1 && query != ""; i++ {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+		handler.GetFavorites(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", query, http.StatusOK, w.Code)
+		}
+
+		var result PaginatedResponse
+		json.NewDecoder(w.Body).Decode(&result)
+		for _, favorite := range result.Favorites {
+			seen = append(seen, favorite.ID)
+		}
+		query = ""
+		if result.Pagination.HasNext && result.Pagination.NextBefore != nil {
+			query = "limit=1&before=" + result.Pagination.NextBefore.Format(time.RFC3339) +
+				"&before_id=" + result.Pagination.NextBeforeID
+		}
+	}
+
+	if !reflect.DeepEqual(seen, ids) {
+		t.Errorf("Expected every favorite once, got %v", seen)
+	}
+}
+
+// TestGetFavoritesNextBeforeSkipsPins tests next_before continues after the
+// last unpinned favorite, cursor pages leave pins out, and sorts other than
+// newest get no next_before
+func TestGetFavoritesNextBeforeSkipsPins(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			// Pinned first, as the default sort lists them
+			"user-123": {
+				{ID: "fav-pinned", Asset: &Asset{ID: "asset-0", Type: "chart"}, AddedAt: now.Add(-5 * time.Hour), IsPinned: true},
+				{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}, AddedAt: now.Add(-1 * time.Hour)},
+				{ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "chart"}, AddedAt: now.Add(-2 * time.Hour)},
+				{ID: "fav-3", Asset: &Asset{ID: "asset-3", Type: "chart"}, AddedAt: now.Add(-6 * time.Hour)},
+			},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	get := func(query string) PaginatedResponse {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+		handler.GetFavorites(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", query, http.StatusOK, w.Code)
+		}
+		var result PaginatedResponse
+		json.NewDecoder(w.Body).Decode(&result)
+		return result
+	}
+
+	// A page of pins only can't be continued by cursor
+	if result := get("limit=1"); result.Pagination.NextBefore != nil {
+		t.Errorf("Expected no next_before on a page of pins, got %v", result.Pagination.NextBefore)
+	}
+
+	result := get("limit=2")
+	if result.Pagination.NextBefore == nil || !result.Pagination.NextBefore.Equal(now.Add(-1*time.Hour)) {
+		t.Fatalf("Expected next_before from fav-1, got %v", result.Pagination.NextBefore)
+	}
+
+	result = get("limit=10&before=" + result.Pagination.NextBefore.Format(time.RFC3339))
+	var ids []string
+	for _, favorite := range result.Favorites {
+		ids = append(ids, favorite.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"fav-2", "fav-3"}) {
+		t.Errorf("Expected fav-2 and fav-3 without the pin, got %v", ids)
+	}
+
+	if result := get("limit=2&sort=custom"); result.Pagination.NextBefore != nil {
+		t.Errorf("Expected no next_before with sort=custom, got %v", result.Pagination.NextBefore)
+	}
+	if result := get("limit=2&sort=asset_type,added_at&order=asc,desc"); result.Pagination.NextBefore != nil {
+		t.Errorf("Expected no next_before with a multi-field sort, got %v", result.Pagination.NextBefore)
+	}
+}
+
+// TestUpdateFavoriteNotes tests notes can be set and cleared without touching the description
+func TestUpdateFavoriteNotes(t *testing.T) {
+	label := "Q4 revenue"
+	note := "check with finance"
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}, DescriptionOverride: &label}},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	tests := []struct {
+		name     string
+		assetID  string
+		body     string
+		expected int
+		notes    *string
+	}{
+		{"set", "asset-1", `{"notes": "check with finance"}`, http.StatusOK, &note},
+		{"clear with null", "asset-1", `{"notes": null}`, http.StatusOK, nil},
+		{"clear with empty", "asset-1", `{"notes": ""}`, http.StatusOK, nil},
+		{"not favorited", "asset-2", `{"notes": "x"}`, http.StatusNotFound, nil},
+		{"invalid body", "asset-1", `{"notes": 1}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/api/v1/users/user-123/favorites/"+tt.assetID+"/notes", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"userID": "user-123", "assetID": tt.assetID})
+			w := httptest.NewRecorder()
+
+			handler.UpdateFavoriteNotes(w, req)
+
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var result Favorite
+			json.NewDecoder(w.Body).Decode(&result)
+			if !reflect.DeepEqual(result.Notes, tt.notes) {
+				t.Errorf("Expected notes %v, got %v", tt.notes, result.Notes)
+			}
+			if result.DescriptionOverride == nil || *result.DescriptionOverride != label {
+				t.Errorf("Expected description to be unchanged, got %v", result.DescriptionOverride)
+			}
+		})
+	}
+}
+
+// TestPinFavorite tests POST pins and DELETE unpins a favorite
+func TestPinFavorite(t *testing.T) {
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}}},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/users/{userID}/favorites/{assetID}/pin", handler.PinFavorite).Methods("POST")
+	router.HandleFunc("/api/v1/users/{userID}/favorites/{assetID}/pin", handler.UnpinFavorite).Methods("DELETE")
+
+	tests := []struct {
+		name     string
+		method   string
+		assetID  string
+		expected int
+		pinned   bool
+	}{
+		{"pin", "POST", "asset-1", http.StatusOK, true},
+		{"pin again", "POST", "asset-1", http.StatusOK, true},
+		{"unpin", "DELETE", "asset-1", http.StatusOK, false},
+		{"not favorited", "POST", "asset-2", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/users/user-123/favorites/"+tt.assetID+"/pin", nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var result Favorite
+			json.NewDecoder(w.Body).Decode(&result)
+			if result.IsPinned != tt.pinned || storage.favorites["user-123"][0].IsPinned != tt.pinned {
+				t.Errorf("Expected is_pinned %v, got %v", tt.pinned, result.IsPinned)
+			}
+		})
+	}
+}
+
+// TestPatchAsset tests merge patches, data validation and If-Match handling
+func TestPatchAsset(t *testing.T) {
+	storage := &mockStorage{
+		assets: map[string]*Asset{
+			"asset-1": {ID: "asset-1", Type: "chart", Data: json.RawMessage(`{"title":"Daily Users","x_axis":"Date","y_axis":"Count"}`)},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+	staleETag := AssetETag(storage.assets["asset-1"])
+
+	patch := func(body string, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/v1/assets/asset-1", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"assetID": "asset-1"})
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.PatchAsset(w, req)
+		return w
+	}
+
+	w := patch(`{"title":"Weekly Users","y_axis":null}`, staleETag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var asset Asset
+	json.NewDecoder(w.Body).Decode(&asset)
+	if string(asset.Data) != `{"title":"Weekly Users","x_axis":"Date"}` {
+		t.Errorf("Expected merged data, got %s", asset.Data)
+	}
+	if w.Header().Get("ETag") == staleETag {
+		t.Error("Expected a new ETag after the update")
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		ifMatch  string
+		expected int
+	}{
+		{"stale etag", `{"title":"Monthly Users"}`, staleETag, http.StatusConflict},
+		{"invalid data", `{"title":42}`, "", http.StatusBadRequest},
+		{"invalid json", `{"title":`, "", http.StatusBadRequest},
+		{"any etag", `{"title":"Monthly Users"}`, "*", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := patch(tt.body, tt.ifMatch); w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+// TestAssetVersions tests patches keep the replaced data as versions and a restore brings it back
+func TestAssetVersions(t *testing.T) {
+	storage := &mockStorage{
+		assets: map[string]*Asset{
+			"asset-1": {ID: "asset-1", Type: "chart", Data: json.RawMessage(`{"title":"Daily Users"}`)},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/assets/{assetID}", handler.PatchAsset).Methods("PATCH")
+	router.HandleFunc("/api/v1/assets/{assetID}/versions", handler.GetAssetVersions).Methods("GET")
+	router.HandleFunc("/api/v1/assets/{assetID}/versions/{version}", handler.GetAssetVersion).Methods("GET")
+	router.HandleFunc("/api/v1/assets/{assetID}/versions/{version}/restore", handler.RestoreAssetVersion).Methods("PUT")
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	do("PATCH", "/api/v1/assets/asset-1", `{"title":"Weekly Users"}`)
+	do("PATCH", "/api/v1/assets/asset-1", `{"title":"Weekly Users"}`) // unchanged, no new version
+
+	w := do("GET", "/api/v1/assets/asset-1/versions", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var list struct {
+		Versions []*AssetVersion `json:"versions"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Versions) != 1 || list.Versions[0].Version != 1 || string(list.Versions[0].Data) != `{"title":"Daily Users"}` {
+		t.Fatalf("Expected the original data as version 1, got %+v", list.Versions)
+	}
+
+	w = do("PUT", "/api/v1/assets/asset-1/versions/1/restore", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if string(storage.assets["asset-1"].Data) != `{"title":"Daily Users"}` {
+		t.Errorf("Expected the original data restored, got %s", storage.assets["asset-1"].Data)
+	}
+
+	w = do("GET", "/api/v1/assets/asset-1/versions/2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var version AssetVersion
+	json.NewDecoder(w.Body).Decode(&version)
+	if string(version.Data) != `{"title":"Weekly Users"}` {
+		t.Errorf("Expected the restored-over data as version 2, got %s", version.Data)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{"unknown version", "GET", "/api/v1/assets/asset-1/versions/9", http.StatusNotFound},
+		{"invalid version", "GET", "/api/v1/assets/asset-1/versions/abc", http.StatusBadRequest},
+		{"zero version", "PUT", "/api/v1/assets/asset-1/versions/0/restore", http.StatusBadRequest},
+		{"restore unknown version", "PUT", "/api/v1/assets/asset-1/versions/9/restore", http.StatusNotFound},
+		{"unknown asset", "GET", "/api/v1/assets/asset-2/versions", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.path, ""); w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+// TestGetFavoritesCSV tests Accept: text/csv returns a CSV export and errors stay JSON
+func TestGetFavoritesCSV(t *testing.T) {
+	tests := []struct {
+		name       string
+		userExists bool
+		accept     string
+		expected   int
+		csv        bool
+	}{
+		{"csv requested", true, "text/csv", http.StatusOK, true},
+		{"csv refused", true, "text/csv;q=0, application/json", http.StatusOK, false},
+		{"no accept header", true, "", http.StatusOK, false},
+		{"user not found", false, "text/csv", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &RequestHandler{service: &Service{storage: &mockStorage{userExists: tt.userExists}}}
+
+			req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites", nil)
+			req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			handler.GetFavorites(w, req)
+
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			isCSV := strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv")
+			if isCSV != tt.csv {
+				t.Fatalf("Expected CSV %v, got Content-Type %q", tt.csv, w.Header().Get("Content-Type"))
+			}
+			if tt.csv && w.Body.String() != "id,asset_id,asset_type,description,notes,added_at,asset_data\n" {
+				t.Errorf("Expected only the header row, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+// TestExportFavoritesNDJSON tests every favorite is streamed as one JSON line, across pages
+func TestExportFavoritesNDJSON(t *testing.T) {
+	favorites := make([]*Favorite, 0)
+	now := time.Now().UTC()
+	for i := 0; i < MaxPageSize+50; i++ {
+		assetType := "chart"
+		if i%2 == 1 {
+			assetType = "insight"
+		}
+		favorites = append(favorites, &Favorite{
+			ID:      "fav-" + strconv.Itoa(i),
+			Asset:   &Asset{ID: "asset-" + strconv.Itoa(i), Type: assetType},
+			AddedAt: now.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+
+	tests := []struct {
+		name       string
+		userExists bool
+		query      string
+		expected   int
+		lines      int
+	}{
+		{"all favorites", true, "", http.StatusOK, MaxPageSize + 50},
+		{"type filter", true, "?type=insight", http.StatusOK, (MaxPageSize + 50) / 2},
+		{"invalid type", true, "?type=dashboard", http.StatusBadRequest, 0},
+		{"user not found", false, "", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &mockStorage{userExists: tt.userExists, favorites: map[string][]*Favorite{"user-123": favorites}}
+			handler := &RequestHandler{service: &Service{storage: storage}}
+
+			req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/export/json-lines"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+			w := httptest.NewRecorder()
+
+			handler.ExportFavoritesNDJSON(w, req)
+
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Expected application/x-ndjson, got %q", ct)
+			}
+			lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+			if len(lines) != tt.lines {
+				t.Fatalf("Expected %d lines, got %d", tt.lines, len(lines))
+			}
+			seen := make(map[string]bool)
+			for _, line := range lines {
+				var favorite Favorite
+				if err := json.Unmarshal([]byte(line), &favorite); err != nil {
+					t.Fatalf("Expected a JSON object per line, got %q: %v", line, err)
+				}
+				if seen[favorite.ID] {
+					t.Fatalf("Favorite %s streamed twice", favorite.ID)
+				}
+				seen[favorite.ID] = true
+			}
+		})
+	}
+}
+
+// TestImportFavoritesNDJSON tests lines are imported, skipped or rejected with their line number
+func TestImportFavoritesNDJSON(t *testing.T) {
+	const (
+		first  = "11111111-1111-1111-1111-111111111111"
+		second = "22222222-2222-2222-2222-222222222222"
+		third  = "33333333-3333-3333-3333-333333333333"
+	)
+	storage := &mockStorage{userExists: true}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	body := strings.Join([]string{
+		`{"asset": {"id": "` + first + `"}, "description_override": "Q4", "added_at": "2024-01-02T03:04:05Z"}`,
+		`{"asset": {"id": "` + first + `"}}`,
+		`{"notes": "no asset"}`,
+		`{"asset": {"id": "asset-1"}}`,
+		`{"asset": {"id": "` + second + `"}, "notes": 5}`,
+		`{"asset": `,
+		``,
+		`{"asset": {"id": "` + third + `"}} {"asset": {"id": "` + third + `"}}`,
+		`{"asset": {"id": "` + third + `"}, "added_at": "yesterday"}`,
+		`{"asset": {"id": "` + second + `"}}`,
+	}, "\n")
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/import/json-lines", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.ImportFavoritesNDJSON(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var result ImportResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Imported != 2 || result.Skipped != 1 {
+		t.Errorf("Expected 2 imported and 1 skipped, got %d and %d", result.Imported, result.Skipped)
+	}
+	expected := []ImportLineError{
+		{Line: 3, Reason: "asset.id is required"},
+		{Line: 4, Reason: "asset.id is not a valid UUID"},
+		{Line: 5, Reason: "notes has the wrong type"},
+		{Line: 6, Reason: "invalid JSON"},
+		{Line: 8, Reason: "invalid JSON"},
+		{Line: 9, Reason: "added_at is not an RFC 3339 time"},
+	}
+	if !reflect.DeepEqual(result.Errors, expected) {
+		t.Errorf("Expected errors %v, got %v", expected, result.Errors)
+	}
+	if fav, _ := storage.GetFavorite(DefaultOrganizationID, "user-123", first); fav == nil || fav.DescriptionOverride == nil || *fav.DescriptionOverride != "Q4" {
+		t.Errorf("Expected the first line's description to be imported, got %+v", fav)
+	} else if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !fav.AddedAt.Equal(want) {
+		t.Errorf("Expected added_at %v to be kept, got %v", want, fav.AddedAt)
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/import/json-lines", strings.NewReader("{}"))
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		req.ContentLength = MaxImportBytes + 1
+		w := httptest.NewRecorder()
+
+		handler.ImportFavoritesNDJSON(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+		}
+	})
+
+	t.Run("too large without content length", func(t *testing.T) {
+		line := `{"asset": {"id": "` + first + `"}}` + "\n"
+		req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/import/json-lines",
+			strings.NewReader(strings.Repeat(line, MaxImportBytes/len(line)+1)))
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+
+		handler.ImportFavoritesNDJSON(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+		}
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		handler := &RequestHandler{service: &Service{storage: &mockStorage{}}}
+		req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/import/json-lines", strings.NewReader(""))
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+
+		handler.ImportFavoritesNDJSON(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+// TestImportFavoritesNDJSONBatchFails tests a failed batch reports the
+// batches committed before it and drops their cached pages
+func TestImportFavoritesNDJSONBatchFails(t *testing.T) {
+	storage := &mockStorage{userExists: true, failTransaction: 2}
+	cache := NewMemoryCache()
+	cache.Set(favoritesCacheKey("user-123")+":page", []byte("{}"), time.Minute)
+	handler := &RequestHandler{service: &Service{storage: storage, cache: cache}}
+
+	var lines []string
+	for i := 0; i < ImportBatchSize+10; i++ {
+		lines = append(lines, fmt.Sprintf(`{"asset": {"id": "00000000-0000-0000-0000-%012d"}}`, i))
+	}
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/import/json-lines", strings.NewReader(strings.Join(lines, "\n")))
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.ImportFavoritesNDJSON(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusInternalServerError, w.Code, w.Body.String())
+	}
+	var result ImportResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Imported != ImportBatchSize || result.Error != "internal server error" {
+		t.Errorf("Expected %d imported and an error, got %+v", ImportBatchSize, result)
+	}
+	if _, ok := cache.Get(favoritesCacheKey("user-123") + ":page"); ok {
+		t.Error("Expected cached favorites to be invalidated")
+	}
+}
+
+// TestGetFavoriteAssetTypes tests distinct types are returned and cached until favorites change
+func TestGetFavoriteAssetTypes(t *testing.T) {
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {
+				{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "insight"}},
+				{ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "chart"}},
+				{ID: "fav-3", Asset: &Asset{ID: "asset-3", Type: "chart"}},
+			},
+		},
+	}
+	cache := NewMemoryCache()
+	handler := &RequestHandler{service: &Service{storage: storage, cache: cache}}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/asset-types", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetFavoriteAssetTypes(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string][]string
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if !reflect.DeepEqual(result["types"], []string{"chart", "insight"}) {
+		t.Errorf("Expected [chart insight], got %v", result["types"])
+	}
+	if _, ok := cache.Get("favorites:user-123:asset-types"); !ok {
+		t.Error("Expected asset types to be cached")
+	}
+
+	handler.service.invalidateFavorites("user-123")
+	if _, ok := cache.Get("favorites:user-123:asset-types"); ok {
+		t.Error("Expected cached asset types to be dropped with the user's favorites")
+	}
+}
+
+// TestCompareFavorites tests only assets favorited by both users are returned,
+// and only to one of them
+func TestCompareFavorites(t *testing.T) {
+	shared := &Asset{ID: "asset-1", Type: "chart"}
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1", Asset: shared}, {ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "insight"}}},
+			"user-456": {{ID: "fav-3", Asset: shared}, {ID: "fav-4", Asset: &Asset{ID: "asset-3", Type: "audience"}}},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/users/{userID}/favorites/compare/{otherUserID}", handler.CompareFavorites).Methods("GET")
+
+	tests := []struct {
+		name       string
+		userExists bool
+		requester  string
+		expected   int
+	}{
+		{"no authentication", true, "", http.StatusOK},
+		{"first user", true, "user-123", http.StatusOK},
+		{"second user", true, "user-456", http.StatusOK},
+		{"someone else", true, "user-789", http.StatusForbidden},
+		{"user not found", false, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		storage.userExists = tt.userExists
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/compare/user-456", nil)
+		if tt.requester != "" {
+			req = req.WithContext(context.WithValue(req.Context(), userIDContextKey, tt.requester))
+		}
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var assets []*Asset
+		json.NewDecoder(w.Body).Decode(&assets)
+		if len(assets) != 1 || assets[0].ID != "asset-1" {
+			t.Errorf("%s: expected only the shared asset-1, got %v", tt.name, assets)
+		}
+	}
+}
+
+// TestGetFavoriteCalendar tests every day of the year is returned, zero-filled
+func TestGetFavoriteCalendar(t *testing.T) {
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {
+				{ID: "fav-1", Asset: &Asset{ID: "asset-1"}, AddedAt: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)},
+				{ID: "fav-2", Asset: &Asset{ID: "asset-2"}, AddedAt: time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC)},
+				{ID: "fav-3", Asset: &Asset{ID: "asset-3"}, AddedAt: time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	tests := []struct {
+		query    string
+		expected int
+		days     int
+	}{
+		{"?year=2024", http.StatusOK, 366},
+		{"?year=2023", http.StatusOK, 365},
+		{"", http.StatusOK, 0}, // current year, length depends on it
+		{"?year=last", http.StatusBadRequest, 0},
+		{"?year=1900", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/calendar-heatmap"+tt.query, nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+
+		handler.GetFavoriteCalendar(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%q: expected status %d, got %d", tt.query, tt.expected, w.Code)
+			continue
+		}
+		if tt.days == 0 {
+			continue
+		}
+
+		var calendar []CalendarDay
+		json.NewDecoder(w.Body).Decode(&calendar)
+		if len(calendar) != tt.days {
+			t.Fatalf("%q: expected %d days, got %d", tt.query, tt.days, len(calendar))
+		}
+		if calendar[0].Date[5:] != "01-01" || calendar[len(calendar)-1].Date[5:] != "12-31" {
+			t.Errorf("%q: expected January 1 to December 31, got %s to %s", tt.query, calendar[0].Date, calendar[len(calendar)-1].Date)
+		}
+		if tt.days == 366 && (calendar[59].Date != "2024-02-29" || calendar[59].Count != 2 || calendar[60].Count != 0) {
+			t.Errorf("Expected 2 favorites on 2024-02-29 and none after, got %+v, %+v", calendar[59], calendar[60])
+		}
+		if tt.days == 365 && calendar[364].Count != 1 {
+			t.Errorf("Expected 1 favorite on 2023-12-31, got %+v", calendar[364])
+		}
+	}
+}
+
+// TestGetFavoriteStats tests the stats summarize the user's favorites and are cached
+func TestGetFavoriteStats(t *testing.T) {
+	oldest := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {
+				{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "insight"}, AddedAt: newest},
+				{ID: "fav-2", Asset: &Asset{ID: "asset-2", Type: "chart"}, AddedAt: oldest},
+				{ID: "fav-3", Asset: &Asset{ID: "asset-3", Type: "chart"}, AddedAt: oldest.AddDate(0, 1, 0)},
+			},
+		},
+	}
+	cache := NewMemoryCache()
+	handler := &RequestHandler{service: &Service{storage: storage, cache: cache}}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/stats", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetFavoriteStats(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var stats FavoriteStats
+	json.NewDecoder(w.Body).Decode(&stats)
+
+	if stats.TotalFavorites != 3 {
+		t.Errorf("Expected 3 favorites, got %d", stats.TotalFavorites)
+	}
+	if stats.OldestFavorite == nil || !stats.OldestFavorite.Equal(oldest) {
+		t.Errorf("Expected oldest favorite %v, got %v", oldest, stats.OldestFavorite)
+	}
+	if stats.NewestFavorite == nil || !stats.NewestFavorite.Equal(newest) {
+		t.Errorf("Expected newest favorite %v, got %v", newest, stats.NewestFavorite)
+	}
+	if stats.MostUsedType == nil || *stats.MostUsedType != "chart" {
+		t.Errorf("Expected most used type chart, got %v", stats.MostUsedType)
+	}
+	if _, ok := cache.Get("favorites:user-123:stats"); !ok {
+		t.Error("Expected stats to be cached")
+	}
+
+	handler.service.invalidateFavorites("user-123")
+	if _, ok := cache.Get("favorites:user-123:stats"); ok {
+		t.Error("Expected cached stats to be dropped with the user's favorites")
+	}
+}
+
+// TestGetFavoriteBadges tests every badge is listed with the user's count
+// and earned once the count reaches its threshold
+func TestGetFavoriteBadges(t *testing.T) {
+	var favorites []*Favorite
+	for i := 0; i < 5; i++ {
+		favorites = append(favorites, &Favorite{ID: "fav-chart-" + strconv.Itoa(i), Asset: &Asset{Type: "chart"}})
+	}
+	favorites = append(favorites, &Favorite{ID: "fav-insight", Asset: &Asset{Type: "insight"}})
+	storage := &mockStorage{
+		userExists: true,
+		favorites:  map[string][]*Favorite{"user-123": favorites},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/badges", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetFavoriteBadges(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var badges []FavoriteBadge
+	json.NewDecoder(w.Body).Decode(&badges)
+
+	want := []FavoriteBadge{
+		{Type: "audience", Count: 0, Threshold: 3, Badge: "audience_explorer", Earned: false},
+		{Type: "chart", Count: 5, Threshold: 5, Badge: "chart_enthusiast", Earned: true},
+		{Type: "insight", Count: 1, Threshold: 5, Badge: "insight_seeker", Earned: false},
+	}
+	if !reflect.DeepEqual(badges, want) {
+		t.Errorf("Expected %+v, got %+v", want, badges)
+	}
+}
+
+// TestGetFavoriteStats_NoFavorites tests a user without favorites gets zero and nulls
+func TestGetFavoriteStats_NoFavorites(t *testing.T) {
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{userExists: true}}}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/stats", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetFavoriteStats(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["total_favorites"] != float64(0) || result["most_used_type"] != nil || result["oldest_favorite"] != nil {
+		t.Errorf("Expected zero favorites and null fields, got %v", result)
+	}
+}
+
+// TestGetRandomFavorite tests a favorite is returned and 404 when the user has none
+func TestGetRandomFavorite(t *testing.T) {
+	storage := &mockStorage{
+		userExists: true,
+		favorites: map[string][]*Favorite{
+			"user-123": {{ID: "fav-1", Asset: &Asset{ID: "asset-1", Type: "chart"}}},
+		},
+	}
+	handler := &RequestHandler{service: &Service{storage: storage}}
+
+	tests := []struct {
+		userID   string
+		expected int
+	}{
+		{"user-123", http.StatusOK},
+		{"user-456", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/users/"+tt.userID+"/favorites/random", nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": tt.userID})
+		w := httptest.NewRecorder()
+
+		handler.GetRandomFavorite(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.userID, tt.expected, w.Code)
+		}
+	}
+}
+
+// TestGetFavoritesTimeline tests favorites are grouped per day and old ones are left out
+func TestGetFavoritesTimeline(t *testing.T) {
+	now := time.Now()
+	chart := &Asset{ID: "asset-1", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {
+					{ID: "fav-1", Asset: chart, AddedAt: now},
+					{ID: "fav-2", Asset: chart, AddedAt: now},
+					{ID: "fav-3", Asset: chart, AddedAt: now.AddDate(0, 0, -1)},
+					{ID: "fav-4", Asset: chart, AddedAt: now.AddDate(0, 0, -60)},
+				},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/timeline", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.GetFavoritesTimeline(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result []TimelineDay
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 days within the default 30, got %d", len(result))
+	}
+	if result[0].Date != now.Format("2006-01-02") || result[0].Count != 2 || len(result[0].Favorites) != 2 {
+		t.Errorf("Expected 2 favorites today, got %s with %d", result[0].Date, result[0].Count)
+	}
+	if result[1].Count != 1 {
+		t.Errorf("Expected 1 favorite yesterday, got %d", result[1].Count)
+	}
+
+	// A busy day lists per_day favorites but still counts them all
+	req = httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/timeline?per_day=1", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w = httptest.NewRecorder()
+
+	handler.GetFavoritesTimeline(w, req)
+
+	result = nil
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result) != 2 || result[0].Count != 2 || len(result[0].Favorites) != 1 || result[0].Favorites[0].ID != "fav-1" {
+		t.Errorf("Expected today's newest favorite of 2, got %+v", result)
+	}
+}
+
+// TestReorderFavorites tests order_index is stored and invalid orders are rejected
+func TestReorderFavorites(t *testing.T) {
+	first := "11111111-1111-1111-1111-111111111111"
+	second := "22222222-2222-2222-2222-222222222222"
+	favs := []*Favorite{
+		{ID: "fav-1", Asset: &Asset{ID: first, Type: "chart"}},
+		{ID: "fav-2", Asset: &Asset{ID: second, Type: "chart"}},
+	}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites:  map[string][]*Favorite{"user-123": favs},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"reorder", `[{"asset_id": "` + first + `", "order_index": 2}, {"asset_id": "` + second + `", "order_index": 1}]`, http.StatusNoContent},
+		{"duplicate", `[{"asset_id": "` + first + `", "order_index": 1}, {"asset_id": "` + first + `", "order_index": 2}]`, http.StatusBadRequest},
+		{"not favorited", `[{"asset_id": "33333333-3333-3333-3333-333333333333", "order_index": 1}]`, http.StatusNotFound},
+		{"not an array", `{"asset_id": "` + first + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("PUT", "/api/v1/users/user-123/favorites/reorder", bytes.NewBufferString(tt.body))
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+		w := httptest.NewRecorder()
+
+		handler.ReorderFavorites(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+
+	if favs[0].OrderIndex != 2 || favs[1].OrderIndex != 1 {
+		t.Errorf("Expected order indexes 2 and 1, got %d and %d", favs[0].OrderIndex, favs[1].OrderIndex)
+	}
+}
+
+// TestRecommendedFavorites tests recommendations come from overlapping users and skip the user's own favorites
+func TestRecommendedFavorites(t *testing.T) {
+	shared := &Asset{ID: "asset-1", Type: "chart"}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1", Asset: shared}},
+				"user-456": {
+					{ID: "fav-2", Asset: shared},
+					{ID: "fav-3", Asset: &Asset{ID: "asset-2", Type: "insight"}},
+				},
+				"user-789": {{ID: "fav-4", Asset: &Asset{ID: "asset-3", Type: "audience"}}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites/recommended", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.RecommendedFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result []Asset
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result) != 1 || result[0].ID != "asset-2" {
+		t.Errorf("Expected only asset-2 to be recommended, got %v", result)
+	}
+}
+
+// TestGetTrending tests assets are ranked by recent favorites and the result is cached
+func TestGetTrending(t *testing.T) {
+	now := time.Now()
+	chart := &Asset{ID: "asset-1", Type: "chart"}
+	insight := &Asset{ID: "asset-2", Type: "insight"}
+	storage := &mockStorage{
+		favorites: map[string][]*Favorite{
+			"user-1": {{ID: "fav-1", Asset: chart, AddedAt: now}, {ID: "fav-2", Asset: insight, AddedAt: now}},
+			"user-2": {{ID: "fav-3", Asset: insight, AddedAt: now}},
+			"user-3": {{ID: "fav-4", Asset: chart, AddedAt: now.Add(-48 * time.Hour)}},
+		},
+	}
+	mockService := &Service{
+		storage: storage,
+		cache:   NewMemoryCache(),
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/trending", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetTrending(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result []*TrendingAsset
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if len(result) != 2 || result[0].Asset.ID != "asset-2" || result[0].Score != 2 || result[1].Score != 1 {
+		t.Fatalf("Expected asset-2 (2) then asset-1 (1), got %+v", result)
+	}
+
+	// A new favorite doesn't show up until the cached list expires
+	storage.favorites["user-4"] = []*Favorite{{ID: "fav-5", Asset: chart, AddedAt: now}}
+	cached, err := mockService.GetTrending(DefaultOrganizationID, DefaultTrendingHours, DefaultTrendingLimit)
+	if err != nil {
+		t.Fatalf("GetTrending failed: %v", err)
+	}
+	if cached[1].Score != 1 {
+		t.Errorf("Expected the cached score 1 for asset-1, got %d", cached[1].Score)
+	}
+}
+
+// TestGetTrendingInvalidHours tests 400 response for a window outside 1..MaxTrendingHours
+func TestGetTrendingInvalidHours(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("GET", "/api/v1/trending?hours=1000", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetTrending(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestPaginationRetrievedAt tests pages carry when they were read, kept when served from cache
+func TestPaginationRetrievedAt(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{userExists: true},
+		cache:   NewMemoryCache(),
+	}
+
+	before := time.Now().UTC()
+	first, err := mockService.GetFavorites(DefaultOrganizationID, "user-123", 1, 20, nil, "", "", nil)
+	if err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+	if first.Pagination.RetrievedAt.Before(before) || first.Pagination.RetrievedAt.Location() != time.UTC {
+		t.Errorf("Expected retrieved_at to be now in UTC, got %v", first.Pagination.RetrievedAt)
+	}
+
+	cached, err := mockService.GetFavorites(DefaultOrganizationID, "user-123", 1, 20, nil, "", "", nil)
+	if err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+	if !cached.Pagination.RetrievedAt.Equal(first.Pagination.RetrievedAt) {
+		t.Errorf("Expected the cached page to keep retrieved_at %v, got %v", first.Pagination.RetrievedAt, cached.Pagination.RetrievedAt)
+	}
+
+	result, err := mockService.ListAssets(DefaultOrganizationID, 1, 20, nil, nil, nil, "")
+	if err != nil {
+		t.Fatalf("ListAssets failed: %v", err)
+	}
+	if result["pagination"].(PaginationInfo).RetrievedAt.IsZero() {
+		t.Error("Expected assets pagination to set retrieved_at")
+	}
+}
+
+// TestGetFavoritesCacheInvalidatedOnAdd tests favorites pages are cached and dropped when the user adds a favorite
+func TestGetFavoritesCacheInvalidatedOnAdd(t *testing.T) {
+	cache := NewMemoryCache()
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+		cache: cache,
+	}
+
+	if _, err := mockService.GetFavorites(DefaultOrganizationID, "user-123", 1, 20, nil, "", "", nil); err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+	if _, ok := cache.Get("favorites:user-123:1:20::newest"); !ok {
+		t.Fatal("Expected favorites page to be cached")
+	}
+
+	// Another user's cache must survive
+	cache.Set("favorites:user-999:1:20:", []byte("{}"), time.Minute)
+
+	if _, _, err := mockService.AddFavorite(DefaultOrganizationID, "user-123", "asset-456", nil, nil); err != nil {
+		t.Fatalf("AddFavorite failed: %v", err)
+	}
+	if _, ok := cache.Get("favorites:user-123:1:20::newest"); ok {
+		t.Error("Expected cached page to be invalidated after AddFavorite")
+	}
+	if _, ok := cache.Get("favorites:user-999:1:20:"); !ok {
+		t.Error("Expected other users' cached pages to be kept")
+	}
+}
+
+// TestMemoryCacheExpiry tests expired entries are not returned
+func TestMemoryCacheExpiry(t *testing.T) {
+	cache := NewMemoryCache()
+	cache.Set("key", []byte("value"), -time.Second)
+
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Expected expired entry to be missing")
+	}
+}
+
+// TestRemoveAllFavoritesSuccess tests clearing a user's favorites returns the removed count
+func TestRemoveAllFavoritesSuccess(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites: map[string][]*Favorite{
+				"user-123": {{ID: "fav-1"}, {ID: "fav-2"}},
+			},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/users/user-123/favorites", nil)
+	req = mux.SetURLVars(req, map[string]string{"userID": "user-123"})
+	w := httptest.NewRecorder()
+
+	handler.RemoveAllFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result map[string]int
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result["removed"] != 2 {
+		t.Errorf("Expected removed 2, got %d", result["removed"])
+	}
+}
+
+// ============================================================================
+// WEBHOOK TESTS
+// ============================================================================
+
+// TestCreateWebhookInvalidURL tests that non-HTTP webhook URLs are rejected
+func TestCreateWebhookInvalidURL(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	body := map[string]interface{}{
+		"url":    "ftp://hooks.example.com/favorites",
+		"secret": "s3cret",
+	}
+	bodyBytes, _ := json.Marshal(body)
+
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/webhooks", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.CreateWebhook(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestSignPayload verifies the X-Signature value receivers will recompute
+func TestSignPayload(t *testing.T) {
+	// HMAC-SHA256("key", "The quick brown fox jumps over the lazy dog")
+	expected := "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+
+	got := signPayload("key", []byte("The quick brown fox jumps over the lazy dog"))
+	if got != expected {
+		t.Errorf("Expected signature %s, got %s", expected, got)
+	}
+}
+
+// ============================================================================
+// HEALTH CHECK TEST
+// ============================================================================
+
+// TestHealthCheck verifies the service health endpoint
+// Used by Docker HEALTHCHECK and as the liveness probe, so it must answer
+// even though no database is reachable in unit tests
+func TestHealthCheck(t *testing.T) {
+	// sql.Open does not connect; any query would fail against a closed port
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+	defer db.Close()
+	handler := &RequestHandler{storage: &Storage{db: db}}
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	handler.HealthCheck(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result HealthResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result.Status != "ok" {
+		t.Errorf("Expected status 'ok', got '%s'", result.Status)
+	}
+	if result.DB.Stats.WaitDuration == "" {
+		t.Error("Expected db.stats in response")
+	}
+	if result.DB.Stats.OpenConnections != 0 {
+		t.Errorf("Expected no connection to be opened, got %d", result.DB.Stats.OpenConnections)
+	}
+}
+
+// TestDBHealthCheckUnreachable verifies GET /health/db answers 503 without
+// exposing the driver's error text
+func TestDBHealthCheckUnreachable(t *testing.T) {
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+	defer db.Close()
+	handler := &RequestHandler{storage: &Storage{db: db}}
+
+	req := httptest.NewRequest("GET", "/health/db", nil)
+	w := httptest.NewRecorder()
+
+	handler.DBHealthCheck(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var result DBHealthResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result.Status != "error" {
+		t.Errorf("Expected status 'error', got '%s'", result.Status)
+	}
+	if result.Error != "internal server error" {
+		t.Errorf("Expected generic error, got '%s'", result.Error)
+	}
+}
+
+// TestLivez verifies the liveness probe follows the heartbeat, is served
+// without a bearer token, and never needs the database
+func TestLivez(t *testing.T) {
+	heartbeat := NewHeartbeat()
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{}}, heartbeat: heartbeat}
+	router := NewRouter(&Config{JWTSecret: []byte("secret")}, handler.service, handler)
+
+	livez := func() (int, LivenessResponse) {
+		req := httptest.NewRequest("GET", "/api/v1/livez", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var result LivenessResponse
+		json.NewDecoder(w.Body).Decode(&result)
+		return w.Code, result
+	}
+
+	heartbeat.beat()
+	if code, result := livez(); code != http.StatusOK || result.Status != "alive" || result.Heartbeats != 1 {
+		t.Errorf("Expected 200 alive with 1 heartbeat, got %d %+v", code, result)
+	}
+
+	// A heartbeat that stopped advancing means the process is wedged
+	heartbeat.lastBeat = time.Now().Add(-LivenessMaxHeartbeatAge - time.Second)
+	if code, result := livez(); code != http.StatusServiceUnavailable || result.Status != "stalled" {
+		t.Errorf("Expected 503 stalled, got %d %+v", code, result)
+	}
+
+	heartbeat.beat()
+	if code, _ := livez(); code != http.StatusOK {
+		t.Errorf("Expected 200 once the heartbeat advances again, got %d", code)
+	}
+}
+
+// TestHeartbeatRun verifies the heartbeat ticks until its context is done
+func TestHeartbeatRun(t *testing.T) {
+	heartbeat := NewHeartbeat()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		heartbeat.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	beats, alive := heartbeat.Alive(LivenessMaxHeartbeatAge)
+	if beats == 0 || !alive {
+		t.Errorf("Expected the heartbeat to have ticked, got %d beats, alive %v", beats, alive)
+	}
+}
+
+// TestReadyz verifies the readiness probe reports 503 while the database is
+// unreachable, and is served without a bearer token
+func TestReadyz(t *testing.T) {
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+	defer db.Close()
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{}}, storage: &Storage{db: db}}
+	router := NewRouter(&Config{JWTSecret: []byte("secret")}, handler.service, handler)
+
+	req := httptest.NewRequest("GET", "/api/v1/readyz", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var result ReadinessResponse
+	json.NewDecoder(w.Body).Decode(&result)
+
+	if result.Status != "unavailable" {
+		t.Errorf("Expected status 'unavailable', got '%s'", result.Status)
+	}
+}
+
+// TestReadyz_Timeout verifies a database that accepts connections but
+// never answers is reported within ReadinessTimeout
+func TestReadyz_Timeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	db, err := sql.Open("postgres", "host=127.0.0.1 port="+port+" sslmode=disable")
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+	defer db.Close()
+	handler := &RequestHandler{storage: &Storage{db: db}}
+
+	req := httptest.NewRequest("GET", "/api/v1/readyz", nil)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.Readyz(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > ReadinessTimeout+time.Second {
+		t.Errorf("Expected the check to give up after %s, took %s", ReadinessTimeout, elapsed)
+	}
+}
+
+// ============================================================================
+// PUB/SUB TESTS
+// ============================================================================
+
+// TestBrokerDeliversOnlyToUserSubscribers verifies events are routed by user
+func TestBrokerDeliversOnlyToUserSubscribers(t *testing.T) {
+	broker := NewBroker()
+	id, events := broker.Subscribe("user-123")
+	defer broker.Unsubscribe(id)
+	otherID, otherEvents := broker.Subscribe("user-999")
+	defer broker.Unsubscribe(otherID)
+
+	broker.Publish(Event{Type: EventFavoriteAdded, UserID: "user-123", AssetID: "asset-456"})
+
+	select {
+	case event := <-events:
+		if event.AssetID != "asset-456" {
+			t.Errorf("Expected asset-456, got %s", event.AssetID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected event for subscribed user")
+	}
+
+	select {
+	case event := <-otherEvents:
+		t.Errorf("Expected no event for other user, got %s", event.Type)
+	default:
+	}
+}
+
+// ============================================================================
+// MIDDLEWARE TESTS
+// ============================================================================
+
+// TestCORSMiddlewarePreflight verifies preflights are answered for allowed origins only
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Preflight request should not reach the router")
+	})
+	handler := CORSMiddleware([]string{"https://dashboard.gwi.com"})(next)
+
+	// Allowed origin gets its own origin echoed back
+	req := httptest.NewRequest("OPTIONS", "/api/v1/users", nil)
+	req.Header.Set("Origin", "https://dashboard.gwi.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dashboard.gwi.com" {
+		t.Errorf("Expected matched origin in Access-Control-Allow-Origin, got '%s'", got)
+	}
+
+	// Unknown origin gets no CORS headers
+	req = httptest.NewRequest("OPTIONS", "/api/v1/users", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w = httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin for unknown origin, got '%s'", got)
+	}
+}
+
+// TestRouterOptions verifies OPTIONS is answered by the router itself, so
+// preflights don't get a 405 even without CORSMiddleware in front
+func TestRouterOptions(t *testing.T) {
+	mockService := &Service{storage: &mockStorage{userExists: true}}
+	router := NewRouter(&Config{}, mockService, &RequestHandler{service: mockService})
+
+	tests := []struct {
+		method   string
+		path     string
+		expected int
+		allow    string
+	}{
+		{"OPTIONS", "/api/v1/users", http.StatusNoContent, "GET, POST, OPTIONS"},
+		{"OPTIONS", "/api/v1/users/user-123/favorites/asset-1/pin", http.StatusNoContent, "POST, DELETE, OPTIONS"},
+		{"PATCH", "/api/v1/users", http.StatusMethodNotAllowed, "GET, POST"},
+		{"OPTIONS", "/api/v1/nowhere", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.expected, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, got)
+		}
+	}
+}
+
+// TestContentTypeMiddleware verifies non-JSON bodies get 415 on writes only
+func TestContentTypeMiddleware(t *testing.T) {
+	handler := ContentTypeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		expected    int
+	}{
+		{"json", "POST", "application/json", `{}`, http.StatusOK},
+		{"json with charset", "PUT", "application/json; charset=utf-8", `{}`, http.StatusOK},
+		{"form", "POST", "application/x-www-form-urlencoded", "a=b", http.StatusUnsupportedMediaType},
+		{"missing", "PATCH", "", `{}`, http.StatusUnsupportedMediaType},
+		{"merge patch", "PATCH", "application/merge-patch+json", `{}`, http.StatusOK},
+		{"merge patch on post", "POST", "application/merge-patch+json", `{}`, http.StatusUnsupportedMediaType},
+		{"no body", "POST", "", "", http.StatusOK},
+		{"get", "GET", "text/plain", "", http.StatusOK},
+		{"ndjson", "POST", "application/x-ndjson", `{}`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/assets", bytes.NewBufferString(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+
+	// NDJSON is accepted only by the json-lines import
+	req := httptest.NewRequest("POST", "/api/v1/users/user-123/favorites/import/json-lines", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("ndjson import: expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// TestDebugBodyLogMiddleware verifies the body of failed writes is logged, including
+// any part the handler didn't read, and nothing is logged for successes or when disabled
+func TestDebugBodyLogMiddleware(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	// Reads only the first 5 bytes before failing, like a handler rejecting a bad prefix
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := make([]byte, 5)
+		io.ReadFull(r.Body, prefix)
+		if body := RequestBody(r.Context()); body != nil && string(body) != string(prefix) {
+			t.Errorf("Expected the body read so far on the context, got %q", RequestBody(r.Context()))
+		}
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		enabled   bool
+		method    string
+		query     string
+		expectLog bool
+	}{
+		{"failed post", true, "POST", "?fail=1", true},
+		{"failed patch", true, "PATCH", "?fail=1", true},
+		{"successful post", true, "POST", "", false},
+		{"failed get", true, "GET", "?fail=1", false},
+		{"disabled", false, "POST", "?fail=1", false},
+	}
+
+	for _, tt := range tests {
+		logged.Reset()
+		handler := DebugBodyLogMiddleware(tt.enabled)(inner)
+		req := httptest.NewRequest(tt.method, "/api/v1/assets"+tt.query, strings.NewReader(`{"type":"video"}`))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		hasLog := strings.Contains(logged.String(), `request_body: {"type":"video"}`)
+		if hasLog != tt.expectLog {
+			t.Errorf("%s: expected body logged %v, got log %q", tt.name, tt.expectLog, logged.String())
+		}
+	}
+
+	// Large bodies are truncated
+	logged.Reset()
+	handler := DebugBodyLogMiddleware(true)(inner)
+	req := httptest.NewRequest("POST", "/api/v1/assets?fail=1", strings.NewReader(strings.Repeat("x", 2*MaxDebugBodyLogBytes)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := strings.Count(logged.String(), "x"); n != MaxDebugBodyLogBytes {
+		t.Errorf("Expected %d bytes of body logged, got %d", MaxDebugBodyLogBytes, n)
+	}
+}
+
+// TestRedactBody verifies credentials and emails are redacted from logged
+// bodies, including malformed and cut-off ones
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"url":"https://example.com/hook","secret":"s3cr3t"}`, `{"url":"https://example.com/hook","secret":"[REDACTED]"}`},
+		{`{"Password": "a\"b", "name": "Ann"}`, `{"Password": "[REDACTED]", "name": "Ann"}`},
+		{`{"api_key":"k","email":"ann@example.com","token":"t"}`, `{"api_key":"[REDACTED]","email":"[REDACTED]","token":"[REDACTED]"}`},
+		{`{"secret":"s3cr3t",`, `{"secret":"[REDACTED]",`},
+		{`{"secret":"s3cr3`, `{"secret":"[REDACTED]"`},
+		{`{"type":"video"}`, `{"type":"video"}`},
+	}
+
+	for _, tt := range tests {
+		if got := string(redactBody([]byte(tt.body))); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.body, tt.expected, got)
+		}
+	}
+}
+
+// TestGzipMiddleware verifies bodies are compressed only for clients accepting gzip
+func TestGzipMiddleware(t *testing.T) {
+	body := `{"data":"` + string(bytes.Repeat([]byte("a"), 1000)) + `"}`
+	handler := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+		w.(http.Flusher).Flush()
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/assets", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got '%s'", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary Accept-Encoding, got '%s'", got)
+	}
+	if !w.Flushed {
+		t.Error("Expected Flush to reach the underlying writer")
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip body: %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != body {
+		t.Errorf("Expected decompressed body to match, got %d bytes", len(decoded))
+	}
+
+	// Clients that don't accept gzip get the plain body
+	req = httptest.NewRequest("GET", "/api/v1/assets", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	w = httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no Content-Encoding, got '%s'", got)
+	}
+	if w.Body.String() != body {
+		t.Error("Expected uncompressed body")
+	}
+}
+
+// TestRequestMetricsMiddleware tests routed requests are recorded under their route template
+func TestRequestMetricsMiddleware(t *testing.T) {
+	storage := &mockStorage{userExists: true}
+	mockService := &Service{storage: storage}
+	handler := &RequestHandler{service: mockService}
+	router := NewRouter(&Config{}, mockService, handler)
+
+	for _, path := range []string{"/api/v1/assets/asset-456", "/api/v1/assets/asset-456/insight-text"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if len(storage.requestMetrics) != 2 {
+		t.Fatalf("Expected 2 metrics, got %d", len(storage.requestMetrics))
+	}
+	expected := []struct {
+		endpoint string
+		status   int
+	}{
+		{"/api/v1/assets/{assetID}", http.StatusOK},
+		{"/api/v1/assets/{assetID}/insight-text", http.StatusBadRequest},
+	}
+	for i, want := range expected {
+		metric := storage.requestMetrics[i]
+		if metric.Endpoint != want.endpoint || metric.Method != "GET" || metric.StatusCode != want.status {
+			t.Errorf("Expected GET %s %d, got %s %s %d", want.endpoint, want.status, metric.Method, metric.Endpoint, metric.StatusCode)
+		}
+		if metric.DurationMS < 0 || metric.RecordedAt.IsZero() {
+			t.Errorf("Expected a duration and timestamp, got %+v", metric)
+		}
+	}
+}
+
+// TestStreamOutlastsWriteTimeout tests the favorites stream keeps delivering
+// events after the server's WriteTimeout through the router's middleware
+func TestStreamOutlastsWriteTimeout(t *testing.T) {
+	mockService := &Service{storage: &mockStorage{userExists: true}, broker: NewBroker()}
+	router := NewRouter(&Config{}, mockService, &RequestHandler{service: mockService})
+
+	if err := readEventPastWriteTimeout(mockService, router, "identity"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGzipStreamOutlastsWriteTimeout tests a compressed favorites stream keeps
+// delivering events after the server's WriteTimeout
+func TestGzipStreamOutlastsWriteTimeout(t *testing.T) {
+	mockService := &Service{storage: &mockStorage{userExists: true}, broker: NewBroker()}
+	router := GzipMiddleware(NewRouter(&Config{}, mockService, &RequestHandler{service: mockService}))
+
+	// Without an Accept-Encoding header the client asks for gzip and decompresses
+	if err := readEventPastWriteTimeout(mockService, router, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readEventPastWriteTimeout opens the favorites stream on a server with a short
+// WriteTimeout, waits past it and then expects a published event to arrive.
+func readEventPastWriteTimeout(service *Service, handler http.Handler, acceptEncoding string) error {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/users/user-123/favorites/stream", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("opening stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	time.Sleep(3 * server.Config.WriteTimeout)
+	service.broker.Publish(Event{Type: EventFavoriteAdded, UserID: "user-123", Timestamp: time.Now()})
+
+	received := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				received <- fmt.Errorf("stream ended before the event: %w", err)
+				return
+			}
+			if line == "event: "+EventFavoriteAdded+"\n" {
+				received <- nil
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-received:
+		return err
+	case <-time.After(2 * time.Second):
+		return errors.New("timed out waiting for the event")
+	}
+}
+
+// TestGetUserActivity tests the activity timeline is paginated and 404s for unknown users
+func TestGetUserActivity(t *testing.T) {
+	tests := []struct {
+		name       string
+		userExists bool
+		expected   int
+	}{
+		{"known user", true, http.StatusOK},
+		{"unknown user", false, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		handler := &RequestHandler{service: &Service{storage: &mockStorage{userExists: tt.userExists}}}
+
+		req := httptest.NewRequest("GET", "/api/v1/users/user-1/activity", nil)
+		req = mux.SetURLVars(req, map[string]string{"userID": "user-1"})
+		w := httptest.NewRecorder()
+
+		handler.GetUserActivity(w, req)
+
+		if w.Code != tt.expected {
+			t.Fatalf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var result struct {
+			Activity   []AuditEvent   `json:"activity"`
+			Pagination PaginationInfo `json:"pagination"`
+		}
+		json.NewDecoder(w.Body).Decode(&result)
+		if len(result.Activity) != 1 || result.Activity[0].Action != "add_favorite" || result.Pagination.Total != 1 {
+			t.Errorf("%s: expected one add_favorite event, got %+v", tt.name, result)
+		}
+	}
+}
+
+// TestAuditAction tests audit operations are named as user actions
+func TestAuditAction(t *testing.T) {
+	tests := []struct {
+		operation  string
+		entityType string
+		expected   string
+	}{
+		{"create", "favorite", "add_favorite"},
+		{"delete", "favorite", "remove_favorite"},
+		{"update", "favorite", "update_favorite"},
+		{"create", "asset", "create_asset"},
+		{"delete", "webhook", "delete_webhook"},
+	}
+
+	for _, tt := range tests {
+		if action := auditAction(tt.operation, tt.entityType); action != tt.expected {
+			t.Errorf("%s %s: expected %q, got %q", tt.operation, tt.entityType, tt.expected, action)
+		}
+	}
+}
+
+// TestGetEndpointSLOs tests the hours window is validated
+func TestGetEndpointSLOs(t *testing.T) {
+	handler := &RequestHandler{service: &Service{storage: &mockStorage{}}}
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"", http.StatusOK},
+		{"hours=168", http.StatusOK},
+		{"hours=0", http.StatusBadRequest},
+		{"hours=169", http.StatusBadRequest},
+		{"hours=day", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/admin/metrics/slo?"+tt.query, nil)
+		w := httptest.NewRecorder()
+
+		handler.GetEndpointSLOs(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%q: expected status %d, got %d", tt.query, tt.expected, w.Code)
+		}
+	}
+}
+
+// TestRouterGetByID routes get-by-ID requests through the real mux so path
+// variable names must match what the handlers read
+func TestRouterGetByID(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+	router := NewRouter(&Config{}, mockService, handler)
+
+	tests := []struct {
+		path       string
+		expectedID string
+	}{
+		{"/api/v1/assets/asset-456", "asset-456"},
+		{"/api/v1/users/user-123", "user-123"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", tt.path, http.StatusOK, w.Code)
+			continue
+		}
+
+		var result map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&result)
+
+		if result["id"] != tt.expectedID {
+			t.Errorf("%s: expected id '%s', got %v", tt.path, tt.expectedID, result["id"])
+		}
+	}
+}
+
+// signTestToken builds an HS256 JWT for tests
+func signTestToken(secret []byte, subject string, expiresAt time.Time) string {
+	return signTestClaims(secret, Claims{Subject: subject, ExpiresAt: expiresAt.Unix()})
+}
+
+// signTestClaims builds an HS256 JWT carrying the given claims
+func signTestClaims(secret []byte, c Claims) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestJWTMiddleware verifies 401/403/200 for missing, foreign and own tokens
+func TestJWTMiddleware(t *testing.T) {
+	secret := []byte("test-secret")
+
+	router := mux.NewRouter()
+	userAPI := router.PathPrefix("/api/v1/users/{userID}").Subrouter()
+	userAPI.Use(JWTMiddleware(secret))
+	userAPI.HandleFunc("/favorites", func(w http.ResponseWriter, r *http.Request) {
+		if userID, _ := AuthenticatedUserID(r.Context()); userID != "user-123" {
+			t.Errorf("Expected authenticated user-123 in context, got '%s'", userID)
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	tests := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"bad signature", "Bearer " + signTestToken([]byte("other-secret"), "user-123", time.Now().Add(time.Hour)), http.StatusUnauthorized},
+		{"expired", "Bearer " + signTestToken(secret, "user-123", time.Now().Add(-time.Minute)), http.StatusUnauthorized},
+		{"other user", "Bearer " + signTestToken(secret, "user-999", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"own token", "Bearer " + signTestToken(secret, "user-123", time.Now().Add(time.Hour)), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/users/user-123/favorites", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
+
+// TestOrganizationMiddleware verifies the token's org_id reaches the handler
+// and requests without a token fall back to the default organization
+func TestOrganizationMiddleware(t *testing.T) {
+	secret := []byte("test-secret")
+	var gotOrgID string
+	handler := OrganizationMiddleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOrgID = OrganizationID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		expected      int
+		expectedOrgID string
+	}{
+		{"no token", "", http.StatusOK, DefaultOrganizationID},
+		{"org token", "Bearer " + signTestClaims(secret, Claims{Subject: "user-123", OrgID: "acme", ExpiresAt: time.Now().Add(time.Hour).Unix()}), http.StatusOK, "acme"},
+		{"token without org", "Bearer " + signTestToken(secret, "user-123", time.Now().Add(time.Hour)), http.StatusOK, DefaultOrganizationID},
+		{"bad signature", "Bearer " + signTestToken([]byte("other-secret"), "user-123", time.Now().Add(time.Hour)), http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		gotOrgID = ""
+		req := httptest.NewRequest("GET", "/api/v1/assets", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+		if gotOrgID != tt.expectedOrgID {
+			t.Errorf("%s: expected organization '%s', got '%s'", tt.name, tt.expectedOrgID, gotOrgID)
+		}
+	}
+}
+
+// TestAPIKeyMiddleware verifies API keys authenticate, are scoped to their user and rate limited
+func TestAPIKeyMiddleware(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	_, plaintext, err := mockService.CreateAPIKey(DefaultOrganizationID, "user-123", 2, nil)
+	if err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+
+	// Requests without a key fall through to JWT, which rejects them
+	router := mux.NewRouter()
+	userAPI := router.PathPrefix("/api/v1/users/{userID}").Subrouter()
+	userAPI.Use(APIKeyMiddleware(mockService, JWTMiddleware([]byte("test-secret"))))
+	userAPI.HandleFunc("/favorites", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	send := func(path string, key string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("/api/v1/users/user-123/favorites", ""); code != http.StatusUnauthorized {
+		t.Errorf("No key: expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := send("/api/v1/users/user-123/favorites", "gwi_unknown"); code != http.StatusUnauthorized {
+		t.Errorf("Unknown key: expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := send("/api/v1/users/user-999/favorites", plaintext); code != http.StatusForbidden {
+		t.Errorf("Other user: expected status %d, got %d", http.StatusForbidden, code)
+	}
+
+	// Rate limit is 2 rps; the forbidden request above did not consume a token
+	for i := 0; i < 2; i++ {
+		if code := send("/api/v1/users/user-123/favorites", plaintext); code != http.StatusOK {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, http.StatusOK, code)
+		}
+	}
+	if code := send("/api/v1/users/user-123/favorites", plaintext); code != http.StatusTooManyRequests {
+		t.Errorf("Over limit: expected status %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+// TestGetSharedFavorites verifies share links work without auth and stop working once expired
+func TestGetSharedFavorites(t *testing.T) {
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	valid, err := mockService.CreateShareLink(DefaultOrganizationID, "user-123", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create share link: %v", err)
+	}
+	expired, err := mockService.CreateShareLink(DefaultOrganizationID, "user-123", -time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create share link: %v", err)
+	}
+
+	tests := []struct {
+		token    string
+		expected int
+	}{
+		{valid.Token, http.StatusOK},
+		{expired.Token, http.StatusGone},
+		{"unknown-token", http.StatusNotFound},
+		{"550e8400-e29b-41d4-a716-446655440999", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/shared/"+tt.token+"/favorites", nil)
+		req = mux.SetURLVars(req, map[string]string{"token": tt.token})
+		w := httptest.NewRecorder()
+
+		handler.GetSharedFavorites(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("Token %s: expected status %d, got %d", tt.token, tt.expected, w.Code)
+		}
+	}
+}
+
+// TestGetSharedFavoritesHidesNotes verifies a shared page leaves out private
+// notes and the owner's ID without changing the stored favorites
+func TestGetSharedFavoritesHidesNotes(t *testing.T) {
+	notes := "call the client about this"
+	favorite := &Favorite{ID: "fav-1", UserID: "user-123", Asset: &Asset{ID: "asset-1", Type: "chart"}, Notes: &notes}
+	mockService := &Service{
+		storage: &mockStorage{
+			userExists: true,
+			favorites:  map[string][]*Favorite{"user-123": {favorite}},
+		},
+	}
+	handler := &RequestHandler{service: mockService}
+
+	share, err := mockService.CreateShareLink(DefaultOrganizationID, "user-123", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create share link: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/shared/"+share.Token+"/favorites", nil)
+	req = mux.SetURLVars(req, map[string]string{"token": share.Token})
+	w := httptest.NewRecorder()
+
+	handler.GetSharedFavorites(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "fav-1") {
+		t.Fatalf("Expected the shared favorite, got %s", body)
+	}
+	if strings.Contains(body, "notes") || strings.Contains(body, notes) || strings.Contains(body, "user_id") {
+		t.Errorf("Expected no notes or user_id in a shared page, got %s", body)
+	}
+	if favorite.Notes == nil || favorite.UserID != "user-123" {
+		t.Error("Expected the stored favorite to keep its notes and owner")
+	}
+}
+
+// TestAuditLoggerDropsWhenFull verifies Record never blocks the caller
+func TestAuditLoggerDropsWhenFull(t *testing.T) {
+	// No writer goroutine, so nothing drains the buffer
+	logger := &AuditLogger{entries: make(chan *AuditEntry, 1)}
+
+	done := make(chan struct{})
+	go func() {
+		logger.Record(&AuditEntry{Operation: "create", EntityType: "asset"})
+		logger.Record(&AuditEntry{Operation: "delete", EntityType: "asset"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Record blocked on a full buffer")
+	}
+
+	if len(logger.entries) != 1 {
+		t.Errorf("Expected 1 queued entry, got %d", len(logger.entries))
+	}
+
+	// A nil logger discards entries
+	var nilLogger *AuditLogger
+	nilLogger.Record(&AuditEntry{})
+	nilLogger.Close()
+}
+
+// ============================================================================
+// MOCK STORAGE - For unit testing without database
+// ============================================================================
+
+// mockStorage implements the Storage interface for testing.
+// It simulates database operations without requiring a real database connection.
+type mockStorage struct {
+	userExists          bool
+	assets              map[string]*Asset
+	favorites           map[string][]*Favorite
+	idempotentResponses map[string]*IdempotentResponse
+	apiKeys             map[string]*APIKey // by key hash
+	shareTokens         map[string]*ShareToken
+	removedFavorites    map[string][]*Favorite     // by user, kept so they can be restored
+	assetVersions       map[string][]*AssetVersion // by asset, oldest first
+	requestMetrics      []*RequestMetric
+	purges              []string // "favorites" or "assets" for each PurgeDeleted* call, in order
+	favoriteReads       int      // GetFavorite and GetFavorites calls
+	transactions        int      // WithTransaction calls
+	failTransaction     int      // the WithTransaction call that fails, counting from 1; zero for none
 }
 
 // CreateUser simulates user creation
-func (m *mockStorage) CreateUser(userID string) error {
+func (m *mockStorage) CreateUser(orgID string, userID string) error {
+	return nil
+}
+
+// WithTransaction simulates a transaction; mock operations ignore the nil tx.
+// The failTransaction call fails as if its commit did, without undoing anything.
+func (m *mockStorage) WithTransaction(fn func(tx *sql.Tx) error) error {
+	m.transactions++
+	if err := fn(nil); err != nil {
+		return err
+	}
+	if m.transactions == m.failTransaction {
+		return errors.New("commit failed")
+	}
 	return nil
 }
 
+// UserExistsTx simulates UserExists within a transaction
+func (m *mockStorage) UserExistsTx(tx *sql.Tx, orgID string, userID string) (bool, error) {
+	return m.UserExists(orgID, userID)
+}
+
+// GetAssetTx simulates GetAsset within a transaction
+func (m *mockStorage) GetAssetTx(tx *sql.Tx, orgID string, assetID string) (*Asset, error) {
+	return m.GetAsset(orgID, assetID)
+}
+
+// GetAssetForUpdateTx simulates locking an asset for update
+func (m *mockStorage) GetAssetForUpdateTx(tx *sql.Tx, orgID string, assetID string) (*Asset, error) {
+	return m.GetAsset(orgID, assetID)
+}
+
+// UpdateAssetDataTx simulates replacing an asset's data
+func (m *mockStorage) UpdateAssetDataTx(tx *sql.Tx, orgID string, assetID string, data json.RawMessage) (json.RawMessage, bool, error) {
+	asset, ok := m.assets[assetID]
+	if !ok {
+		return nil, false, nil
+	}
+	if !bytes.Equal(asset.Data, data) {
+		if m.assetVersions == nil {
+			m.assetVersions = make(map[string][]*AssetVersion)
+		}
+		m.assetVersions[assetID] = append(m.assetVersions[assetID], &AssetVersion{
+			Version:   len(m.assetVersions[assetID]) + 1,
+			Data:      asset.Data,
+			CreatedAt: time.Now(),
+		})
+	}
+	asset.Data = data
+	return data, true, nil
+}
+
+// GetAssetVersions simulates fetching an asset's previous data, newest first
+func (m *mockStorage) GetAssetVersions(orgID string, assetID string) ([]*AssetVersion, bool, error) {
+	if ok, _ := m.AssetExists(orgID, assetID); !ok {
+		return nil, false, nil
+	}
+	stored := m.assetVersions[assetID]
+	versions := make([]*AssetVersion, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		versions = append(versions, stored[i])
+	}
+	return versions, true, nil
+}
+
+// GetAssetVersion simulates fetching one previous version of an asset's data
+func (m *mockStorage) GetAssetVersion(orgID string, assetID string, version int) (*AssetVersion, error) {
+	stored := m.assetVersions[assetID]
+	if version < 1 || version > len(stored) {
+		return nil, nil
+	}
+	return stored[version-1], nil
+}
+
+// GetAssetVersionTx simulates GetAssetVersion within a transaction
+func (m *mockStorage) GetAssetVersionTx(tx *sql.Tx, orgID string, assetID string, version int) (*AssetVersion, error) {
+	return m.GetAssetVersion(orgID, assetID, version)
+}
+
+// AddToFavoritesTx simulates AddToFavorites within a transaction
+func (m *mockStorage) AddToFavoritesTx(tx *sql.Tx, orgID string, userID string, assetID string, description *string, notes *string, addedAt *time.Time) (string, time.Time, bool, error) {
+	favoriteID, restored, err := m.AddToFavorites(orgID, userID, assetID, description, notes)
+	if favoriteID == "" || err != nil {
+		return favoriteID, time.Time{}, restored, err
+	}
+	favorites := m.favorites[userID]
+	stored := favorites[len(favorites)-1]
+	if addedAt != nil {
+		stored.AddedAt = *addedAt
+	}
+	return favoriteID, stored.AddedAt, restored, nil
+}
+
 // UserExists simulates checking if a user exists
-func (m *mockStorage) UserExists(userID string) (bool, error) {
+func (m *mockStorage) UserExists(orgID string, userID string) (bool, error) {
 	return m.userExists, nil
 }
 
 // ListUsers simulates fetching paginated user list
-func (m *mockStorage) ListUsers(limit int, offset int) ([]*struct {
-	ID        string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-}, int, error) {
-	// Return empty list for mock
-	return make([]*struct {
-		ID        string
-		CreatedAt time.Time
-		UpdatedAt time.Time
-	}, 0), 0, nil
+func (m *mockStorage) ListUsers(orgID string, limit int, offset int) ([]*UserRecord, int, error) {
+	if !m.userExists {
+		return make([]*UserRecord, 0), 0, nil
+	}
+	email := "alice@example.com"
+	return []*UserRecord{{ID: "user-123", CreatedAt: time.Now(), Email: &email}}, 1, nil
+}
+
+// GetUser simulates fetching a single user
+func (m *mockStorage) GetUser(orgID string, userID string) (*UserRecord, error) {
+	if !m.userExists {
+		return nil, nil
+	}
+	return &UserRecord{ID: userID, CreatedAt: time.Now()}, nil
+}
+
+// UpdateUser simulates setting a user's metadata
+func (m *mockStorage) UpdateUser(orgID string, userID string, displayName *string, email *string) (*UserRecord, error) {
+	if !m.userExists {
+		return nil, nil
+	}
+	return &UserRecord{ID: userID, CreatedAt: time.Now(), DisplayName: displayName, Email: email}, nil
+}
+
+// SearchUsers simulates a search that matches one user by display name
+func (m *mockStorage) SearchUsers(orgID string, query string, limit int, offset int) ([]*UserRecord, int, error) {
+	if !m.userExists {
+		return make([]*UserRecord, 0), 0, nil
+	}
+	return []*UserRecord{{ID: "user-123", CreatedAt: time.Now(), DisplayName: &query}}, 1, nil
 }
 
 // DeleteUser simulates user deletion
-func (m *mockStorage) DeleteUser(userID string) error {
-	return nil
+func (m *mockStorage) DeleteUser(orgID string, userID string) (bool, error) {
+	return m.userExists, nil
 }
 
 // CreateAsset simulates creating a new asset (chart, insight, or audience)
-func (m *mockStorage) CreateAsset(assetType string, data json.RawMessage) (string, error) {
+func (m *mockStorage) CreateAsset(orgID string, assetType string, data json.RawMessage, tags []string) (string, error) {
 	assetID := "mock-asset-" + assetType
 	if m.assets == nil {
 		m.assets = make(map[string]*Asset)
@@ -512,16 +5283,36 @@ func (m *mockStorage) CreateAsset(assetType string, data json.RawMessage) (strin
 		ID:   assetID,
 		Type: assetType,
 		Data: data,
+		Tags: tags,
 	}
 	return assetID, nil
 }
 
-// GetAsset simulates retrieving a single asset
-func (m *mockStorage) GetAsset(assetID string) (*Asset, error) {
+// BulkCreateAssets simulates creating several assets in one statement
+func (m *mockStorage) BulkCreateAssets(orgID string, items []BulkAssetInput) ([]string, error) {
+	if m.assets == nil {
+		m.assets = make(map[string]*Asset)
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = "mock-asset-" + item.Type + "-" + strconv.Itoa(i)
+		m.assets[ids[i]] = &Asset{
+			ID:   ids[i],
+			Type: item.Type,
+			Data: item.Data,
+			Tags: item.Tags,
+		}
+	}
+	return ids, nil
+}
+
+// GetAsset simulates retrieving a single asset. Any ID exists unless assets is set
+func (m *mockStorage) GetAsset(orgID string, assetID string) (*Asset, error) {
 	if m.assets != nil {
 		if asset, ok := m.assets[assetID]; ok {
 			return asset, nil
 		}
+		return nil, ErrAssetNotFound
 	}
 	return &Asset{
 		ID:   assetID,
@@ -530,49 +5321,367 @@ func (m *mockStorage) GetAsset(assetID string) (*Asset, error) {
 	}, nil
 }
 
-// ListAssets simulates fetching paginated asset list with optional type filter
-func (m *mockStorage) ListAssets(limit int, offset int, assetType *string) ([]*Asset, int, error) {
-	// Return empty list for mock
-	return make([]*Asset, 0), 0, nil
+// ListAssets simulates fetching paginated asset list with optional type and search filters
+// The search is a case-insensitive substring match rather than full-text search
+func (m *mockStorage) ListAssets(orgID string, limit int, offset int, assetTypes []string, tag *string, search *string, sort string) ([]*Asset, int, error) {
+	assets := make([]*Asset, 0)
+	for _, asset := range m.assets {
+		if len(assetTypes) > 0 {
+			matched := false
+			for _, assetType := range assetTypes {
+				matched = matched || asset.Type == assetType
+			}
+			if !matched {
+				continue
+			}
+		}
+		if search != nil && !strings.Contains(strings.ToLower(string(asset.Data)), strings.ToLower(*search)) {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+	return assets, len(assets), nil
+}
+
+// AssetExists simulates checking for an asset; any ID exists unless assets is set
+func (m *mockStorage) AssetExists(orgID string, assetID string) (bool, error) {
+	if m.assets == nil {
+		return true, nil
+	}
+	_, ok := m.assets[assetID]
+	return ok, nil
 }
 
-// DeleteAsset simulates asset deletion
-func (m *mockStorage) DeleteAsset(assetID string) error {
-	if m.assets != nil {
-		delete(m.assets, assetID)
+// DeleteAsset simulates soft-deleting an asset and the favorites pointing to it
+func (m *mockStorage) DeleteAsset(orgID string, assetID string) (bool, int, error) {
+	if _, ok := m.assets[assetID]; !ok {
+		return false, 0, nil
 	}
-	return nil
+	delete(m.assets, assetID)
+
+	removed := 0
+	for userID, favs := range m.favorites {
+		kept := favs[:0]
+		for _, fav := range favs {
+			if fav.Asset != nil && fav.Asset.ID == assetID {
+				removed++
+				continue
+			}
+			kept = append(kept, fav)
+		}
+		m.favorites[userID] = kept
+	}
+	return true, removed, nil
+}
+
+// BulkDeleteAssets simulates deleting several assets and their favorites
+func (m *mockStorage) BulkDeleteAssets(orgID string, assetIDs []string) ([]string, int, error) {
+	deleted := make([]string, 0, len(assetIDs))
+	removed := 0
+	for _, assetID := range assetIDs {
+		found, n, _ := m.DeleteAsset(orgID, assetID)
+		if found {
+			deleted = append(deleted, assetID)
+			removed += n
+		}
+	}
+	return deleted, removed, nil
 }
 
 // AddToFavorites simulates adding an asset to user's favorites
 // Supports optional custom description override
-func (m *mockStorage) AddToFavorites(userID string, assetID string, description *string) (string, error) {
+func (m *mockStorage) AddToFavorites(orgID string, userID string, assetID string, description *string, notes *string) (string, bool, error) {
 	favoriteID := "mock-favorite-" + assetID
+	for _, fav := range m.favorites[userID] {
+		if fav.Asset != nil && fav.Asset.ID == assetID {
+			// Empty ID means already favorited, as in Storage.AddToFavoritesTx
+			return "", false, nil
+		}
+	}
 	if m.favorites == nil {
 		m.favorites = make(map[string][]*Favorite)
 	}
+	asset, _ := m.GetAsset(orgID, assetID)
 	m.favorites[userID] = append(m.favorites[userID], &Favorite{
 		ID:                  favoriteID,
 		UserID:              userID,
+		Asset:               asset,
 		DescriptionOverride: description,
+		Notes:               notes,
 		AddedAt:             time.Now(),
 	})
-	return favoriteID, nil
+	return favoriteID, false, nil
+}
+
+// GetFavorite simulates fetching one favorite by asset
+func (m *mockStorage) GetFavorite(orgID string, userID string, assetID string) (*Favorite, error) {
+	m.favoriteReads++
+	for _, fav := range m.favorites[userID] {
+		if fav.Asset != nil && fav.Asset.ID == assetID {
+			return fav, nil
+		}
+	}
+	return nil, nil
 }
 
 // GetFavorites simulates retrieving user's favorites with pagination and optional type filter
 func (m *mockStorage) GetFavorites(
+	orgID string,
 	userID string,
 	limit int,
 	offset int,
 	assetType *string,
+	sort []SortField,
+	before *FavoriteCursor,
 ) ([]*Favorite, int, error) {
-	// Return empty list for mock
-	return make([]*Favorite, 0), 0, nil
+	m.favoriteReads++
+	// Cursor pages read the stored favorites, which must be newest first
+	if before != nil {
+		page := make([]*Favorite, 0)
+		for _, fav := range m.favorites[userID] {
+			after := fav.AddedAt.Before(before.AddedAt) ||
+				(before.ID != "" && fav.AddedAt.Equal(before.AddedAt) && fav.ID < before.ID)
+			if !fav.IsPinned && after && len(page) < limit {
+				page = append(page, fav)
+			}
+		}
+		return page, -1, nil
+	}
+	matches := make([]*Favorite, 0)
+	for _, fav := range m.favorites[userID] {
+		if assetType != nil && *assetType != "" && (fav.Asset == nil || fav.Asset.Type != *assetType) {
+			continue
+		}
+		matches = append(matches, fav)
+	}
+	total := len(matches)
+	if offset > total {
+		offset = total
+	}
+	if end := offset + limit; end < total {
+		matches = matches[:end]
+	}
+	return matches[offset:], total, nil
+}
+
+// GetFavoritesAfter simulates keyset pagination; the stored favorites must be in sort order
+func (m *mockStorage) GetFavoritesAfter(orgID string, userID string, limit int, assetType *string, sort []SortField, after *Favorite) ([]*Favorite, error) {
+	page := make([]*Favorite, 0)
+	passed := after == nil
+	for _, fav := range m.favorites[userID] {
+		if !passed {
+			passed = fav.ID == after.ID
+			continue
+		}
+		if assetType != nil && *assetType != "" && fav.Asset.Type != *assetType {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, fav)
+	}
+	return page, nil
+}
+
+// GetFavoritesByType simulates fetching favorites grouped by asset type
+func (m *mockStorage) GetFavoritesByType(orgID string, userID string, perGroup int) (map[string][]*Favorite, error) {
+	groups := make(map[string][]*Favorite)
+	for _, fav := range m.favorites[userID] {
+		if len(groups[fav.Asset.Type]) < perGroup {
+			groups[fav.Asset.Type] = append(groups[fav.Asset.Type], fav)
+		}
+	}
+	return groups, nil
+}
+
+// GetMostRecentFavoritePerType simulates picking the newest favorite of each type
+func (m *mockStorage) GetMostRecentFavoritePerType(orgID string, userID string) (map[string]*Favorite, error) {
+	latest := make(map[string]*Favorite)
+	for _, fav := range m.favorites[userID] {
+		if current, ok := latest[fav.Asset.Type]; !ok || fav.AddedAt.After(current.AddedAt) {
+			latest[fav.Asset.Type] = fav
+		}
+	}
+	return latest, nil
+}
+
+// GetTrendingAssets simulates counting favorites added within the window, across users
+func (m *mockStorage) GetTrendingAssets(orgID string, hours int, limit int) ([]*TrendingAsset, error) {
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	scores := make(map[string]*TrendingAsset)
+	for _, favs := range m.favorites {
+		for _, fav := range favs {
+			if fav.Asset == nil || !fav.AddedAt.After(since) {
+				continue
+			}
+			if scores[fav.Asset.ID] == nil {
+				scores[fav.Asset.ID] = &TrendingAsset{Asset: fav.Asset}
+			}
+			scores[fav.Asset.ID].Score++
+		}
+	}
+
+	trending := make([]*TrendingAsset, 0, len(scores))
+	for _, entry := range scores {
+		trending = append(trending, entry)
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		return trending[i].Score > trending[j].Score
+	})
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+	return trending, nil
+}
+
+// SearchFavorites simulates a case-insensitive description search
+func (m *mockStorage) SearchFavorites(orgID string, userID string, query string, limit int, offset int) ([]*Favorite, int, error) {
+	matches := make([]*Favorite, 0)
+	for _, fav := range m.favorites[userID] {
+		if fav.DescriptionOverride != nil && strings.Contains(strings.ToLower(*fav.DescriptionOverride), strings.ToLower(query)) {
+			matches = append(matches, fav)
+		}
+	}
+	return matches, len(matches), nil
+}
+
+// GetFavoriteAssetTypes simulates listing the distinct types among a user's favorites
+func (m *mockStorage) GetFavoriteAssetTypes(orgID string, userID string) ([]string, error) {
+	seen := make(map[string]bool)
+	types := []string{}
+	for _, fav := range m.favorites[userID] {
+		if !seen[fav.Asset.Type] {
+			seen[fav.Asset.Type] = true
+			types = append(types, fav.Asset.Type)
+		}
+	}
+	sort.Strings(types)
+	return types, nil
+}
+
+// GetUserFavoriteStats simulates computing statistics over the user's favorites
+func (m *mockStorage) GetUserFavoriteStats(orgID string, userID string) (*FavoriteStats, error) {
+	stats := &FavoriteStats{TotalFavorites: len(m.favorites[userID])}
+	counts := make(map[string]int)
+	for _, fav := range m.favorites[userID] {
+		addedAt := fav.AddedAt
+		if stats.OldestFavorite == nil || addedAt.Before(*stats.OldestFavorite) {
+			stats.OldestFavorite = &addedAt
+		}
+		if stats.NewestFavorite == nil || addedAt.After(*stats.NewestFavorite) {
+			stats.NewestFavorite = &addedAt
+		}
+		counts[fav.Asset.Type]++
+	}
+	for assetType, count := range counts {
+		assetType := assetType
+		if stats.MostUsedType == nil || count > counts[*stats.MostUsedType] ||
+			(count == counts[*stats.MostUsedType] && assetType < *stats.MostUsedType) {
+			stats.MostUsedType = &assetType
+		}
+	}
+	return stats, nil
+}
+
+// CountFavoritesByType simulates counting the user's favorites per asset type
+func (m *mockStorage) CountFavoritesByType(orgID string, userID string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, fav := range m.favorites[userID] {
+		counts[fav.Asset.Type]++
+	}
+	return counts, nil
+}
+
+// GetCommonFavorites simulates intersecting two users' favorited assets
+func (m *mockStorage) GetCommonFavorites(orgID string, userID1 string, userID2 string) ([]*Asset, error) {
+	other := make(map[string]bool)
+	for _, fav := range m.favorites[userID2] {
+		other[fav.Asset.ID] = true
+	}
+	assets := []*Asset{}
+	for _, fav := range m.favorites[userID1] {
+		if other[fav.Asset.ID] {
+			assets = append(assets, fav.Asset)
+		}
+	}
+	return assets, nil
+}
+
+// GetFavoriteCalendarData simulates counting favorites per day of a year
+func (m *mockStorage) GetFavoriteCalendarData(orgID string, userID string, year int) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, fav := range m.favorites[userID] {
+		if fav.AddedAt.UTC().Year() == year {
+			counts[fav.AddedAt.UTC().Format("2006-01-02")]++
+		}
+	}
+	return counts, nil
+}
+
+// GetRandomFavorite simulates picking a favorite; the first one stands in for random
+func (m *mockStorage) GetRandomFavorite(orgID string, userID string) (*Favorite, error) {
+	if len(m.favorites[userID]) == 0 {
+		return nil, nil
+	}
+	return m.favorites[userID][0], nil
+}
+
+// GetFavoritesTimeline simulates grouping favorites by the day they were added.
+// Favorites must be stored newest first, as the real query orders them.
+func (m *mockStorage) GetFavoritesTimeline(orgID string, userID string, days int, perDay int) ([]*TimelineDay, error) {
+	since := time.Now().AddDate(0, 0, -days)
+	timeline := []*TimelineDay{}
+	for _, fav := range m.favorites[userID] {
+		if fav.AddedAt.Before(since) {
+			continue
+		}
+		date := fav.AddedAt.Format("2006-01-02")
+		if len(timeline) == 0 || timeline[len(timeline)-1].Date != date {
+			timeline = append(timeline, &TimelineDay{Date: date, Favorites: []*Favorite{}})
+		}
+		entry := timeline[len(timeline)-1]
+		entry.Count++
+		if len(entry.Favorites) < perDay {
+			entry.Favorites = append(entry.Favorites, fav)
+		}
+	}
+	return timeline, nil
+}
+
+// GetRecommendedAssets simulates collaborative filtering: favorites of other
+// users who share at least one favorite with userID, minus userID's own
+func (m *mockStorage) GetRecommendedAssets(orgID string, userID string, limit int) ([]*Asset, error) {
+	mine := make(map[string]bool)
+	for _, fav := range m.favorites[userID] {
+		mine[fav.Asset.ID] = true
+	}
+	assets := make([]*Asset, 0)
+	seen := make(map[string]bool)
+	for otherID, favs := range m.favorites {
+		if otherID == userID {
+			continue
+		}
+		overlaps := false
+		for _, fav := range favs {
+			overlaps = overlaps || mine[fav.Asset.ID]
+		}
+		if !overlaps {
+			continue
+		}
+		for _, fav := range favs {
+			if !mine[fav.Asset.ID] && !seen[fav.Asset.ID] && len(assets) < limit {
+				seen[fav.Asset.ID] = true
+				assets = append(assets, fav.Asset)
+			}
+		}
+	}
+	return assets, nil
 }
 
 // UpdateFavoriteDescription simulates updating a favorite's custom description
 func (m *mockStorage) UpdateFavoriteDescription(
+	orgID string,
 	userID string,
 	assetID string,
 	description string,
@@ -580,11 +5689,275 @@ func (m *mockStorage) UpdateFavoriteDescription(
 	return true, nil
 }
 
+// UpdateFavoriteNotes simulates setting a favorite's notes
+func (m *mockStorage) UpdateFavoriteNotes(orgID string, userID string, assetID string, notes *string) (bool, error) {
+	fav, _ := m.GetFavorite(orgID, userID, assetID)
+	if fav == nil {
+		return false, nil
+	}
+	fav.Notes = notes
+	return true, nil
+}
+
+// SetFavoritePinned simulates pinning or unpinning a favorite
+func (m *mockStorage) SetFavoritePinned(orgID string, userID string, assetID string, pinned bool) (bool, error) {
+	fav, _ := m.GetFavorite(orgID, userID, assetID)
+	if fav == nil {
+		return false, nil
+	}
+	fav.IsPinned = pinned
+	return true, nil
+}
+
+// GetDescriptionHistory simulates fetching a favorite's past descriptions
+func (m *mockStorage) GetDescriptionHistory(orgID string, userID string, assetID string) ([]*DescriptionChange, bool, error) {
+	return make([]*DescriptionChange, 0), true, nil
+}
+
+// ReorderFavorites simulates storing a custom order; fails if any asset isn't favorited
+func (m *mockStorage) ReorderFavorites(orgID string, userID string, order []FavoriteOrder) (bool, error) {
+	for _, item := range order {
+		if ok, _ := m.FavoriteExists(orgID, userID, item.AssetID); !ok {
+			return false, nil
+		}
+	}
+	for _, item := range order {
+		for _, fav := range m.favorites[userID] {
+			if fav.Asset.ID == item.AssetID {
+				fav.OrderIndex = item.OrderIndex
+			}
+		}
+	}
+	return true, nil
+}
+
+// FavoriteExists simulates checking for an active favorite
+func (m *mockStorage) FavoriteExists(orgID string, userID string, assetID string) (bool, error) {
+	for _, fav := range m.favorites[userID] {
+		if fav.Asset != nil && fav.Asset.ID == assetID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckFavorites simulates the batch favorite lookup
+func (m *mockStorage) CheckFavorites(orgID string, userID string, assetIDs []string) (map[string]bool, error) {
+	favorited := make(map[string]bool)
+	for _, assetID := range assetIDs {
+		if ok, _ := m.FavoriteExists(orgID, userID, assetID); ok {
+			favorited[assetID] = true
+		}
+	}
+	return favorited, nil
+}
+
 // RemoveFromFavorites simulates soft-delete of a favorite (sets deleted_at timestamp)
-func (m *mockStorage) RemoveFromFavorites(userID string, assetID string) (bool, error) {
+// Without stored favorites every asset counts as favorited.
+func (m *mockStorage) RemoveFromFavorites(orgID string, userID string, assetID string) (bool, error) {
+	if m.favorites == nil {
+		return true, nil
+	}
+	favs := m.favorites[userID]
+	for i, fav := range favs {
+		if fav.Asset != nil && fav.Asset.ID == assetID {
+			m.favorites[userID] = append(favs[:i], favs[i+1:]...)
+			if m.removedFavorites == nil {
+				m.removedFavorites = make(map[string][]*Favorite)
+			}
+			m.removedFavorites[userID] = append(m.removedFavorites[userID], fav)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RestoreFavorite simulates undoing RemoveFromFavorites; the window is ignored
+func (m *mockStorage) RestoreFavorite(orgID string, userID string, assetID string, removedAfter time.Time) (bool, error) {
+	removed := m.removedFavorites[userID]
+	for i, fav := range removed {
+		if fav.Asset != nil && fav.Asset.ID == assetID {
+			m.removedFavorites[userID] = append(removed[:i], removed[i+1:]...)
+			m.favorites[userID] = append(m.favorites[userID], fav)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetDeletedFavorites simulates listing removed favorites, most recently removed first
+func (m *mockStorage) GetDeletedFavorites(orgID string, userID string, removedAfter time.Time, limit int, offset int) ([]*Favorite, int, error) {
+	removed := make([]*Favorite, 0)
+	for i := len(m.removedFavorites[userID]) - 1; i >= 0; i-- {
+		removed = append(removed, m.removedFavorites[userID][i])
+	}
+	total := len(removed)
+	if offset > total {
+		offset = total
+	}
+	if end := offset + limit; end < total {
+		removed = removed[:end]
+	}
+	return removed[offset:], total, nil
+}
+
+// RemoveAllFavorites simulates soft-deleting every favorite of a user
+func (m *mockStorage) RemoveAllFavorites(orgID string, userID string) (int, error) {
+	removed := len(m.favorites[userID])
+	delete(m.favorites, userID)
+	return removed, nil
+}
+
+// PurgeDeletedFavorites simulates purging removed favorites; the age is ignored
+func (m *mockStorage) PurgeDeletedFavorites(olderThan time.Duration) (int, error) {
+	purged := 0
+	for _, removed := range m.removedFavorites {
+		purged += len(removed)
+	}
+	m.removedFavorites = nil
+	m.purges = append(m.purges, "favorites")
+	return purged, nil
+}
+
+// PurgeDeletedAssets simulates purging deleted assets; DeleteAsset keeps none
+func (m *mockStorage) PurgeDeletedAssets(olderThan time.Duration) (int, error) {
+	m.purges = append(m.purges, "assets")
+	return 0, nil
+}
+
+// CreateWebhook simulates registering a webhook
+func (m *mockStorage) CreateWebhook(orgID string, userID string, url string, secret string) (*Webhook, error) {
+	return &Webhook{
+		ID:        "mock-webhook",
+		UserID:    userID,
+		URL:       url,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// ListWebhooks simulates fetching a user's webhooks
+func (m *mockStorage) ListWebhooks(userID string) ([]*Webhook, error) {
+	return make([]*Webhook, 0), nil
+}
+
+// DeleteWebhook simulates removing a webhook
+func (m *mockStorage) DeleteWebhook(orgID string, userID string, webhookID string) (bool, error) {
 	return true, nil
 }
 
+// CreateAPIKey simulates storing an API key hash
+func (m *mockStorage) CreateAPIKey(orgID string, userID string, keyHash string, rateLimitRPS int, expiresAt *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		ID:           "mock-api-key",
+		UserID:       userID,
+		KeyHash:      keyHash,
+		RateLimitRPS: rateLimitRPS,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+	}
+	if m.apiKeys == nil {
+		m.apiKeys = make(map[string]*APIKey)
+	}
+	m.apiKeys[keyHash] = key
+	return key, nil
+}
+
+// GetAPIKeyByHash simulates looking up an API key by hash
+func (m *mockStorage) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	return m.apiKeys[keyHash], nil
+}
+
+// ListAPIKeys simulates listing API keys
+func (m *mockStorage) ListAPIKeys(orgID string) ([]*APIKey, error) {
+	keys := make([]*APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey simulates revoking an API key
+func (m *mockStorage) DeleteAPIKey(orgID string, keyID string) (bool, error) {
+	for hash, key := range m.apiKeys {
+		if key.ID == keyID {
+			delete(m.apiKeys, hash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CreateShareToken simulates storing a share token
+func (m *mockStorage) CreateShareToken(orgID string, userID string, token string, expiresAt time.Time) (*ShareToken, error) {
+	share := &ShareToken{
+		Token:     token,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if m.shareTokens == nil {
+		m.shareTokens = make(map[string]*ShareToken)
+	}
+	m.shareTokens[token] = share
+	return share, nil
+}
+
+// GetShareToken simulates looking up a share token
+func (m *mockStorage) GetShareToken(token string) (*ShareToken, error) {
+	return m.shareTokens[token], nil
+}
+
+// ListAssetTypes simulates fetching the asset types table
+func (m *mockStorage) ListAssetTypes() ([]*AssetType, error) {
+	return []*AssetType{{Name: "chart"}, {Name: "insight"}, {Name: "audience"}}, nil
+}
+
+// CreateAssetType simulates adding an asset type
+func (m *mockStorage) CreateAssetType(orgID string, name string, schema json.RawMessage) (*AssetType, error) {
+	return &AssetType{Name: name, Schema: schema, CreatedAt: time.Now()}, nil
+}
+
+// ListAuditLog simulates fetching the audit log
+func (m *mockStorage) ListAuditLog(orgID string, limit int, offset int) ([]*AuditEntry, int, error) {
+	return make([]*AuditEntry, 0), 0, nil
+}
+
+// GetUserActivity simulates a user who has added one favorite
+func (m *mockStorage) GetUserActivity(orgID string, userID string, limit int, offset int) ([]*AuditEvent, int, error) {
+	assetID := "asset-1"
+	return []*AuditEvent{{Action: "add_favorite", AssetID: &assetID, Timestamp: time.Now()}}, 1, nil
+}
+
+// RecordRequestMetric simulates queueing a request metric; it's kept for inspection
+func (m *mockStorage) RecordRequestMetric(metric *RequestMetric) {
+	m.requestMetrics = append(m.requestMetrics, metric)
+}
+
+// GetEndpointSLOs simulates computing latency percentiles
+func (m *mockStorage) GetEndpointSLOs(hours int) ([]*EndpointSLO, error) {
+	return make([]*EndpointSLO, 0), nil
+}
+
+// GetIdempotentResponse simulates looking up a stored response by idempotency key
+func (m *mockStorage) GetIdempotentResponse(userID string, key string) (*IdempotentResponse, error) {
+	if m.idempotentResponses != nil {
+		if resp, ok := m.idempotentResponses[userID+"/"+key]; ok {
+			return resp, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveIdempotentResponse simulates storing a response under an idempotency key
+func (m *mockStorage) SaveIdempotentResponse(userID string, key string, statusCode int, body []byte) error {
+	if m.idempotentResponses == nil {
+		m.idempotentResponses = make(map[string]*IdempotentResponse)
+	}
+	m.idempotentResponses[userID+"/"+key] = &IdempotentResponse{StatusCode: statusCode, Body: body}
+	return nil
+}
+
 // Close simulates closing database connection
 func (m *mockStorage) Close() error {
 	return nil
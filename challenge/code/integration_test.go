@@ -0,0 +1,1123 @@
+//go:build integration
+
+package main
+
+// Integration tests run against a real PostgreSQL started with testcontainers-go,
+// so they catch SQL and schema mistakes the mock storage can't. Docker is required:
+//
+//	go test -tags integration -v
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// integrationStorage is connected to the test container for the whole run.
+var integrationStorage *Storage
+
+// TestMain starts PostgreSQL with schema.sql applied, runs the tests and
+// removes the container.
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	container, err := postgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:15-alpine"),
+		postgres.WithDatabase("gwi_challenge"),
+		postgres.WithUsername("user"),
+		postgres.WithPassword("password"),
+		postgres.WithInitScripts("schema.sql"),
+		// The server restarts once after running init scripts
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	if err != nil {
+		log.Fatalf("Failed to start PostgreSQL container: %v", err)
+	}
+
+	connString, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		container.Terminate(ctx)
+		log.Fatalf("Failed to get connection string: %v", err)
+	}
+
+	integrationStorage, err = NewStorage(connString, DefaultDBMaxRetries)
+	if err != nil {
+		container.Terminate(ctx)
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+
+	code := m.Run()
+
+	integrationStorage.Close()
+	if err := container.Terminate(ctx); err != nil {
+		log.Printf("Failed to terminate PostgreSQL container: %v", err)
+	}
+	os.Exit(code)
+}
+
+// newIntegrationOrg returns a fresh organization ID, so counts and listings
+// in one test aren't affected by rows other tests created.
+func newIntegrationOrg() string {
+	return "org-" + uuid.New().String()
+}
+
+// createIntegrationUser inserts a user in orgID and returns its ID.
+func createIntegrationUser(t *testing.T, orgID string) string {
+	t.Helper()
+	userID := uuid.New().String()
+	if err := integrationStorage.CreateUser(orgID, userID); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return userID
+}
+
+// addIntegrationFavorite adds assetID to the user's favorites.
+func addIntegrationFavorite(t *testing.T, orgID string, userID string, assetID string, description *string) {
+	t.Helper()
+	favoriteID, _, err := integrationStorage.AddToFavorites(orgID, userID, assetID, description, nil)
+	if err != nil {
+		t.Fatalf("AddToFavorites failed: %v", err)
+	}
+	if favoriteID == "" {
+		t.Fatalf("Expected asset %s to be added, it was already a favorite", assetID)
+	}
+}
+
+// createIntegrationAsset inserts an asset of assetType in orgID and returns its ID.
+func createIntegrationAsset(t *testing.T, orgID string, assetType string, tags ...string) string {
+	t.Helper()
+	if tags == nil {
+		tags = []string{}
+	}
+	assetID, err := integrationStorage.CreateAsset(orgID, assetType, json.RawMessage(`{"title":"Daily Users"}`), tags)
+	if err != nil {
+		t.Fatalf("CreateAsset failed: %v", err)
+	}
+	return assetID
+}
+
+// TestIntegrationAddFavoriteConflict verifies the unique index on
+// (user_id, asset_id): adding an active favorite again is a 409, while
+// re-adding a removed one restores it.
+func TestIntegrationAddFavoriteConflict(t *testing.T) {
+	service := NewService(integrationStorage, nil, nil, nil, false, false, 0)
+	handler := &RequestHandler{service: service, storage: integrationStorage}
+
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+
+	add := func() int {
+		body, _ := json.Marshal(map[string]string{"asset_id": assetID})
+		req := httptest.NewRequest("POST", "/api/v1/users/"+userID+"/favorites", bytes.NewBuffer(body))
+		req = mux.SetURLVars(req, map[string]string{"userID": userID})
+		w := httptest.NewRecorder()
+		handler.AddFavorite(w, req)
+		return w.Code
+	}
+
+	if code := add(); code != http.StatusCreated {
+		t.Fatalf("Expected status %d on first add, got %d", http.StatusCreated, code)
+	}
+	if code := add(); code != http.StatusConflict {
+		t.Fatalf("Expected status %d on second add, got %d", http.StatusConflict, code)
+	}
+
+	if err := service.RemoveFavorite(DefaultOrganizationID, userID, assetID); err != nil {
+		t.Fatalf("RemoveFavorite failed: %v", err)
+	}
+	if code := add(); code != http.StatusOK {
+		t.Errorf("Expected status %d when re-adding a removed favorite, got %d", http.StatusOK, code)
+	}
+}
+
+// TestIntegrationAddFavoriteAddedAt verifies the added_at returned on create
+// is the one stored by the database, in UTC
+func TestIntegrationAddFavoriteAddedAt(t *testing.T) {
+	service := NewService(integrationStorage, nil, nil, nil, false, false, 0)
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+
+	favorite, _, err := service.AddFavorite(DefaultOrganizationID, userID, assetID, nil, nil)
+	if err != nil {
+		t.Fatalf("AddFavorite failed: %v", err)
+	}
+	stored, err := integrationStorage.GetFavorite(DefaultOrganizationID, userID, assetID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetFavorite failed: %v, %v", stored, err)
+	}
+	if !favorite.AddedAt.Equal(stored.AddedAt) || favorite.AddedAt.Location() != time.UTC {
+		t.Errorf("Expected added_at %v in UTC, got %v", stored.AddedAt, favorite.AddedAt)
+	}
+}
+
+// TestIntegrationAuditAfterCommit verifies audit entries recorded within a
+// transaction are only queued once it commits
+func TestIntegrationAuditAfterCommit(t *testing.T) {
+	auditLog := &AuditLogger{entries: make(chan *AuditEntry, 10)}
+	storage := &Storage{db: integrationStorage.db, auditLog: auditLog}
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+
+	add := func(tx *sql.Tx) error {
+		_, _, _, err := storage.AddToFavoritesTx(tx, DefaultOrganizationID, userID, assetID, nil, nil, nil)
+		return err
+	}
+
+	rollback := errors.New("rollback")
+	if err := storage.WithTransaction(func(tx *sql.Tx) error {
+		if err := add(tx); err != nil {
+			return err
+		}
+		return rollback
+	}); err != rollback {
+		t.Fatalf("Expected the rollback error, got %v", err)
+	}
+	if len(auditLog.entries) != 0 {
+		t.Errorf("Expected no audit entry after rollback, got %d", len(auditLog.entries))
+	}
+
+	if err := storage.WithTransaction(add); err != nil {
+		t.Fatalf("WithTransaction failed: %v", err)
+	}
+	if len(auditLog.entries) != 1 {
+		t.Errorf("Expected 1 audit entry after commit, got %d", len(auditLog.entries))
+	}
+}
+
+// TestIntegrationUsers covers creating, listing, fetching and deleting users
+func TestIntegrationUsers(t *testing.T) {
+	orgID := newIntegrationOrg()
+	first := createIntegrationUser(t, orgID)
+	second := createIntegrationUser(t, orgID)
+
+	exists, err := integrationStorage.UserExists(orgID, first)
+	if err != nil || !exists {
+		t.Fatalf("Expected user to exist, got %v, %v", exists, err)
+	}
+	if exists, _ := integrationStorage.UserExists(newIntegrationOrg(), first); exists {
+		t.Error("Expected user to be hidden from other organizations")
+	}
+
+	users, total, err := integrationStorage.ListUsers(orgID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if total != 2 || len(users) != 2 {
+		t.Errorf("Expected 2 users, got %d (total %d)", len(users), total)
+	}
+
+	user, err := integrationStorage.GetUser(orgID, second)
+	if err != nil || user == nil || user.ID != second {
+		t.Fatalf("Expected GetUser to return %s, got %v, %v", second, user, err)
+	}
+
+	name, email := "Alice", "alice@example.com"
+	updated, err := integrationStorage.UpdateUser(orgID, second, &name, &email)
+	if err != nil || updated == nil {
+		t.Fatalf("UpdateUser failed: %v, %v", updated, err)
+	}
+	user, _ = integrationStorage.GetUser(orgID, second)
+	if user.DisplayName == nil || *user.DisplayName != name || user.Email == nil || *user.Email != email {
+		t.Errorf("Expected metadata to be stored, got %v, %v", user.DisplayName, user.Email)
+	}
+	users, _, _ = integrationStorage.ListUsers(orgID, 10, 0)
+	for _, listed := range users {
+		if listed.Email != nil {
+			t.Errorf("Expected the user list to leave out emails, got %s", *listed.Email)
+		}
+	}
+	found, total, err := integrationStorage.SearchUsers(orgID, "EXAMPLE.com", 10, 0)
+	if err != nil || total != 1 || len(found) != 1 || found[0].ID != second {
+		t.Errorf("Expected search by email to find %s, got %v (total %d), %v", second, found, total, err)
+	}
+	if _, total, _ := integrationStorage.SearchUsers(orgID, "%", 10, 0); total != 0 {
+		t.Errorf("Expected %% to match literally, got %d users", total)
+	}
+
+	if updated, _ := integrationStorage.UpdateUser(orgID, second, nil, nil); updated == nil || updated.DisplayName != nil || updated.Email != nil {
+		t.Errorf("Expected nil to clear metadata, got %+v", updated)
+	}
+	if updated, _ := integrationStorage.UpdateUser(newIntegrationOrg(), second, &name, nil); updated != nil {
+		t.Error("Expected users of other organizations not to be updated")
+	}
+
+	deleted, err := integrationStorage.DeleteUser(orgID, first)
+	if err != nil || !deleted {
+		t.Fatalf("Expected user to be deleted, got %v, %v", deleted, err)
+	}
+	if user, _ := integrationStorage.GetUser(orgID, first); user != nil {
+		t.Error("Expected deleted user to be gone")
+	}
+	if deleted, _ := integrationStorage.DeleteUser(orgID, first); deleted {
+		t.Error("Expected deleting a missing user to report not found")
+	}
+}
+
+// TestIntegrationUserActivity covers the activity timeline read from the audit log
+func TestIntegrationUserActivity(t *testing.T) {
+	orgID := newIntegrationOrg()
+	userID := createIntegrationUser(t, orgID)
+	other := createIntegrationUser(t, orgID)
+	assetID := createIntegrationAsset(t, orgID, "chart")
+
+	// The audit logger writes asynchronously, so entries are inserted directly
+	entries := []struct {
+		orgID      string
+		operation  string
+		entityType string
+		userID     string
+		createdAt  string
+	}{
+		{orgID, "create", "favorite", userID, "2024-01-01"},
+		{orgID, "delete", "favorite", userID, "2024-01-02"},
+		{orgID, "create", "favorite", other, "2024-01-03"},
+		{newIntegrationOrg(), "update", "favorite", userID, "2024-01-04"},
+	}
+	for _, e := range entries {
+		_, err := integrationStorage.db.Exec(`
+			INSERT INTO audit_log (id, organization_id, operation, entity_type, entity_id, user_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, uuid.New().String(), e.orgID, e.operation, e.entityType, assetID, e.userID, e.createdAt)
+		if err != nil {
+			t.Fatalf("Inserting audit entry failed: %v", err)
+		}
+	}
+
+	events, total, err := integrationStorage.GetUserActivity(orgID, userID, 10, 0)
+	if err != nil {
+		t.Fatalf("GetUserActivity failed: %v", err)
+	}
+	if total != 2 || len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d (total %d)", len(events), total)
+	}
+	if events[0].Action != "remove_favorite" || events[1].Action != "add_favorite" {
+		t.Errorf("Expected newest first, got %s then %s", events[0].Action, events[1].Action)
+	}
+	if events[0].AssetID == nil || *events[0].AssetID != assetID {
+		t.Errorf("Expected asset ID %s, got %v", assetID, events[0].AssetID)
+	}
+
+	logEntries, total, err := integrationStorage.ListAuditLog(orgID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListAuditLog failed: %v", err)
+	}
+	if total != 3 || len(logEntries) != 3 {
+		t.Errorf("Expected only the organization's 3 entries, got %d (total %d)", len(logEntries), total)
+	}
+}
+
+// TestIntegrationAssets covers asset CRUD, filters, popularity and data updates
+func TestIntegrationAssets(t *testing.T) {
+	orgID := newIntegrationOrg()
+	userID := createIntegrationUser(t, orgID)
+	chart := createIntegrationAsset(t, orgID, "chart", "sales")
+	insight := createIntegrationAsset(t, orgID, "insight")
+
+	asset, err := integrationStorage.GetAsset(orgID, chart)
+	if err != nil || asset == nil || asset.Type != "chart" || asset.CreatedAt.IsZero() {
+		t.Fatalf("Expected GetAsset to return the chart with its created_at, got %v, %v", asset, err)
+	}
+	if exists, _ := integrationStorage.AssetExists(orgID, insight); !exists {
+		t.Error("Expected insight to exist")
+	}
+
+	assets, total, err := integrationStorage.ListAssets(orgID, 10, 0, nil, nil, nil, "newest")
+	if err != nil || total != 2 || len(assets) != 2 {
+		t.Fatalf("Expected 2 assets, got %d (total %d), %v", len(assets), total, err)
+	}
+	if assets[0].ID != insight {
+		t.Errorf("Expected newest asset first, got %s", assets[0].ID)
+	}
+
+	if _, total, err := integrationStorage.ListAssets(orgID, 10, 0, []string{}, nil, nil, "newest"); err != nil || total != 2 {
+		t.Errorf("Expected no types to be no filter, got total %d, %v", total, err)
+	}
+	if _, total, err := integrationStorage.ListAssets(orgID, 10, 0, []string{"chart", "insight"}, nil, nil, "newest"); err != nil || total != 2 {
+		t.Errorf("Expected both assets for types chart and insight, got total %d, %v", total, err)
+	}
+
+	tag := "sales"
+	assets, total, err = integrationStorage.ListAssets(orgID, 10, 0, []string{"chart"}, &tag, nil, "newest")
+	if err != nil || total != 1 || len(assets) != 1 || assets[0].ID != chart {
+		t.Errorf("Expected only the chart for type and tag filters, got %v (total %d), %v", assets, total, err)
+	}
+
+	search := "daily"
+	if _, total, err := integrationStorage.ListAssets(orgID, 10, 0, nil, nil, &search, "newest"); err != nil || total != 2 {
+		t.Errorf("Expected full-text search to match both assets, got total %d, %v", total, err)
+	}
+	search = "title"
+	if _, total, err := integrationStorage.ListAssets(orgID, 10, 0, nil, nil, &search, "newest"); err != nil || total != 0 {
+		t.Errorf("Expected JSON keys not to be searched, got total %d, %v", total, err)
+	}
+	search = "weekly"
+	if _, total, err := integrationStorage.ListAssets(orgID, 10, 0, nil, nil, &search, "popularity"); err != nil || total != 0 {
+		t.Errorf("Expected no assets for a word not in their data, got total %d, %v", total, err)
+	}
+
+	addIntegrationFavorite(t, orgID, userID, chart, nil)
+	assets, _, err = integrationStorage.ListAssets(orgID, 10, 0, nil, nil, nil, "popularity")
+	if err != nil || len(assets) != 2 || assets[0].ID != chart || assets[0].FavoriteCount != 1 {
+		t.Errorf("Expected the favorited chart first by popularity, got %v, %v", assets, err)
+	}
+
+	err = integrationStorage.WithTransaction(func(tx *sql.Tx) error {
+		if _, err := integrationStorage.GetAssetForUpdateTx(tx, orgID, insight); err != nil {
+			return err
+		}
+		_, _, err := integrationStorage.UpdateAssetDataTx(tx, orgID, insight, json.RawMessage(`{"text":"Up 5%"}`))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Updating asset data failed: %v", err)
+	}
+	asset, _ = integrationStorage.GetAsset(orgID, insight)
+	if asset == nil || string(asset.Data) != `{"text": "Up 5%"}` {
+		t.Errorf("Expected updated data, got %v", asset)
+	}
+
+	found, favoritesRemoved, err := integrationStorage.DeleteAsset(orgID, chart)
+	if err != nil || !found || favoritesRemoved != 1 {
+		t.Fatalf("Expected chart deleted with 1 favorite, got %v, %d, %v", found, favoritesRemoved, err)
+	}
+	if _, err := integrationStorage.GetAsset(orgID, chart); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Expected deleted asset to be hidden, got %v", err)
+	}
+	if exists, _ := integrationStorage.FavoriteExists(orgID, userID, chart); exists {
+		t.Error("Expected favorites of a deleted asset to be removed")
+	}
+}
+
+// TestIntegrationFavorites covers adding, listing, updating and removing favorites
+func TestIntegrationFavorites(t *testing.T) {
+	orgID := newIntegrationOrg()
+	userID := createIntegrationUser(t, orgID)
+	chart := createIntegrationAsset(t, orgID, "chart")
+	insight := createIntegrationAsset(t, orgID, "insight")
+
+	description := "Quarterly revenue"
+	addIntegrationFavorite(t, orgID, userID, chart, &description)
+	addIntegrationFavorite(t, orgID, userID, insight, nil)
+
+	favoriteID, _, err := integrationStorage.AddToFavorites(orgID, userID, chart, nil, nil)
+	if err != nil || favoriteID != "" {
+		t.Errorf("Expected adding an active favorite again to be a no-op, got %q, %v", favoriteID, err)
+	}
+
+	favorites, total, err := integrationStorage.GetFavorites(orgID, userID, 10, 0, nil, nil, nil)
+	if err != nil || total != 2 || len(favorites) != 2 {
+		t.Fatalf("Expected 2 favorites, got %d (total %d), %v", len(favorites), total, err)
+	}
+	if favorites[0].Asset.ID != insight {
+		t.Errorf("Expected newest favorite first, got %s", favorites[0].Asset.ID)
+	}
+
+	// Cursor pages skip the count
+	before := &FavoriteCursor{AddedAt: favorites[0].AddedAt, ID: favorites[0].ID}
+	favorites, total, err = integrationStorage.GetFavorites(orgID, userID, 10, 0, nil, nil, before)
+	if err != nil || total != -1 || len(favorites) != 1 || favorites[0].Asset.ID != chart {
+		t.Errorf("Expected only the chart before the cursor, got %v (total %d), %v", favorites, total, err)
+	}
+
+	// Favorites sharing an added_at, as an import batch does, are continued by ID
+	if _, err := integrationStorage.db.Exec("UPDATE favorites SET added_at = $1 WHERE user_id = $2", before.AddedAt, userID); err != nil {
+		t.Fatalf("Failed to share added_at: %v", err)
+	}
+	first, _, err := integrationStorage.GetFavorites(orgID, userID, 1, 0, nil, nil, nil)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Expected the first page, got %v, %v", first, err)
+	}
+	next, _, err := integrationStorage.GetFavorites(orgID, userID, 10, 0, nil, nil, &FavoriteCursor{AddedAt: first[0].AddedAt, ID: first[0].ID})
+	if err != nil || len(next) != 1 || next[0].ID == first[0].ID {
+		t.Errorf("Expected the other favorite with the same added_at, got %v, %v", next, err)
+	}
+
+	assetType := "insight"
+	favorites, total, err = integrationStorage.GetFavorites(orgID, userID, 10, 0, &assetType, nil, nil)
+	if err != nil || total != 1 || favorites[0].Asset.ID != insight {
+		t.Errorf("Expected only the insight for the type filter, got %v, %v", favorites, err)
+	}
+
+	if ok, err := integrationStorage.ReorderFavorites(orgID, userID, []FavoriteOrder{
+		{AssetID: chart, OrderIndex: 1},
+		{AssetID: insight, OrderIndex: 2},
+	}); err != nil || !ok {
+		t.Fatalf("Expected reorder to succeed, got %v, %v", ok, err)
+	}
+	custom, _ := ParseFavoriteSort("custom", "")
+	favorites, _, err = integrationStorage.GetFavorites(orgID, userID, 10, 0, nil, custom, nil)
+	if err != nil || favorites[0].Asset.ID != chart {
+		t.Errorf("Expected the chart first in custom order, got %v, %v", favorites, err)
+	}
+
+	byType, _ := ParseFavoriteSort("asset_type,added_at", "desc,asc")
+	favorites, _, err = integrationStorage.GetFavorites(orgID, userID, 10, 0, nil, byType, nil)
+	if err != nil || len(favorites) != 2 || favorites[0].Asset.ID != insight {
+		t.Errorf("Expected the insight first by asset_type descending, got %v, %v", favorites, err)
+	}
+
+	updated, err := integrationStorage.UpdateFavoriteDescription(orgID, userID, chart, "Annual revenue")
+	if err != nil || !updated {
+		t.Fatalf("Expected description update, got %v, %v", updated, err)
+	}
+	history, found, err := integrationStorage.GetDescriptionHistory(orgID, userID, chart)
+	if err != nil || !found || len(history) != 1 || history[0].Description == nil || *history[0].Description != description {
+		t.Errorf("Expected previous description in history, got %v, %v", history, err)
+	}
+
+	notes := "ask finance"
+	if ok, err := integrationStorage.UpdateFavoriteNotes(orgID, userID, chart, &notes); err != nil || !ok {
+		t.Fatalf("Expected notes update, got %v, %v", ok, err)
+	}
+	favorite, err := integrationStorage.GetFavorite(orgID, userID, chart)
+	if err != nil || favorite == nil || favorite.Notes == nil || *favorite.Notes != notes || *favorite.DescriptionOverride != "Annual revenue" {
+		t.Errorf("Expected updated description and notes, got %v, %v", favorite, err)
+	}
+
+	checked, err := integrationStorage.CheckFavorites(orgID, userID, []string{chart, uuid.New().String()})
+	if err != nil || len(checked) != 1 || !checked[chart] {
+		t.Errorf("Expected only the chart to be checked, got %v, %v", checked, err)
+	}
+
+	removed, err := integrationStorage.RemoveFromFavorites(orgID, userID, chart)
+	if err != nil || !removed {
+		t.Fatalf("Expected favorite to be removed, got %v, %v", removed, err)
+	}
+	if exists, _ := integrationStorage.FavoriteExists(orgID, userID, chart); exists {
+		t.Error("Expected removed favorite not to exist")
+	}
+
+	count, err := integrationStorage.RemoveAllFavorites(orgID, userID)
+	if err != nil || count != 1 {
+		t.Errorf("Expected 1 favorite cleared, got %d, %v", count, err)
+	}
+}
+
+// TestIntegrationFavoriteViews covers the derived favorites queries
+func TestIntegrationFavoriteViews(t *testing.T) {
+	orgID := newIntegrationOrg()
+	userID := createIntegrationUser(t, orgID)
+	neighbor := createIntegrationUser(t, orgID)
+	chart := createIntegrationAsset(t, orgID, "chart")
+	insight := createIntegrationAsset(t, orgID, "insight")
+	audience := createIntegrationAsset(t, orgID, "audience")
+
+	description := "100% growth_rate"
+	addIntegrationFavorite(t, orgID, userID, chart, &description)
+	addIntegrationFavorite(t, orgID, userID, insight, nil)
+	addIntegrationFavorite(t, orgID, neighbor, chart, nil)
+	addIntegrationFavorite(t, orgID, neighbor, audience, nil)
+
+	// LIKE wildcards in the query are matched literally
+	favorites, total, err := integrationStorage.SearchFavorites(orgID, userID, "100%", 10, 0)
+	if err != nil || total != 1 || favorites[0].Asset.ID != chart {
+		t.Errorf("Expected the chart to match the search, got %v (total %d), %v", favorites, total, err)
+	}
+	if _, total, _ := integrationStorage.SearchFavorites(orgID, userID, "growth%rate", 10, 0); total != 0 {
+		t.Errorf("Expected %% to be matched literally, got %d results", total)
+	}
+
+	types, err := integrationStorage.GetFavoriteAssetTypes(orgID, userID)
+	if err != nil || len(types) != 2 || types[0] != "chart" || types[1] != "insight" {
+		t.Errorf("Expected [chart insight], got %v, %v", types, err)
+	}
+
+	groups, err := integrationStorage.GetFavoritesByType(orgID, userID, 10)
+	if err != nil || len(groups["chart"]) != 1 || len(groups["insight"]) != 1 {
+		t.Errorf("Expected one favorite per type, got %v, %v", groups, err)
+	}
+
+	timeline, err := integrationStorage.GetFavoritesTimeline(orgID, userID, 1, 10)
+	if err != nil || len(timeline) != 1 || timeline[0].Count != 2 || len(timeline[0].Favorites) != 2 {
+		t.Errorf("Expected today's 2 favorites in the timeline, got %v, %v", timeline, err)
+	}
+	timeline, err = integrationStorage.GetFavoritesTimeline(orgID, userID, 1, 1)
+	if err != nil || len(timeline) != 1 || timeline[0].Count != 2 || len(timeline[0].Favorites) != 1 {
+		t.Errorf("Expected 1 of today's 2 favorites listed, got %v, %v", timeline, err)
+	}
+
+	random, err := integrationStorage.GetRandomFavorite(orgID, userID)
+	if err != nil || random == nil {
+		t.Errorf("Expected a random favorite, got %v, %v", random, err)
+	}
+
+	recommended, err := integrationStorage.GetRecommendedAssets(orgID, userID, 10)
+	if err != nil || len(recommended) != 1 || recommended[0].ID != audience {
+		t.Errorf("Expected the neighbor's audience to be recommended, got %v, %v", recommended, err)
+	}
+}
+
+// TestIntegrationAccess covers webhooks, API keys and share tokens
+func TestIntegrationAccess(t *testing.T) {
+	orgID := newIntegrationOrg()
+	userID := createIntegrationUser(t, orgID)
+
+	webhook, err := integrationStorage.CreateWebhook(orgID, userID, "https://example.com/hook", "secret")
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+	webhooks, err := integrationStorage.ListWebhooks(userID)
+	if err != nil || len(webhooks) != 1 || webhooks[0].Secret != "secret" {
+		t.Errorf("Expected the webhook with its secret, got %v, %v", webhooks, err)
+	}
+	if deleted, err := integrationStorage.DeleteWebhook(orgID, userID, webhook.ID); err != nil || !deleted {
+		t.Errorf("Expected webhook to be deleted, got %v, %v", deleted, err)
+	}
+
+	key, err := integrationStorage.CreateAPIKey(orgID, userID, "hash-"+userID, 5, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	found, err := integrationStorage.GetAPIKeyByHash("hash-" + userID)
+	if err != nil || found == nil || found.ID != key.ID || found.OrganizationID != orgID {
+		t.Errorf("Expected the key with the user's organization, got %v, %v", found, err)
+	}
+	keys, err := integrationStorage.ListAPIKeys(orgID)
+	if err != nil || len(keys) != 1 {
+		t.Errorf("Expected 1 key in the organization, got %v, %v", keys, err)
+	}
+	if deleted, err := integrationStorage.DeleteAPIKey(orgID, key.ID); err != nil || !deleted {
+		t.Errorf("Expected key to be revoked, got %v, %v", deleted, err)
+	}
+
+	token := "token-" + userID
+	if _, err := integrationStorage.CreateShareToken(orgID, userID, token, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateShareToken failed: %v", err)
+	}
+	share, err := integrationStorage.GetShareToken(token)
+	if err != nil || share == nil || share.UserID != userID || share.OrgID != orgID {
+		t.Errorf("Expected the share token with its user, got %v, %v", share, err)
+	}
+}
+
+// TestIntegrationIdempotency covers storing, replaying and expiring idempotent responses
+func TestIntegrationIdempotency(t *testing.T) {
+	userID := createIntegrationUser(t, newIntegrationOrg())
+
+	if err := integrationStorage.SaveIdempotentResponse(userID, "key-1", http.StatusCreated, []byte(`{"id":"1"}`)); err != nil {
+		t.Fatalf("SaveIdempotentResponse failed: %v", err)
+	}
+	response, err := integrationStorage.GetIdempotentResponse(userID, "key-1")
+	if err != nil || response == nil || response.StatusCode != http.StatusCreated || string(response.Body) != `{"id":"1"}` {
+		t.Fatalf("Expected the stored response, got %v, %v", response, err)
+	}
+
+	if _, err := integrationStorage.DeleteExpiredIdempotencyKeys(0); err != nil {
+		t.Fatalf("DeleteExpiredIdempotencyKeys failed: %v", err)
+	}
+	if response, _ := integrationStorage.GetIdempotentResponse(userID, "key-1"); response != nil {
+		t.Error("Expected the expired response to be deleted")
+	}
+}
+
+// TestIntegrationDBHealthCheck verifies GET /health/db reports a reachable database
+func TestIntegrationDBHealthCheck(t *testing.T) {
+	handler := &RequestHandler{storage: integrationStorage}
+
+	req := httptest.NewRequest("GET", "/health/db", nil)
+	w := httptest.NewRecorder()
+	handler.DBHealthCheck(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp DBHealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Status != "ok" || resp.Error != "" {
+		t.Errorf("Expected status ok without an error, got %+v, %v", resp, err)
+	}
+}
+
+// TestIntegrationReadyz verifies GET /api/v1/readyz reports ready once the database answers
+func TestIntegrationReadyz(t *testing.T) {
+	handler := &RequestHandler{storage: integrationStorage}
+
+	req := httptest.NewRequest("GET", "/api/v1/readyz", nil)
+	w := httptest.NewRecorder()
+	handler.Readyz(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp ReadinessResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Status != "ready" {
+		t.Errorf("Expected status ready, got %+v, %v", resp, err)
+	}
+}
+
+// TestIntegrationRestoreFavorite covers restoring removed favorites within the window
+func TestIntegrationRestoreFavorite(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+	notes := "check monthly"
+
+	if _, _, err := integrationStorage.AddToFavorites(DefaultOrganizationID, userID, assetID, nil, &notes); err != nil {
+		t.Fatalf("AddToFavorites failed: %v", err)
+	}
+	if restored, err := integrationStorage.RestoreFavorite(DefaultOrganizationID, userID, assetID, time.Now().Add(-time.Hour)); err != nil || restored {
+		t.Errorf("Expected an active favorite not to be restored, got %v, %v", restored, err)
+	}
+
+	if _, err := integrationStorage.RemoveFromFavorites(DefaultOrganizationID, userID, assetID); err != nil {
+		t.Fatalf("RemoveFromFavorites failed: %v", err)
+	}
+	deleted, total, err := integrationStorage.GetDeletedFavorites(DefaultOrganizationID, userID, time.Now().Add(-time.Hour), 10, 0)
+	if err != nil || total != 1 || len(deleted) != 1 || deleted[0].DeletedAt == nil {
+		t.Errorf("Expected the removed favorite with deleted_at, got %v of %d, %v", deleted, total, err)
+	}
+	if restored, err := integrationStorage.RestoreFavorite(DefaultOrganizationID, userID, assetID, time.Now().Add(time.Hour)); err != nil || restored {
+		t.Errorf("Expected a removal outside the window not to be restored, got %v, %v", restored, err)
+	}
+	if restored, err := integrationStorage.RestoreFavorite(DefaultOrganizationID, userID, assetID, time.Now().Add(-time.Hour)); err != nil || !restored {
+		t.Fatalf("Expected the favorite to be restored, got %v, %v", restored, err)
+	}
+	if _, total, _ := integrationStorage.GetDeletedFavorites(DefaultOrganizationID, userID, time.Now().Add(-time.Hour), 10, 0); total != 0 {
+		t.Errorf("Expected no removed favorites after restoring, got %d", total)
+	}
+	favorite, err := integrationStorage.GetFavorite(DefaultOrganizationID, userID, assetID)
+	if err != nil || favorite == nil || favorite.Notes == nil || *favorite.Notes != notes {
+		t.Errorf("Expected the restored favorite with its notes, got %v, %v", favorite, err)
+	}
+}
+
+// TestIntegrationPurgeDeletedAssets covers purging old deleted assets no favorite points to
+func TestIntegrationPurgeDeletedAssets(t *testing.T) {
+	orgID := newIntegrationOrg()
+	userID := createIntegrationUser(t, orgID)
+	unused := createIntegrationAsset(t, orgID, "chart")
+	favorited := createIntegrationAsset(t, orgID, "insight")
+	addIntegrationFavorite(t, orgID, userID, favorited, nil)
+
+	for _, assetID := range []string{unused, favorited} {
+		if found, _, err := integrationStorage.DeleteAsset(orgID, assetID); err != nil || !found {
+			t.Fatalf("DeleteAsset %s failed: %v, %v", assetID, found, err)
+		}
+	}
+	if _, err := integrationStorage.db.Exec("UPDATE assets SET deleted_at = CURRENT_TIMESTAMP - INTERVAL '91 days' WHERE organization_id = $1", orgID); err != nil {
+		t.Fatalf("Backdating the deletions failed: %v", err)
+	}
+
+	if purged, err := integrationStorage.PurgeDeletedAssets(DeletedAssetRetention); err != nil || purged < 1 {
+		t.Fatalf("Expected the unused asset to be purged, got %d, %v", purged, err)
+	}
+
+	var remaining []string
+	rows, err := integrationStorage.db.Query("SELECT id FROM assets WHERE organization_id = $1", orgID)
+	if err != nil {
+		t.Fatalf("Listing assets failed: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var assetID string
+		rows.Scan(&assetID)
+		remaining = append(remaining, assetID)
+	}
+	if len(remaining) != 1 || remaining[0] != favorited {
+		t.Errorf("Expected only the asset with a removed favorite to remain, got %v", remaining)
+	}
+}
+
+// TestIntegrationPurgeDeletedFavorites covers purging favorites removed before the retention
+func TestIntegrationPurgeDeletedFavorites(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	old := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+	recent := createIntegrationAsset(t, DefaultOrganizationID, "insight")
+	addIntegrationFavorite(t, DefaultOrganizationID, userID, old, nil)
+	addIntegrationFavorite(t, DefaultOrganizationID, userID, recent, nil)
+
+	if _, err := integrationStorage.RemoveAllFavorites(DefaultOrganizationID, userID); err != nil {
+		t.Fatalf("RemoveAllFavorites failed: %v", err)
+	}
+	if _, err := integrationStorage.db.Exec("UPDATE favorites SET deleted_at = CURRENT_TIMESTAMP - INTERVAL '31 days' WHERE user_id = $1 AND asset_id = $2", userID, old); err != nil {
+		t.Fatalf("Backdating the removal failed: %v", err)
+	}
+
+	if purged, err := integrationStorage.PurgeDeletedFavorites(FavoriteRestoreWindow); err != nil || purged < 1 {
+		t.Fatalf("Expected the old removal to be purged, got %d, %v", purged, err)
+	}
+
+	var remaining []string
+	rows, err := integrationStorage.db.Query("SELECT asset_id FROM favorites WHERE user_id = $1", userID)
+	if err != nil {
+		t.Fatalf("Listing favorites failed: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var assetID string
+		rows.Scan(&assetID)
+		remaining = append(remaining, assetID)
+	}
+	if len(remaining) != 1 || remaining[0] != recent {
+		t.Errorf("Expected only the recent removal to remain, got %v", remaining)
+	}
+}
+
+// TestIntegrationBulkCreateAssets covers inserting several assets in one statement
+func TestIntegrationBulkCreateAssets(t *testing.T) {
+	items := []BulkAssetInput{
+		{Type: "chart", Data: json.RawMessage(`{"title":"bulk chart"}`), Tags: []string{"bulk"}},
+		{Type: "audience", Data: json.RawMessage(`{"name":"bulk audience"}`), Tags: []string{}},
+	}
+	ids, err := integrationStorage.BulkCreateAssets(DefaultOrganizationID, items)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("BulkCreateAssets failed: %v, %v", ids, err)
+	}
+	for i, id := range ids {
+		asset, err := integrationStorage.GetAsset(DefaultOrganizationID, id)
+		if err != nil || asset == nil || asset.Type != items[i].Type {
+			t.Errorf("Expected asset %d of type %s, got %v, %v", i, items[i].Type, asset, err)
+		}
+	}
+
+	// A row the database rejects fails the whole statement
+	items = append(items, BulkAssetInput{Type: "unknown", Data: json.RawMessage(`{}`), Tags: []string{}})
+	if _, err := integrationStorage.BulkCreateAssets(DefaultOrganizationID, items); err == nil {
+		t.Error("Expected an unknown asset type to fail the insert")
+	}
+}
+
+// TestIntegrationBulkDeleteAssets covers deleting several assets and cascading to favorites
+func TestIntegrationBulkDeleteAssets(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	first := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+	second := createIntegrationAsset(t, DefaultOrganizationID, "insight")
+	other := createIntegrationAsset(t, newIntegrationOrg(), "chart")
+
+	if _, _, err := integrationStorage.AddToFavorites(DefaultOrganizationID, userID, first, nil, nil); err != nil {
+		t.Fatalf("AddToFavorites failed: %v", err)
+	}
+
+	deleted, favoritesRemoved, err := integrationStorage.BulkDeleteAssets(DefaultOrganizationID, []string{first, second, other})
+	if err != nil {
+		t.Fatalf("BulkDeleteAssets failed: %v", err)
+	}
+	// The other organization's asset is out of scope and not deleted
+	if len(deleted) != 2 || deleted[0] == other || deleted[1] == other || favoritesRemoved != 1 {
+		t.Errorf("Expected %s and %s deleted with 1 favorite, got %v with %d", first, second, deleted, favoritesRemoved)
+	}
+	if exists, _ := integrationStorage.FavoriteExists(DefaultOrganizationID, userID, first); exists {
+		t.Error("Expected the favorite of a deleted asset to be removed")
+	}
+}
+
+// TestIntegrationGetUserFavoriteStats covers the stats query with and without favorites
+func TestIntegrationGetUserFavoriteStats(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+
+	stats, err := integrationStorage.GetUserFavoriteStats(DefaultOrganizationID, userID)
+	if err != nil || stats.TotalFavorites != 0 || stats.OldestFavorite != nil || stats.MostUsedType != nil {
+		t.Fatalf("Expected empty stats, got %+v, %v", stats, err)
+	}
+
+	for _, assetType := range []string{"insight", "chart", "chart"} {
+		assetID := createIntegrationAsset(t, DefaultOrganizationID, assetType)
+		if _, _, err := integrationStorage.AddToFavorites(DefaultOrganizationID, userID, assetID, nil, nil); err != nil {
+			t.Fatalf("AddToFavorites failed: %v", err)
+		}
+	}
+
+	stats, err = integrationStorage.GetUserFavoriteStats(DefaultOrganizationID, userID)
+	if err != nil || stats.TotalFavorites != 3 || stats.MostUsedType == nil || *stats.MostUsedType != "chart" {
+		t.Fatalf("Expected 3 favorites mostly charts, got %+v, %v", stats, err)
+	}
+	if stats.OldestFavorite == nil || stats.NewestFavorite == nil || stats.NewestFavorite.Before(*stats.OldestFavorite) {
+		t.Errorf("Expected oldest before newest, got %v and %v", stats.OldestFavorite, stats.NewestFavorite)
+	}
+}
+
+// TestIntegrationCountFavoritesByType covers per-type counts of active favorites
+func TestIntegrationCountFavoritesByType(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+
+	var removed string
+	for _, assetType := range []string{"chart", "chart", "insight"} {
+		assetID := createIntegrationAsset(t, DefaultOrganizationID, assetType)
+		if _, _, err := integrationStorage.AddToFavorites(DefaultOrganizationID, userID, assetID, nil, nil); err != nil {
+			t.Fatalf("AddToFavorites failed: %v", err)
+		}
+		removed = assetID
+	}
+	if _, err := integrationStorage.RemoveFromFavorites(DefaultOrganizationID, userID, removed); err != nil {
+		t.Fatalf("RemoveFromFavorites failed: %v", err)
+	}
+
+	counts, err := integrationStorage.CountFavoritesByType(DefaultOrganizationID, userID)
+	if err != nil {
+		t.Fatalf("CountFavoritesByType failed: %v", err)
+	}
+	if len(counts) != 1 || counts["chart"] != 2 {
+		t.Errorf("Expected 2 charts and no removed insight, got %v", counts)
+	}
+}
+
+// TestIntegrationGetCommonFavorites covers intersecting two users' active favorites
+func TestIntegrationGetCommonFavorites(t *testing.T) {
+	first := createIntegrationUser(t, DefaultOrganizationID)
+	second := createIntegrationUser(t, DefaultOrganizationID)
+	shared := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+	removed := createIntegrationAsset(t, DefaultOrganizationID, "insight")
+	own := createIntegrationAsset(t, DefaultOrganizationID, "audience")
+
+	for _, fav := range []struct{ userID, assetID string }{
+		{first, shared}, {second, shared}, {first, removed}, {second, removed}, {first, own},
+	} {
+		if _, _, err := integrationStorage.AddToFavorites(DefaultOrganizationID, fav.userID, fav.assetID, nil, nil); err != nil {
+			t.Fatalf("AddToFavorites failed: %v", err)
+		}
+	}
+	if _, err := integrationStorage.RemoveFromFavorites(DefaultOrganizationID, second, removed); err != nil {
+		t.Fatalf("RemoveFromFavorites failed: %v", err)
+	}
+
+	assets, err := integrationStorage.GetCommonFavorites(DefaultOrganizationID, first, second)
+	if err != nil || len(assets) != 1 || assets[0].ID != shared {
+		t.Errorf("Expected only %s in common, got %v, %v", shared, assets, err)
+	}
+}
+
+// TestIntegrationGetFavoriteCalendarData covers counting this year's favorites per day
+func TestIntegrationGetFavoriteCalendarData(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	for i := 0; i < 2; i++ {
+		assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+		if _, _, err := integrationStorage.AddToFavorites(DefaultOrganizationID, userID, assetID, nil, nil); err != nil {
+			t.Fatalf("AddToFavorites failed: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	counts, err := integrationStorage.GetFavoriteCalendarData(DefaultOrganizationID, userID, now.Year())
+	if err != nil || counts[now.Format("2006-01-02")] != 2 {
+		t.Errorf("Expected 2 favorites today, got %v, %v", counts, err)
+	}
+	if counts, err := integrationStorage.GetFavoriteCalendarData(DefaultOrganizationID, userID, now.Year()-1); err != nil || len(counts) != 0 {
+		t.Errorf("Expected no favorites last year, got %v, %v", counts, err)
+	}
+}
+
+// TestIntegrationAssetVersions covers keeping replaced data as versions and restoring one
+func TestIntegrationAssetVersions(t *testing.T) {
+	service := NewService(integrationStorage, nil, nil, nil, false, false, 0)
+	assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+
+	for _, patch := range []string{`{"title":"Weekly Users"}`, `{"title":"Weekly Users"}`} {
+		if _, err := service.PatchAsset(DefaultOrganizationID, assetID, json.RawMessage(patch), ""); err != nil {
+			t.Fatalf("PatchAsset failed: %v", err)
+		}
+	}
+
+	versions, found, err := integrationStorage.GetAssetVersions(DefaultOrganizationID, assetID)
+	if err != nil || !found || len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("Expected one version for the one real change, got %v, %v, %v", versions, found, err)
+	}
+
+	asset, err := service.RestoreAssetVersion(DefaultOrganizationID, assetID, 1)
+	if err != nil || string(asset.Data) != `{"title": "Daily Users"}` {
+		t.Fatalf("Expected the original data restored, got %v, %v", asset, err)
+	}
+	version, err := integrationStorage.GetAssetVersion(DefaultOrganizationID, assetID, 2)
+	if err != nil || version == nil || string(version.Data) != `{"title": "Weekly Users"}` {
+		t.Errorf("Expected the replaced data as version 2, got %v, %v", version, err)
+	}
+	if version, _ := integrationStorage.GetAssetVersion(newIntegrationOrg(), assetID, 1); version != nil {
+		t.Error("Expected versions to be hidden from other organizations")
+	}
+}
+
+// TestIntegrationPatchAssetETag covers the ETag returned by a PATCH matching
+// the next read, so If-Match can be chained across updates
+func TestIntegrationPatchAssetETag(t *testing.T) {
+	service := NewService(integrationStorage, nil, nil, nil, false, false, 0)
+	assetID := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+
+	// JSONB reorders keys and adds spaces, so the stored text differs from the patch
+	patched, err := service.PatchAsset(DefaultOrganizationID, assetID, json.RawMessage(`{"y_axis":"Count","x_axis":"Date"}`), "")
+	if err != nil {
+		t.Fatalf("PatchAsset failed: %v", err)
+	}
+	fetched, err := integrationStorage.GetAsset(DefaultOrganizationID, assetID)
+	if err != nil {
+		t.Fatalf("GetAsset failed: %v", err)
+	}
+	if AssetETag(patched) != AssetETag(fetched) {
+		t.Errorf("Expected the PATCH ETag to match a fresh read, got %s and %s", AssetETag(patched), AssetETag(fetched))
+	}
+
+	if _, err := service.PatchAsset(DefaultOrganizationID, assetID, json.RawMessage(`{"title":"Weekly Users"}`), AssetETag(patched)); err != nil {
+		t.Errorf("Expected a PATCH with the previous ETag to succeed, got %v", err)
+	}
+}
+
+// TestIntegrationPinnedFavoritesFirst covers pinned favorites leading the default sort
+func TestIntegrationPinnedFavoritesFirst(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	older := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+	newer := createIntegrationAsset(t, DefaultOrganizationID, "insight")
+	addIntegrationFavorite(t, DefaultOrganizationID, userID, older, nil)
+	addIntegrationFavorite(t, DefaultOrganizationID, userID, newer, nil)
+
+	if found, err := integrationStorage.SetFavoritePinned(DefaultOrganizationID, userID, older, true); err != nil || !found {
+		t.Fatalf("SetFavoritePinned failed: %v, %v", found, err)
+	}
+
+	favorites, _, err := integrationStorage.GetFavorites(DefaultOrganizationID, userID, 10, 0, nil, nil, nil)
+	if err != nil || len(favorites) != 2 || favorites[0].Asset.ID != older || !favorites[0].IsPinned {
+		t.Errorf("Expected the pinned favorite first, got %v, %v", favorites, err)
+	}
+	if found, _ := integrationStorage.SetFavoritePinned(DefaultOrganizationID, userID, createIntegrationAsset(t, DefaultOrganizationID, "chart"), true); found {
+		t.Error("Expected pinning a non-favorite to find nothing")
+	}
+}
+
+// TestIntegrationEndpointSLOs covers writing request metrics and computing percentiles
+func TestIntegrationEndpointSLOs(t *testing.T) {
+	endpoint := "/test/" + uuid.New().String()
+	recorder := NewMetricsRecorder(integrationStorage.db, 100)
+	for i := 1; i <= 100; i++ {
+		recorder.Record(&RequestMetric{
+			Endpoint:   endpoint,
+			Method:     "GET",
+			StatusCode: http.StatusOK,
+			DurationMS: float64(i),
+			RecordedAt: time.Now().UTC(),
+		})
+	}
+	// Close waits for the queued metrics to be written
+	recorder.Close()
+
+	slos, err := integrationStorage.GetEndpointSLOs(1)
+	if err != nil {
+		t.Fatalf("GetEndpointSLOs failed: %v", err)
+	}
+	var found *EndpointSLO
+	for _, slo := range slos {
+		if slo.Endpoint == endpoint {
+			found = slo
+		}
+	}
+	if found == nil || found.Requests != 100 || found.P50MS != 50.5 || found.P99MS < 99 || found.P99MS > 100 {
+		t.Errorf("Expected percentiles of 1..100 ms, got %+v", found)
+	}
+}
+
+// TestIntegrationGetFavoritesAfter covers keyset pages, including favorites added at the same instant
+func TestIntegrationGetFavoritesAfter(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	for i := 0; i < 5; i++ {
+		addIntegrationFavorite(t, DefaultOrganizationID, userID, createIntegrationAsset(t, DefaultOrganizationID, "chart"), nil)
+	}
+	// Force a tie so the ID has to break it
+	if _, err := integrationStorage.db.Exec("UPDATE favorites SET added_at = '2024-01-01' WHERE user_id = $1", userID); err != nil {
+		t.Fatalf("Setting added_at failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var after *Favorite
+	for {
+		page, err := integrationStorage.GetFavoritesAfter(DefaultOrganizationID, userID, 2, nil, nil, after)
+		if err != nil {
+			t.Fatalf("GetFavoritesAfter failed: %v", err)
+		}
+		for _, favorite := range page {
+			if seen[favorite.ID] {
+				t.Fatalf("Favorite %s returned twice", favorite.ID)
+			}
+			seen[favorite.ID] = true
+		}
+		if len(page) < 2 {
+			break
+		}
+		after = page[len(page)-1]
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected all 5 favorites across pages, got %d", len(seen))
+	}
+}
+
+// TestIntegrationGetFavoritesAfterSorted covers keyset pages in a sort with mixed directions
+func TestIntegrationGetFavoritesAfterSorted(t *testing.T) {
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	for i, assetType := range []string{"chart", "chart", "insight", "insight", "audience"} {
+		assetID := createIntegrationAsset(t, DefaultOrganizationID, assetType)
+		addIntegrationFavorite(t, DefaultOrganizationID, userID, assetID, nil)
+		// Favorites of the same type share added_at in pairs, so the ID has to break ties
+		_, err := integrationStorage.db.Exec("UPDATE favorites SET added_at = $1 WHERE user_id = $2 AND asset_id = $3",
+			time.Date(2024, 1, 1+i/2, 0, 0, 0, 0, time.UTC), userID, assetID)
+		if err != nil {
+			t.Fatalf("Setting added_at failed: %v", err)
+		}
+	}
+
+	sort := []SortField{{Field: "asset_type"}, {Field: "added_at", Desc: true}}
+	want, _, err := integrationStorage.GetFavorites(DefaultOrganizationID, userID, 10, 0, nil, sort, nil)
+	if err != nil {
+		t.Fatalf("GetFavorites failed: %v", err)
+	}
+
+	var got []string
+	var after *Favorite
+	for {
+		page, err := integrationStorage.GetFavoritesAfter(DefaultOrganizationID, userID, 2, nil, sort, after)
+		if err != nil {
+			t.Fatalf("GetFavoritesAfter failed: %v", err)
+		}
+		for _, favorite := range page {
+			got = append(got, favorite.ID)
+		}
+		if len(page) < 2 {
+			break
+		}
+		after = page[len(page)-1]
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d favorites across pages, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i].ID {
+			t.Errorf("Position %d: expected %s, got %s", i, want[i].ID, got[i])
+		}
+	}
+}
+
+// TestIntegrationImportFavorites covers importing lines, skipping existing favorites and unknown assets
+func TestIntegrationImportFavorites(t *testing.T) {
+	service := NewService(integrationStorage, nil, nil, nil, false, false, 0)
+	userID := createIntegrationUser(t, DefaultOrganizationID)
+	existing := createIntegrationAsset(t, DefaultOrganizationID, "chart")
+	fresh := createIntegrationAsset(t, DefaultOrganizationID, "insight")
+	addIntegrationFavorite(t, DefaultOrganizationID, userID, existing, nil)
+
+	body := `{"asset": {"id": "` + existing + `"}}` + "\n" +
+		`{"asset": {"id": "` + fresh + `"}, "notes": "imported", "added_at": "2024-01-02T03:04:05+02:00"}` + "\n" +
+		`{"asset": {"id": "` + uuid.New().String() + `"}}` + "\n"
+	result, err := service.ImportFavorites(DefaultOrganizationID, userID, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("ImportFavorites failed: %v", err)
+	}
+	if result.Imported != 1 || result.Skipped != 1 || len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Errorf("Expected 1 imported, 1 skipped and line 3 rejected, got %+v", result)
+	}
+	favorite, err := integrationStorage.GetFavorite(DefaultOrganizationID, userID, fresh)
+	if err != nil || favorite == nil || favorite.Notes == nil || *favorite.Notes != "imported" {
+		t.Errorf("Expected the imported favorite with its notes, got %v, %v", favorite, err)
+	} else if want := time.Date(2024, 1, 2, 1, 4, 5, 0, time.UTC); !favorite.AddedAt.Equal(want) {
+		t.Errorf("Expected added_at %v in UTC, got %v", want, favorite.AddedAt)
+	}
+}
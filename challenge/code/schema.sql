@@ -15,8 +15,8 @@
 -- Users table (minimal - just identity)
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Assets table (all types: chart, insight, audience)
@@ -25,8 +25,8 @@ CREATE TABLE IF NOT EXISTS assets (
     id UUID PRIMARY KEY,
     type VARCHAR(20) NOT NULL CHECK (type IN ('chart', 'insight', 'audience')),
     data JSONB NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Favorites junction table
@@ -37,10 +37,183 @@ CREATE TABLE IF NOT EXISTS favorites (
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
     description_override TEXT,
-    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    deleted_at TIMESTAMP
+    added_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+-- Description history
+-- Previous values of favorites.description_override, written alongside each update
+CREATE TABLE IF NOT EXISTS favorite_description_history (
+    id UUID PRIMARY KEY,
+    favorite_id UUID NOT NULL REFERENCES favorites(id) ON DELETE CASCADE,
+    description TEXT,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Asset versions
+-- Previous values of assets.data, written before each change; the primary key
+-- also serves listing an asset's versions in order
+CREATE TABLE IF NOT EXISTS asset_versions (
+    asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (asset_id, version)
+);
+
+-- Webhooks notified when a user's favorites change
+-- secret signs each delivery (X-Signature: HMAC-SHA256 of the body)
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API keys for server-to-server clients
+-- Only the SHA-256 of the key is stored; rate_limit_rps is enforced per key
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    key_hash TEXT NOT NULL UNIQUE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rate_limit_rps INTEGER NOT NULL DEFAULT 10,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ
+);
+
+-- Share tokens: public, read-only links to a user's favorites
+CREATE TABLE IF NOT EXISTS share_tokens (
+    token UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Audit log: one row per successful create/update/delete
+-- No foreign keys: entries must outlive the users and entities they describe.
+-- For favorites, entity_id is the asset ID.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id UUID PRIMARY KEY,
+    operation TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id TEXT,
+    user_id TEXT,
+    payload JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Request metrics: one row per routed request, for latency SLOs
+-- endpoint is the route template; rows older than 7 days are deleted hourly.
+CREATE TABLE IF NOT EXISTS request_metrics (
+    endpoint TEXT NOT NULL,
+    method TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    duration_ms DOUBLE PRECISION NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Asset types: the allowed values of assets.type
+-- Admins can add types at runtime; schema_json optionally describes their data.
+CREATE TABLE IF NOT EXISTS asset_types (
+    name VARCHAR(20) PRIMARY KEY,
+    schema_json JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO asset_types (name) VALUES ('chart'), ('insight'), ('audience')
+ON CONFLICT (name) DO NOTHING;
+
+-- Idempotency keys for POST /users/{userID}/favorites
+-- Stores the first response for a key so client retries replay it.
+-- user_id is not a foreign key: responses for unknown users are stored too.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    response_body BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
 );
 
+-- ============================================================================
+-- MIGRATIONS (idempotent, safe to re-run on existing databases)
+-- ============================================================================
+
+-- Asset tags: free-form labels orthogonal to asset type
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- Asset types moved from a CHECK constraint to the asset_types table
+ALTER TABLE assets DROP CONSTRAINT IF EXISTS assets_type_check;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'assets_type_fkey') THEN
+        ALTER TABLE assets ADD CONSTRAINT assets_type_fkey FOREIGN KEY (type) REFERENCES asset_types (name);
+    END IF;
+END $$;
+
+-- Asset soft deletes: deleting an asset also soft-deletes its favorites
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Custom favorites order: lists sorted with sort=custom use order_index ascending
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS order_index INTEGER NOT NULL DEFAULT 0;
+
+-- Multi-tenancy: users, assets and favorites belong to an organization
+-- Existing rows move to the 'default' organization.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS organization_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS organization_id TEXT NOT NULL DEFAULT 'default';
+
+-- Full-text search over asset data (GET /assets?q=)
+-- Only string values are indexed, so JSON keys like "title" don't match every asset.
+-- A generated column can't be altered, so one built from data::text is dropped and
+-- recreated (its index goes with it and is rebuilt below).
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'assets' AND column_name = 'data_search'
+          AND generation_expression NOT LIKE '%jsonb_to_tsvector%'
+    ) THEN
+        ALTER TABLE assets DROP COLUMN data_search;
+    END IF;
+END $$;
+ALTER TABLE assets ADD COLUMN IF NOT EXISTS data_search tsvector GENERATED ALWAYS AS (jsonb_to_tsvector('english', data, '["string"]')) STORED;
+
+-- Private notes, separate from description_override (which replaces the display label)
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS notes TEXT;
+
+-- Pinned favorites are listed first by the default sort, by order_index
+ALTER TABLE favorites ADD COLUMN IF NOT EXISTS is_pinned BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Optional user metadata, set with PUT /users/{userID}
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email TEXT;
+
+-- Timestamps are TIMESTAMPTZ, so they don't depend on the server's TimeZone setting
+-- Older databases used TIMESTAMP holding UTC wall time; convert those columns in place.
+DO $$
+DECLARE
+    col RECORD;
+BEGIN
+    FOR col IN
+        SELECT table_name, column_name FROM information_schema.columns
+        WHERE table_schema = current_schema() AND data_type = 'timestamp without time zone'
+    LOOP
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE ''UTC''',
+            col.table_name, col.column_name, col.column_name);
+    END LOOP;
+END $$;
+ALTER TABLE favorites ALTER COLUMN added_at SET DEFAULT CURRENT_TIMESTAMP;
+
+-- Audit entries belong to the organization of the change
+-- Existing rows take their user's organization, or 'default' without one.
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS organization_id TEXT NOT NULL DEFAULT 'default';
+UPDATE audit_log l
+SET organization_id = u.organization_id
+FROM users u
+WHERE l.user_id = u.id::text AND l.organization_id <> u.organization_id;
+
 -- ============================================================================
 -- INDEXES
 -- ============================================================================
@@ -51,25 +224,78 @@ CREATE TABLE IF NOT EXISTS favorites (
 -- Main query pattern: "get all favorites for user, sorted by date, excluding deleted"
 -- This index makes that very fast by clustering data the way we query it
 
--- Filtered unique index: only enforce uniqueness for active (non-deleted) favorites
--- This allows soft deletes to work correctly - users can re-favorite deleted items
-CREATE UNIQUE INDEX IF NOT EXISTS idx_user_active_favorite_unique ON favorites (user_id, asset_id)
-WHERE deleted_at IS NULL;
+-- One row per (user, asset) pair, deleted or not.
+-- Re-favoriting a soft-deleted item revives the existing row (ON CONFLICT DO UPDATE),
+-- so the unique index must cover deleted rows too.
+-- Older databases used a filtered index and may hold duplicate deleted rows:
+-- keep the active row (or the most recently deleted one) before indexing.
+DELETE FROM favorites f
+USING favorites keep
+WHERE f.user_id = keep.user_id
+  AND f.asset_id = keep.asset_id
+  AND f.id <> keep.id
+  AND f.deleted_at IS NOT NULL
+  AND (keep.deleted_at IS NULL OR keep.deleted_at > f.deleted_at);
+
+DROP INDEX IF EXISTS idx_user_active_favorite_unique;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_favorite_unique ON favorites (user_id, asset_id);
 
 -- Sorted favorites for user (newest first)
 CREATE INDEX IF NOT EXISTS idx_user_active_favorites ON favorites (user_id, added_at DESC)
 WHERE deleted_at IS NULL;
 
+-- Custom order: "get favorites by order_index"
+CREATE INDEX IF NOT EXISTS idx_user_ordered_favorites ON favorites (user_id, order_index)
+WHERE deleted_at IS NULL;
+
 -- Alternative sort: "get favorites by type"
 CREATE INDEX IF NOT EXISTS idx_user_type_favorites ON favorites (user_id, asset_id)
 WHERE deleted_at IS NULL;
 
+-- Recently removed favorites, for the restore UI
+CREATE INDEX IF NOT EXISTS idx_user_deleted_favorites ON favorites (user_id, deleted_at DESC)
+WHERE deleted_at IS NOT NULL;
+
 -- Foreign key lookups
 CREATE INDEX IF NOT EXISTS idx_favorite_asset ON favorites (asset_id);
 
 -- Search by asset type (useful for filtering without joining)
 CREATE INDEX IF NOT EXISTS idx_asset_type ON assets (type);
 
+-- Tag filtering: "tags @> ARRAY[$1]" can use a GIN index ("$1 = ANY(tags)" can't)
+CREATE INDEX IF NOT EXISTS idx_asset_tags ON assets USING GIN (tags);
+
+-- Users and assets are always listed within one organization
+CREATE INDEX IF NOT EXISTS idx_users_organization ON users (organization_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_assets_organization ON assets (organization_id, created_at DESC);
+
+-- Webhooks are always looked up per user
+CREATE INDEX IF NOT EXISTS idx_webhooks_user ON webhooks (user_id);
+
+-- Share tokens by owner (cascade deletes)
+CREATE INDEX IF NOT EXISTS idx_share_tokens_user ON share_tokens (user_id);
+
+-- Audit log is listed newest first
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (created_at DESC);
+
+-- Audit log of one organization, newest first
+CREATE INDEX IF NOT EXISTS idx_audit_log_organization ON audit_log (organization_id, created_at DESC);
+
+-- Activity timeline of one user, newest first
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log (user_id, created_at DESC);
+
+-- Expired idempotency key cleanup
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys (created_at);
+
+-- SLO window and metrics cleanup both filter on recorded_at
+CREATE INDEX IF NOT EXISTS idx_request_metrics_recorded ON request_metrics (recorded_at);
+
+-- Full-text search: "assets whose data matches q"
+CREATE INDEX IF NOT EXISTS assets_fts_idx ON assets USING GIN (data_search);
+
+-- Description history for a favorite, newest first
+CREATE INDEX IF NOT EXISTS idx_description_history_favorite ON favorite_description_history (favorite_id, changed_at DESC);
+
 -- ============================================================================
 -- HELPER FUNCTIONS
 -- ============================================================================